@@ -3,6 +3,7 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"monkey/token"
@@ -25,11 +26,36 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // Every comment in the source, in order
+}
+
+// Comment is a '#' comment, which runs to the end of its line. Comments are
+// kept on the Program for tools like the formatter and are not visited by
+// Walk.
+type Comment struct {
+	Token token.Token // Literal is the text of the comment including the '#'
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	Keys   []Expression // The keys of Pairs in source order
+	Rbrace token.Token  // The closing '}'
+}
+
+// OrderedKeys returns the keys of Pairs in source order. For a literal built
+// without Keys they are sorted by their String instead.
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	if len(hl.Keys) == len(hl.Pairs) {
+		return hl.Keys
+	}
+
+	keys := make([]Expression, 0, len(hl.Pairs))
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -37,8 +63,8 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.OrderedKeys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -50,6 +76,7 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Token // The closing ')'
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -89,9 +116,29 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// For field access and method lookup like p.x
+type MemberExpression struct {
+	Token    token.Token // '.'
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Property.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token // '['
 	Elements []Expression
+	Rbracket token.Token // The closing ']'
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
@@ -111,8 +158,12 @@ func (al *ArrayLiteral) String() string {
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	Rparen     token.Token // The ')' closing the parameters
 	Body       *BlockStatement
 	Name       string
+	Generator  bool // Declared with fn*, calling it returns an iterator
+	ReturnType *TypeAnnotation
+	Slots      int // Set by the evaluator's resolver: the size of its environment
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -126,18 +177,104 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.TokenLiteral())
-	if fl.Name != " "{
+	if fl.Generator {
+		out.WriteString("*")
+	}
+	if fl.Name != " " {
 		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
 	}
 	out.WriteString("(")
 	out.WriteString(" ")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if fl.ReturnType != nil {
+		out.WriteString("-> " + fl.ReturnType.String() + " ")
+	}
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+type YieldExpression struct {
+	Token token.Token // 'yield'
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	return ye.TokenLiteral() + " " + ye.Value.String()
+}
+
+// SpawnExpression runs Function(Arguments...) concurrently and evaluates to
+// a channel that receives the call's result.
+type SpawnExpression struct {
+	Token     token.Token // 'spawn'
+	Function  Expression
+	Arguments []Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	args := []string{se.Function.String()}
+	for _, a := range se.Arguments {
+		args = append(args, a.String())
+	}
+
+	return se.TokenLiteral() + "(" + strings.Join(args, ", ") + ")"
+}
+
+// SelectCase is one arm of a select: either 'case name = recv(ch)' or
+// 'case send(ch, value)'. Name is nil when a received value is discarded.
+type SelectCase struct {
+	Token   token.Token // 'case'
+	Send    bool
+	Name    *Identifier
+	Channel Expression
+	Value   Expression
+	Body    *BlockStatement
+}
+
+func (sc *SelectCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SelectCase) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("case ")
+	if sc.Send {
+		out.WriteString("send(" + sc.Channel.String() + ", " + sc.Value.String() + ")")
+	} else {
+		if sc.Name != nil {
+			out.WriteString(sc.Name.String() + " = ")
+		}
+		out.WriteString("recv(" + sc.Channel.String() + ")")
+	}
+	out.WriteString(" { " + sc.Body.String() + " }")
+
+	return out.String()
+}
+
+type SelectExpression struct {
+	Token   token.Token // 'select'
+	Cases   []*SelectCase
+	Default *BlockStatement
+	Rbrace  token.Token // The closing '}'
+}
+
+func (se *SelectExpression) expressionNode()      {}
+func (se *SelectExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SelectExpression) String() string {
+	cases := []string{}
+	for _, c := range se.Cases {
+		cases = append(cases, c.String())
+	}
+	if se.Default != nil {
+		cases = append(cases, "default { "+se.Default.String()+" }")
+	}
+
+	return "select { " + strings.Join(cases, " ") + " }"
+}
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -166,6 +303,7 @@ func (i *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Token // The closing '}'
 }
 
 func (bs *BlockStatement) statementNode()       {}
@@ -192,11 +330,39 @@ func (b *Boolean) String() string       { return b.Token.Literal }
 type Identifier struct {
 	Token token.Token
 	Value string
+	Type  *TypeAnnotation // Optional, only on let names and parameters
+
+	// Set by the evaluator's resolver: the variable lives Depth environments
+	// out from the one the identifier is evaluated in, at index Slot. Names
+	// of builtins have a Depth of -1.
+	Depth int
+	Slot  int
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
-func (i *Identifier) String() string       { return i.Value }
+func (i *Identifier) String() string {
+	if i.Type != nil {
+		return i.Value + ": " + i.Type.String()
+	}
+	return i.Value
+}
+
+// TypeAnnotation is a type written in the source, like 'int', 'Point' or
+// '[string]'. Element is set only for the bracketed array form.
+type TypeAnnotation struct {
+	Token   token.Token
+	Name    string
+	Element *TypeAnnotation
+}
+
+func (ta *TypeAnnotation) TokenLiteral() string { return ta.Token.Literal }
+func (ta *TypeAnnotation) String() string {
+	if ta.Element != nil {
+		return "[" + ta.Element.String() + "]"
+	}
+	return ta.Name
+}
 
 type IntegerLiteral struct {
 	Token token.Token
@@ -284,6 +450,138 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type StructStatement struct {
+	Token  token.Token // 'struct'
+	Name   *Identifier // Point in 'struct Point { x, y }'
+	Fields []*Identifier
+	Rbrace token.Token // The closing '}'
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) String() string {
+	var out bytes.Buffer
+
+	fields := []string{}
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+
+	out.WriteString(ss.TokenLiteral() + " ")
+	out.WriteString(ss.Name.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// EnumStatement declares a tagged union: 'enum Shape { Circle(r), Empty }'
+type EnumStatement struct {
+	Token    token.Token // 'enum'
+	Name     *Identifier
+	Variants []*EnumVariant
+	Rbrace   token.Token // The closing '}'
+}
+
+// EnumVariant is one alternative of an enum. Fields is empty for variants
+// like Empty that carry no values.
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ev *EnumVariant) TokenLiteral() string { return ev.Name.TokenLiteral() }
+func (ev *EnumVariant) String() string {
+	if len(ev.Fields) == 0 {
+		return ev.Name.String()
+	}
+
+	fields := []string{}
+	for _, f := range ev.Fields {
+		fields = append(fields, f.String())
+	}
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+	for _, v := range es.Variants {
+		variants = append(variants, v.String())
+	}
+	return "enum " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// MatchArm runs Body when the subject is the variant named by Pattern,
+// binding its values to Bindings in order. Pattern is either 'Circle' or
+// 'Shape.Circle'. Without bindings the arm matches on the tag alone.
+type MatchArm struct {
+	Token    token.Token
+	Pattern  string
+	Bindings []*Identifier
+	Body     *BlockStatement
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) String() string {
+	pattern := ma.Pattern
+	if len(ma.Bindings) > 0 {
+		bindings := []string{}
+		for _, b := range ma.Bindings {
+			bindings = append(bindings, b.String())
+		}
+		pattern += "(" + strings.Join(bindings, ", ") + ")"
+	}
+	return pattern + " { " + ma.Body.String() + " }"
+}
+
+type MatchExpression struct {
+	Token   token.Token // 'match'
+	Subject Expression
+	Arms    []*MatchArm
+	Default *BlockStatement
+	Rbrace  token.Token // The closing '}'
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	arms := []string{}
+	for _, a := range me.Arms {
+		arms = append(arms, a.String())
+	}
+	if me.Default != nil {
+		arms = append(arms, "default { "+me.Default.String()+" }")
+	}
+	return "match (" + me.Subject.String() + ") { " + strings.Join(arms, " ") + " }"
+}
+
+type ImplStatement struct {
+	Token   token.Token // 'impl'
+	Name    *Identifier // The struct the methods are bound to
+	Methods []*FunctionLiteral
+	Rbrace  token.Token // The closing '}'
+}
+
+func (is *ImplStatement) statementNode()       {}
+func (is *ImplStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImplStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString(is.Name.String())
+	out.WriteString(" { ")
+	for _, m := range is.Methods {
+		out.WriteString(m.String())
+		out.WriteString(" ")
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
 type InfixExpression struct {
 	Token    token.Token // Operator token like '+' in a + b
 	Left     Expression
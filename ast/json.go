@@ -0,0 +1,591 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"monkey/token"
+)
+
+// Nodes encode to JSON objects of the form
+//
+//	{"kind": "InfixExpression", "line": 1, "column": 3,
+//	 "token": {"type": "+", "literal": "+"},
+//	 "left": {...}, "operator": "+", "right": {...}}
+//
+// where kind is the name of the Go type, line and column locate the node's
+// token (they are 0 for a Program) and the remaining fields hold the node's
+// children and values under their lowerCamelCase field names. Absent
+// optional children are null. A Program also lists its comments as
+// {"line": 1, "column": 8, "text": "# note"}.
+
+type jsonObject map[string]interface{}
+
+type jsonComment struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text"`
+}
+
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+}
+
+func encodeNode(node Node) interface{} {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return nil
+	}
+
+	var tok token.Token
+	fields := jsonObject{}
+
+	switch n := node.(type) {
+	case *Program:
+		fields["statements"] = encodeStatements(n.Statements)
+		comments := []interface{}{}
+		for _, c := range n.Comments {
+			comments = append(comments, jsonComment{Line: c.Token.Line, Column: c.Token.Column, Text: c.Token.Literal})
+		}
+		fields["comments"] = comments
+	case *LetStatement:
+		tok = n.Token
+		fields["name"] = encodeNode(n.Name)
+		fields["value"] = encodeExpression(n.Value)
+	case *ReturnStatement:
+		tok = n.Token
+		fields["value"] = encodeExpression(n.Value)
+	case *ExpressionStatement:
+		tok = n.Token
+		fields["expression"] = encodeExpression(n.Expression)
+	case *BlockStatement:
+		tok = n.Token
+		fields["statements"] = encodeStatements(n.Statements)
+	case *StructStatement:
+		tok = n.Token
+		fields["name"] = encodeNode(n.Name)
+		fields["fields"] = encodeIdentifiers(n.Fields)
+	case *ImplStatement:
+		tok = n.Token
+		fields["name"] = encodeNode(n.Name)
+		methods := []interface{}{}
+		for _, m := range n.Methods {
+			methods = append(methods, encodeNode(m))
+		}
+		fields["methods"] = methods
+	case *EnumStatement:
+		tok = n.Token
+		fields["name"] = encodeNode(n.Name)
+		variants := []interface{}{}
+		for _, v := range n.Variants {
+			variants = append(variants, encodeNode(v))
+		}
+		fields["variants"] = variants
+	case *EnumVariant:
+		tok = n.Name.Token
+		fields["name"] = encodeNode(n.Name)
+		fields["fields"] = encodeIdentifiers(n.Fields)
+	case *Identifier:
+		tok = n.Token
+		fields["value"] = n.Value
+		fields["type"] = encodeNode(n.Type)
+	case *TypeAnnotation:
+		tok = n.Token
+		fields["name"] = n.Name
+		fields["element"] = encodeNode(n.Element)
+	case *IntegerLiteral:
+		tok = n.Token
+		fields["value"] = n.Value
+	case *StringLiteral:
+		tok = n.Token
+		fields["value"] = n.Value
+	case *Boolean:
+		tok = n.Token
+		fields["value"] = n.Value
+	case *PrefixExpression:
+		tok = n.Token
+		fields["operator"] = n.Operator
+		fields["right"] = encodeExpression(n.Right)
+	case *InfixExpression:
+		tok = n.Token
+		fields["left"] = encodeExpression(n.Left)
+		fields["operator"] = n.Operator
+		fields["right"] = encodeExpression(n.Right)
+	case *IfExpression:
+		tok = n.Token
+		fields["condition"] = encodeExpression(n.Condition)
+		fields["consequence"] = encodeNode(n.Consequence)
+		fields["alternative"] = encodeNode(n.Alternative)
+	case *FunctionLiteral:
+		tok = n.Token
+		fields["name"] = n.Name
+		fields["generator"] = n.Generator
+		fields["parameters"] = encodeIdentifiers(n.Parameters)
+		fields["returnType"] = encodeNode(n.ReturnType)
+		fields["body"] = encodeNode(n.Body)
+	case *CallExpression:
+		tok = n.Token
+		fields["function"] = encodeExpression(n.Function)
+		fields["arguments"] = encodeExpressions(n.Arguments)
+	case *ArrayLiteral:
+		tok = n.Token
+		fields["elements"] = encodeExpressions(n.Elements)
+	case *HashLiteral:
+		tok = n.Token
+		pairs := []interface{}{}
+		for _, key := range n.OrderedKeys() {
+			pairs = append(pairs, jsonObject{
+				"key":   encodeExpression(key),
+				"value": encodeExpression(n.Pairs[key]),
+			})
+		}
+		fields["pairs"] = pairs
+	case *IndexExpression:
+		tok = n.Token
+		fields["left"] = encodeExpression(n.Left)
+		fields["index"] = encodeExpression(n.Index)
+	case *MemberExpression:
+		tok = n.Token
+		fields["object"] = encodeExpression(n.Object)
+		fields["property"] = encodeNode(n.Property)
+	case *YieldExpression:
+		tok = n.Token
+		fields["value"] = encodeExpression(n.Value)
+	case *SpawnExpression:
+		tok = n.Token
+		fields["function"] = encodeExpression(n.Function)
+		fields["arguments"] = encodeExpressions(n.Arguments)
+	case *SelectExpression:
+		tok = n.Token
+		cases := []interface{}{}
+		for _, c := range n.Cases {
+			cases = append(cases, encodeNode(c))
+		}
+		fields["cases"] = cases
+		fields["default"] = encodeNode(n.Default)
+	case *SelectCase:
+		tok = n.Token
+		fields["send"] = n.Send
+		fields["name"] = encodeNode(n.Name)
+		fields["channel"] = encodeExpression(n.Channel)
+		fields["value"] = encodeExpression(n.Value)
+		fields["body"] = encodeNode(n.Body)
+	case *MatchExpression:
+		tok = n.Token
+		fields["subject"] = encodeExpression(n.Subject)
+		arms := []interface{}{}
+		for _, a := range n.Arms {
+			arms = append(arms, encodeNode(a))
+		}
+		fields["arms"] = arms
+		fields["default"] = encodeNode(n.Default)
+	case *MatchArm:
+		tok = n.Token
+		fields["pattern"] = n.Pattern
+		fields["bindings"] = encodeIdentifiers(n.Bindings)
+		fields["body"] = encodeNode(n.Body)
+	default:
+		panic(fmt.Sprintf("ast: cannot encode node type %T", n))
+	}
+
+	fields["kind"] = reflect.TypeOf(node).Elem().Name()
+	fields["line"] = tok.Line
+	fields["column"] = tok.Column
+	fields["token"] = jsonToken{Type: tok.Type, Literal: tok.Literal}
+
+	return fields
+}
+
+func encodeExpression(e Expression) interface{} {
+	if e == nil {
+		return nil
+	}
+	return encodeNode(e)
+}
+
+func encodeExpressions(list []Expression) []interface{} {
+	encoded := []interface{}{}
+	for _, e := range list {
+		encoded = append(encoded, encodeExpression(e))
+	}
+	return encoded
+}
+
+func encodeStatements(list []Statement) []interface{} {
+	encoded := []interface{}{}
+	for _, s := range list {
+		encoded = append(encoded, encodeNode(s))
+	}
+	return encoded
+}
+
+func encodeIdentifiers(list []*Identifier) []interface{} {
+	encoded := []interface{}{}
+	for _, i := range list {
+		encoded = append(encoded, encodeNode(i))
+	}
+	return encoded
+}
+
+// DecodeJSON reads back a node of any kind written by MarshalJSON.
+func DecodeJSON(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.node(data)
+	return node, d.err
+}
+
+// decoder keeps the first error it runs into, so that decoding a node reads
+// as a list of its fields.
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("ast: "+format, args...)
+	}
+}
+
+func (d *decoder) unmarshal(data []byte, v interface{}) {
+	if len(data) == 0 {
+		return
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		d.fail("%s", err)
+	}
+}
+
+func (d *decoder) node(data []byte) Node {
+	if d.err != nil || len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	d.unmarshal(data, &fields)
+
+	var kind string
+	var line, column int
+	var tok jsonToken
+	d.unmarshal(fields["kind"], &kind)
+	d.unmarshal(fields["line"], &line)
+	d.unmarshal(fields["column"], &column)
+	d.unmarshal(fields["token"], &tok)
+	if d.err != nil {
+		return nil
+	}
+
+	t := token.Token{Type: tok.Type, Literal: tok.Literal, Line: line, Column: column}
+
+	switch kind {
+	case "Program":
+		program := &Program{Statements: d.statements(fields["statements"])}
+		var comments []jsonComment
+		d.unmarshal(fields["comments"], &comments)
+		for _, c := range comments {
+			t := token.Token{Type: token.COMMENT, Literal: c.Text, Line: c.Line, Column: c.Column}
+			program.Comments = append(program.Comments, &Comment{Token: t})
+		}
+		return program
+	case "LetStatement":
+		return &LetStatement{Token: t, Name: d.identifier(fields["name"]), Value: d.expression(fields["value"])}
+	case "ReturnStatement":
+		return &ReturnStatement{Token: t, Value: d.expression(fields["value"])}
+	case "ExpressionStatement":
+		return &ExpressionStatement{Token: t, Expression: d.expression(fields["expression"])}
+	case "BlockStatement":
+		return &BlockStatement{Token: t, Statements: d.statements(fields["statements"])}
+	case "StructStatement":
+		return &StructStatement{Token: t, Name: d.identifier(fields["name"]), Fields: d.identifiers(fields["fields"])}
+	case "ImplStatement":
+		impl := &ImplStatement{Token: t, Name: d.identifier(fields["name"])}
+		for _, raw := range d.list(fields["methods"]) {
+			if m, ok := d.node(raw).(*FunctionLiteral); ok {
+				impl.Methods = append(impl.Methods, m)
+			} else {
+				d.fail("impl method is not a FunctionLiteral")
+			}
+		}
+		return impl
+	case "EnumStatement":
+		enum := &EnumStatement{Token: t, Name: d.identifier(fields["name"])}
+		for _, raw := range d.list(fields["variants"]) {
+			if v, ok := d.node(raw).(*EnumVariant); ok {
+				enum.Variants = append(enum.Variants, v)
+			} else {
+				d.fail("enum variant is not an EnumVariant")
+			}
+		}
+		return enum
+	case "EnumVariant":
+		return &EnumVariant{Name: d.identifier(fields["name"]), Fields: d.identifiers(fields["fields"])}
+	case "Identifier":
+		ident := &Identifier{Token: t, Type: d.typeAnnotation(fields["type"])}
+		d.unmarshal(fields["value"], &ident.Value)
+		return ident
+	case "TypeAnnotation":
+		annotation := &TypeAnnotation{Token: t, Element: d.typeAnnotation(fields["element"])}
+		d.unmarshal(fields["name"], &annotation.Name)
+		return annotation
+	case "IntegerLiteral":
+		integer := &IntegerLiteral{Token: t}
+		d.unmarshal(fields["value"], &integer.Value)
+		return integer
+	case "StringLiteral":
+		str := &StringLiteral{Token: t}
+		d.unmarshal(fields["value"], &str.Value)
+		return str
+	case "Boolean":
+		boolean := &Boolean{Token: t}
+		d.unmarshal(fields["value"], &boolean.Value)
+		return boolean
+	case "PrefixExpression":
+		prefix := &PrefixExpression{Token: t, Right: d.expression(fields["right"])}
+		d.unmarshal(fields["operator"], &prefix.Operator)
+		return prefix
+	case "InfixExpression":
+		infix := &InfixExpression{Token: t, Left: d.expression(fields["left"]), Right: d.expression(fields["right"])}
+		d.unmarshal(fields["operator"], &infix.Operator)
+		return infix
+	case "IfExpression":
+		return &IfExpression{
+			Token:       t,
+			Condition:   d.expression(fields["condition"]),
+			Consequence: d.block(fields["consequence"]),
+			Alternative: d.block(fields["alternative"]),
+		}
+	case "FunctionLiteral":
+		function := &FunctionLiteral{
+			Token:      t,
+			Parameters: d.identifiers(fields["parameters"]),
+			ReturnType: d.typeAnnotation(fields["returnType"]),
+			Body:       d.block(fields["body"]),
+		}
+		d.unmarshal(fields["name"], &function.Name)
+		d.unmarshal(fields["generator"], &function.Generator)
+		return function
+	case "CallExpression":
+		return &CallExpression{Token: t, Function: d.expression(fields["function"]), Arguments: d.expressions(fields["arguments"])}
+	case "ArrayLiteral":
+		return &ArrayLiteral{Token: t, Elements: d.expressions(fields["elements"])}
+	case "HashLiteral":
+		hash := &HashLiteral{Token: t, Pairs: map[Expression]Expression{}}
+		for _, raw := range d.list(fields["pairs"]) {
+			var pair map[string]json.RawMessage
+			d.unmarshal(raw, &pair)
+			key := d.expression(pair["key"])
+			hash.Pairs[key] = d.expression(pair["value"])
+			hash.Keys = append(hash.Keys, key)
+		}
+		return hash
+	case "IndexExpression":
+		return &IndexExpression{Token: t, Left: d.expression(fields["left"]), Index: d.expression(fields["index"])}
+	case "MemberExpression":
+		return &MemberExpression{Token: t, Object: d.expression(fields["object"]), Property: d.identifier(fields["property"])}
+	case "YieldExpression":
+		return &YieldExpression{Token: t, Value: d.expression(fields["value"])}
+	case "SpawnExpression":
+		return &SpawnExpression{Token: t, Function: d.expression(fields["function"]), Arguments: d.expressions(fields["arguments"])}
+	case "SelectExpression":
+		sel := &SelectExpression{Token: t, Default: d.block(fields["default"])}
+		for _, raw := range d.list(fields["cases"]) {
+			if c, ok := d.node(raw).(*SelectCase); ok {
+				sel.Cases = append(sel.Cases, c)
+			} else {
+				d.fail("select case is not a SelectCase")
+			}
+		}
+		return sel
+	case "SelectCase":
+		c := &SelectCase{
+			Token:   t,
+			Name:    d.identifier(fields["name"]),
+			Channel: d.expression(fields["channel"]),
+			Value:   d.expression(fields["value"]),
+			Body:    d.block(fields["body"]),
+		}
+		d.unmarshal(fields["send"], &c.Send)
+		return c
+	case "MatchExpression":
+		match := &MatchExpression{Token: t, Subject: d.expression(fields["subject"]), Default: d.block(fields["default"])}
+		for _, raw := range d.list(fields["arms"]) {
+			if a, ok := d.node(raw).(*MatchArm); ok {
+				match.Arms = append(match.Arms, a)
+			} else {
+				d.fail("match arm is not a MatchArm")
+			}
+		}
+		return match
+	case "MatchArm":
+		arm := &MatchArm{Token: t, Bindings: d.identifiers(fields["bindings"]), Body: d.block(fields["body"])}
+		d.unmarshal(fields["pattern"], &arm.Pattern)
+		return arm
+	default:
+		d.fail("unknown node kind %q", kind)
+		return nil
+	}
+}
+
+func (d *decoder) list(data []byte) []json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	var list []json.RawMessage
+	d.unmarshal(data, &list)
+	return list
+}
+
+func (d *decoder) expression(data []byte) Expression {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+	e, ok := node.(Expression)
+	if !ok {
+		d.fail("%T is not an expression", node)
+	}
+	return e
+}
+
+func (d *decoder) expressions(data []byte) []Expression {
+	var list []Expression
+	for _, raw := range d.list(data) {
+		list = append(list, d.expression(raw))
+	}
+	return list
+}
+
+func (d *decoder) statements(data []byte) []Statement {
+	list := []Statement{}
+	for _, raw := range d.list(data) {
+		s, ok := d.node(raw).(Statement)
+		if !ok {
+			d.fail("expected a statement")
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+func (d *decoder) identifier(data []byte) *Identifier {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+	i, ok := node.(*Identifier)
+	if !ok {
+		d.fail("%T is not an identifier", node)
+	}
+	return i
+}
+
+func (d *decoder) identifiers(data []byte) []*Identifier {
+	var list []*Identifier
+	for _, raw := range d.list(data) {
+		list = append(list, d.identifier(raw))
+	}
+	return list
+}
+
+func (d *decoder) block(data []byte) *BlockStatement {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+	b, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("%T is not a block", node)
+	}
+	return b
+}
+
+func (d *decoder) typeAnnotation(data []byte) *TypeAnnotation {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+	t, ok := node.(*TypeAnnotation)
+	if !ok {
+		d.fail("%T is not a type annotation", node)
+	}
+	return t
+}
+
+func marshalNode(node Node) ([]byte, error) {
+	return json.Marshal(encodeNode(node))
+}
+
+// unmarshalNode decodes data into target, which must be a node of the same
+// kind.
+func unmarshalNode(data []byte, target Node) error {
+	node, err := DecodeJSON(data)
+	if err != nil {
+		return err
+	}
+	if reflect.TypeOf(node) != reflect.TypeOf(target) {
+		return fmt.Errorf("ast: cannot decode %T into %T", node, target)
+	}
+	reflect.ValueOf(target).Elem().Set(reflect.ValueOf(node).Elem())
+	return nil
+}
+
+func (p *Program) MarshalJSON() ([]byte, error)              { return marshalNode(p) }
+func (p *Program) UnmarshalJSON(data []byte) error           { return unmarshalNode(data, p) }
+func (ls *LetStatement) MarshalJSON() ([]byte, error)        { return marshalNode(ls) }
+func (ls *LetStatement) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, ls) }
+func (rs *ReturnStatement) MarshalJSON() ([]byte, error)     { return marshalNode(rs) }
+func (rs *ReturnStatement) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, rs) }
+func (es *ExpressionStatement) MarshalJSON() ([]byte, error) { return marshalNode(es) }
+func (es *ExpressionStatement) UnmarshalJSON(data []byte) error {
+	return unmarshalNode(data, es)
+}
+func (bs *BlockStatement) MarshalJSON() ([]byte, error)      { return marshalNode(bs) }
+func (bs *BlockStatement) UnmarshalJSON(data []byte) error   { return unmarshalNode(data, bs) }
+func (ss *StructStatement) MarshalJSON() ([]byte, error)     { return marshalNode(ss) }
+func (ss *StructStatement) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, ss) }
+func (is *ImplStatement) MarshalJSON() ([]byte, error)       { return marshalNode(is) }
+func (is *ImplStatement) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, is) }
+func (es *EnumStatement) MarshalJSON() ([]byte, error)       { return marshalNode(es) }
+func (es *EnumStatement) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, es) }
+func (ev *EnumVariant) MarshalJSON() ([]byte, error)         { return marshalNode(ev) }
+func (ev *EnumVariant) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, ev) }
+func (i *Identifier) MarshalJSON() ([]byte, error)           { return marshalNode(i) }
+func (i *Identifier) UnmarshalJSON(data []byte) error        { return unmarshalNode(data, i) }
+func (ta *TypeAnnotation) MarshalJSON() ([]byte, error)      { return marshalNode(ta) }
+func (ta *TypeAnnotation) UnmarshalJSON(data []byte) error   { return unmarshalNode(data, ta) }
+func (i *IntegerLiteral) MarshalJSON() ([]byte, error)       { return marshalNode(i) }
+func (i *IntegerLiteral) UnmarshalJSON(data []byte) error    { return unmarshalNode(data, i) }
+func (s *StringLiteral) MarshalJSON() ([]byte, error)        { return marshalNode(s) }
+func (s *StringLiteral) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, s) }
+func (b *Boolean) MarshalJSON() ([]byte, error)              { return marshalNode(b) }
+func (b *Boolean) UnmarshalJSON(data []byte) error           { return unmarshalNode(data, b) }
+func (pe *PrefixExpression) MarshalJSON() ([]byte, error)    { return marshalNode(pe) }
+func (pe *PrefixExpression) UnmarshalJSON(data []byte) error { return unmarshalNode(data, pe) }
+func (ie *InfixExpression) MarshalJSON() ([]byte, error)     { return marshalNode(ie) }
+func (ie *InfixExpression) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, ie) }
+func (i *IfExpression) MarshalJSON() ([]byte, error)         { return marshalNode(i) }
+func (i *IfExpression) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, i) }
+func (fl *FunctionLiteral) MarshalJSON() ([]byte, error)     { return marshalNode(fl) }
+func (fl *FunctionLiteral) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, fl) }
+func (ce *CallExpression) MarshalJSON() ([]byte, error)      { return marshalNode(ce) }
+func (ce *CallExpression) UnmarshalJSON(data []byte) error   { return unmarshalNode(data, ce) }
+func (al *ArrayLiteral) MarshalJSON() ([]byte, error)        { return marshalNode(al) }
+func (al *ArrayLiteral) UnmarshalJSON(data []byte) error     { return unmarshalNode(data, al) }
+func (hl *HashLiteral) MarshalJSON() ([]byte, error)         { return marshalNode(hl) }
+func (hl *HashLiteral) UnmarshalJSON(data []byte) error      { return unmarshalNode(data, hl) }
+func (ie *IndexExpression) MarshalJSON() ([]byte, error)     { return marshalNode(ie) }
+func (ie *IndexExpression) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, ie) }
+func (me *MemberExpression) MarshalJSON() ([]byte, error)    { return marshalNode(me) }
+func (me *MemberExpression) UnmarshalJSON(data []byte) error { return unmarshalNode(data, me) }
+func (ye *YieldExpression) MarshalJSON() ([]byte, error)     { return marshalNode(ye) }
+func (ye *YieldExpression) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, ye) }
+func (se *SpawnExpression) MarshalJSON() ([]byte, error)     { return marshalNode(se) }
+func (se *SpawnExpression) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, se) }
+func (se *SelectExpression) MarshalJSON() ([]byte, error)    { return marshalNode(se) }
+func (se *SelectExpression) UnmarshalJSON(data []byte) error { return unmarshalNode(data, se) }
+func (sc *SelectCase) MarshalJSON() ([]byte, error)          { return marshalNode(sc) }
+func (sc *SelectCase) UnmarshalJSON(data []byte) error       { return unmarshalNode(data, sc) }
+func (me *MatchExpression) MarshalJSON() ([]byte, error)     { return marshalNode(me) }
+func (me *MatchExpression) UnmarshalJSON(data []byte) error  { return unmarshalNode(data, me) }
+func (ma *MatchArm) MarshalJSON() ([]byte, error)            { return marshalNode(ma) }
+func (ma *MatchArm) UnmarshalJSON(data []byte) error         { return unmarshalNode(data, ma) }
@@ -0,0 +1,84 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"monkey/ast"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	program := parse(t, everyNode+"# the end\n")
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	for _, name := range nodeTypes(t) {
+		if name != "Program" && !strings.Contains(string(data), `"kind":"`+name+`"`) {
+			t.Errorf("%s is missing from the JSON: add it to encodeNode, the decoder and the everyNode program", name)
+		}
+	}
+
+	decoded := &ast.Program{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if len(decoded.Comments) != 1 || decoded.Comments[0].Token.Literal != "# the end" {
+		t.Errorf("round trip lost the comment, got %v", decoded.Comments)
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("round trip changed the program.\nwant %s\ngot  %s", program.String(), decoded.String())
+	}
+
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("round trip changed the JSON")
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := json.Marshal(parse(t, `-a`))
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	expected := `{"column":0,"comments":[],"kind":"Program","line":0,"statements":[` +
+		`{"column":1,"expression":` +
+		`{"column":1,"kind":"PrefixExpression","line":1,"operator":"-","right":` +
+		`{"column":2,"kind":"Identifier","line":1,"token":{"type":"IDENT","literal":"a"},"type":null,"value":"a"},` +
+		`"token":{"type":"-","literal":"-"}},` +
+		`"kind":"ExpressionStatement","line":1,"token":{"type":"-","literal":"-"}}],` +
+		`"token":{"type":"","literal":""}}`
+
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nwant %s\ngot  %s", expected, data)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Nope"}`, `ast: unknown node kind "Nope"`},
+		{`{"kind":"Program","statements":[{"kind":"IntegerLiteral","value":1}]}`, `ast: expected a statement`},
+		{`{"kind":"LetStatement","name":{"kind":"Boolean","value":true}}`, `ast: *ast.Boolean is not an identifier`},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"kind":"Boolean","value":true}`), &ast.Identifier{}); err == nil {
+		t.Errorf("expected decoding a Boolean into an Identifier to fail")
+	}
+}
@@ -0,0 +1,398 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called for each node Walk finds. If it
+// returns a non-nil Visitor w, Walk visits the children of node with w and
+// then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth-first, in source order.
+// Optional children that are absent, like a missing else branch, are not
+// visited.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+
+	case *LetStatement:
+		Walk(v, n.Name)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *ReturnStatement:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+
+	case *StructStatement:
+		Walk(v, n.Name)
+		walkIdentifiers(v, n.Fields)
+
+	case *ImplStatement:
+		Walk(v, n.Name)
+		for _, m := range n.Methods {
+			Walk(v, m)
+		}
+
+	case *EnumStatement:
+		Walk(v, n.Name)
+		for _, variant := range n.Variants {
+			Walk(v, variant)
+		}
+
+	case *EnumVariant:
+		Walk(v, n.Name)
+		walkIdentifiers(v, n.Fields)
+
+	case *Identifier:
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+
+	case *TypeAnnotation:
+		if n.Element != nil {
+			Walk(v, n.Element)
+		}
+
+	case *IntegerLiteral, *StringLiteral, *Boolean:
+		// No children
+
+	case *PrefixExpression:
+		Walk(v, n.Right)
+
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+
+	case *FunctionLiteral:
+		walkIdentifiers(v, n.Parameters)
+		if n.ReturnType != nil {
+			Walk(v, n.ReturnType)
+		}
+		Walk(v, n.Body)
+
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+
+	case *HashLiteral:
+		for _, key := range n.OrderedKeys() {
+			Walk(v, key)
+			Walk(v, n.Pairs[key])
+		}
+
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+
+	case *MemberExpression:
+		Walk(v, n.Object)
+		Walk(v, n.Property)
+
+	case *YieldExpression:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *SpawnExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+
+	case *SelectExpression:
+		for _, c := range n.Cases {
+			Walk(v, c)
+		}
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *SelectCase:
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+		Walk(v, n.Channel)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+		Walk(v, n.Body)
+
+	case *MatchExpression:
+		Walk(v, n.Subject)
+		for _, arm := range n.Arms {
+			Walk(v, arm)
+		}
+		if n.Default != nil {
+			Walk(v, n.Default)
+		}
+
+	case *MatchArm:
+		walkIdentifiers(v, n.Bindings)
+		Walk(v, n.Body)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkIdentifiers(v Visitor, list []*Identifier) {
+	for _, i := range list {
+		Walk(v, i)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		Walk(v, e)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in the same order as Walk,
+// calling f for each node. If f returns false the children of that node are
+// skipped. After the children of a node f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// ModifierFunc returns the node to put in place of the node it is given,
+// which may be that node itself.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the tree rooted at node bottom-up: the children of a node
+// are modified in place before modifier is called on the node itself. A
+// replacement that cannot take the place of the original, like a statement
+// where an identifier belongs, is ignored.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	case *Program:
+		modifyStatements(n.Statements, modifier)
+
+	case *LetStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+
+	case *ReturnStatement:
+		n.Value = modifyExpression(n.Value, modifier)
+
+	case *ExpressionStatement:
+		n.Expression = modifyExpression(n.Expression, modifier)
+
+	case *BlockStatement:
+		modifyStatements(n.Statements, modifier)
+
+	case *StructStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		modifyIdentifiers(n.Fields, modifier)
+
+	case *ImplStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		for i, m := range n.Methods {
+			if m, ok := Modify(m, modifier).(*FunctionLiteral); ok {
+				n.Methods[i] = m
+			}
+		}
+
+	case *EnumStatement:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		for i, variant := range n.Variants {
+			if variant, ok := Modify(variant, modifier).(*EnumVariant); ok {
+				n.Variants[i] = variant
+			}
+		}
+
+	case *EnumVariant:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		modifyIdentifiers(n.Fields, modifier)
+
+	case *Identifier:
+		n.Type = modifyType(n.Type, modifier)
+
+	case *TypeAnnotation:
+		n.Element = modifyType(n.Element, modifier)
+
+	case *IntegerLiteral, *StringLiteral, *Boolean:
+		// No children
+
+	case *PrefixExpression:
+		n.Right = modifyExpression(n.Right, modifier)
+
+	case *InfixExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Right = modifyExpression(n.Right, modifier)
+
+	case *IfExpression:
+		n.Condition = modifyExpression(n.Condition, modifier)
+		n.Consequence = modifyBlock(n.Consequence, modifier)
+		n.Alternative = modifyBlock(n.Alternative, modifier)
+
+	case *FunctionLiteral:
+		modifyIdentifiers(n.Parameters, modifier)
+		n.ReturnType = modifyType(n.ReturnType, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *CallExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+
+	case *HashLiteral:
+		keys := n.OrderedKeys()
+		pairs := make(map[Expression]Expression, len(keys))
+		for i, key := range keys {
+			value := n.Pairs[key]
+			keys[i] = modifyExpression(key, modifier)
+			pairs[keys[i]] = modifyExpression(value, modifier)
+		}
+		n.Pairs = pairs
+		n.Keys = keys
+
+	case *IndexExpression:
+		n.Left = modifyExpression(n.Left, modifier)
+		n.Index = modifyExpression(n.Index, modifier)
+
+	case *MemberExpression:
+		n.Object = modifyExpression(n.Object, modifier)
+		n.Property = modifyIdentifier(n.Property, modifier)
+
+	case *YieldExpression:
+		n.Value = modifyExpression(n.Value, modifier)
+
+	case *SpawnExpression:
+		n.Function = modifyExpression(n.Function, modifier)
+		modifyExpressions(n.Arguments, modifier)
+
+	case *SelectExpression:
+		for i, c := range n.Cases {
+			if c, ok := Modify(c, modifier).(*SelectCase); ok {
+				n.Cases[i] = c
+			}
+		}
+		n.Default = modifyBlock(n.Default, modifier)
+
+	case *SelectCase:
+		n.Name = modifyIdentifier(n.Name, modifier)
+		n.Channel = modifyExpression(n.Channel, modifier)
+		n.Value = modifyExpression(n.Value, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	case *MatchExpression:
+		n.Subject = modifyExpression(n.Subject, modifier)
+		for i, arm := range n.Arms {
+			if arm, ok := Modify(arm, modifier).(*MatchArm); ok {
+				n.Arms[i] = arm
+			}
+		}
+		n.Default = modifyBlock(n.Default, modifier)
+
+	case *MatchArm:
+		modifyIdentifiers(n.Bindings, modifier)
+		n.Body = modifyBlock(n.Body, modifier)
+
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", n))
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(list []Statement, modifier ModifierFunc) {
+	for i, s := range list {
+		if s, ok := Modify(s, modifier).(Statement); ok {
+			list[i] = s
+		}
+	}
+}
+
+func modifyExpressions(list []Expression, modifier ModifierFunc) {
+	for i, e := range list {
+		list[i] = modifyExpression(e, modifier)
+	}
+}
+
+func modifyIdentifiers(list []*Identifier, modifier ModifierFunc) {
+	for i, ident := range list {
+		list[i] = modifyIdentifier(ident, modifier)
+	}
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+	if modified, ok := Modify(e, modifier).(Expression); ok {
+		return modified
+	}
+	return e
+}
+
+func modifyIdentifier(i *Identifier, modifier ModifierFunc) *Identifier {
+	if i == nil {
+		return nil
+	}
+	if modified, ok := Modify(i, modifier).(*Identifier); ok {
+		return modified
+	}
+	return i
+}
+
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	if modified, ok := Modify(b, modifier).(*BlockStatement); ok {
+		return modified
+	}
+	return b
+}
+
+func modifyType(t *TypeAnnotation, modifier ModifierFunc) *TypeAnnotation {
+	if t == nil {
+		return nil
+	}
+	if modified, ok := Modify(t, modifier).(*TypeAnnotation); ok {
+		return modified
+	}
+	return t
+}
@@ -0,0 +1,205 @@
+package ast_test
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+// everyNode uses every construct of the language, so walking it must reach
+// every node type declared in ast.go.
+const everyNode = `
+let x: [int] = [1, 2];
+let h = {"a": 1, true: x[0]};
+struct Point { x, y }
+impl Point { fn norm(self) { self.x * self.x + self.y * self.y } }
+enum Shape { Circle(r), Empty }
+let f = fn(a: int, b) -> int { if (a < b) { return -a; } else { !true } };
+let g = fn*() { yield 1; };
+let ch = chan(1);
+spawn(f, 1, 2);
+select { case v = recv(ch) { v } case send(ch, 1) { 1 } default { 0 } };
+match (Shape.Circle(1)) { Circle(r) { r } default { 0 } };
+"done";
+`
+
+// nodeTypes returns the name of every type in ast.go that implements
+// Node, found by looking for its TokenLiteral method.
+func nodeTypes(t *testing.T) []string {
+	file, err := goparser.ParseFile(token.NewFileSet(), "ast.go", nil, 0)
+	if err != nil {
+		t.Fatalf("could not parse ast.go: %s", err)
+	}
+
+	names := []string{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*goast.FuncDecl)
+		if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+			continue
+		}
+		star := fn.Recv.List[0].Type.(*goast.StarExpr)
+		names = append(names, star.X.(*goast.Ident).Name)
+	}
+
+	return names
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestWalkCoversEveryNodeType(t *testing.T) {
+	seen := map[string]bool{}
+	ast.Inspect(parse(t, everyNode), func(node ast.Node) bool {
+		if node != nil {
+			seen[reflect.TypeOf(node).Elem().Name()] = true
+		}
+		return true
+	})
+
+	for _, name := range nodeTypes(t) {
+		if !seen[name] {
+			t.Errorf("%s was never visited: add it to Walk, Modify and the everyNode program", name)
+		}
+	}
+}
+
+func TestModifyCoversEveryNodeType(t *testing.T) {
+	seen := map[string]bool{}
+	ast.Modify(parse(t, everyNode), func(node ast.Node) ast.Node {
+		seen[reflect.TypeOf(node).Elem().Name()] = true
+		return node
+	})
+
+	for _, name := range nodeTypes(t) {
+		if !seen[name] {
+			t.Errorf("%s was never modified: add it to Walk, Modify and the everyNode program", name)
+		}
+	}
+}
+
+type counter struct {
+	depth, maxDepth int
+}
+
+func (c *counter) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		c.depth--
+		return nil
+	}
+	c.depth++
+	if c.depth > c.maxDepth {
+		c.maxDepth = c.depth
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	c := &counter{}
+	ast.Walk(c, parse(t, `1 + (2 * -3)`))
+
+	// Program, ExpressionStatement, Infix, Infix, Prefix, IntegerLiteral
+	if c.maxDepth != 6 {
+		t.Errorf("expected a depth of 6, got %d", c.maxDepth)
+	}
+	if c.depth != 0 {
+		t.Errorf("expected every Visit to be closed by Visit(nil), depth is %d", c.depth)
+	}
+}
+
+func TestInspectOrderAndPruning(t *testing.T) {
+	program := parse(t, `let a = {"k": b, c: d}; fn(x) { y }`)
+
+	identifiers := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			identifiers = append(identifiers, ident.Value)
+		}
+		return true
+	})
+
+	expected := []string{"a", "b", "c", "d"}
+	if !reflect.DeepEqual(identifiers, expected) {
+		t.Errorf("expected %v, got %v", expected, identifiers)
+	}
+}
+
+func TestModify(t *testing.T) {
+	turnOneIntoTwo := func(node ast.Node) ast.Node {
+		integer, ok := node.(*ast.IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		integer.Token.Literal = "2"
+		return integer
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`1`, `2`},
+		{`1 + 1`, `(2 + 2)`},
+		{`-1`, `(-2)`},
+		{`[1, 3][1]`, `([2, 3][2])`},
+		{`{1: 1, 3: 1}`, `{2:2, 3:2}`},
+		{`if (1) { 1 } else { 1 }`, `if2 2else2`},
+		{`return 1;`, `return 2;`},
+		{`let x = 1;`, `let x = 2;`},
+		{`fn() { 1 }`, `fn<>( ) 2`},
+		{`f(1).y`, `(f(2).y)`},
+		{`match (x) { A(a) { 1 } default { 1 } }`, `match (x) { A(a) { 2 } default { 2 } }`},
+	}
+
+	for _, tt := range tests {
+		modified := ast.Modify(parse(t, tt.input), turnOneIntoTwo)
+		if modified.String() != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, modified.String())
+		}
+	}
+}
+
+func TestModifyReplacesNodes(t *testing.T) {
+	program := parse(t, `let a = {"x": y}; a`)
+
+	renamed := ast.Modify(program, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || ident.Value != "y" {
+			return node
+		}
+		return &ast.StringLiteral{Value: "y", Token: ident.Token}
+	})
+
+	hash := renamed.(*ast.Program).Statements[0].(*ast.LetStatement).Value.(*ast.HashLiteral)
+	for _, value := range hash.Pairs {
+		if _, ok := value.(*ast.StringLiteral); !ok {
+			t.Errorf("expected the hash value to be replaced, got %T", value)
+		}
+	}
+
+	// A let name must stay an identifier
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.Identifier); ok {
+			return &ast.IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+	if program.Statements[0].(*ast.LetStatement).Name.Value != "a" {
+		t.Errorf("expected the let name to be kept")
+	}
+}
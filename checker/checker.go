@@ -0,0 +1,602 @@
+package checker
+
+import (
+	"fmt"
+
+	"monkey/ast"
+	"monkey/token"
+)
+
+// Checker infers types for a program ahead of compilation and reports
+// operations that are sure to fail, like "1" + 1. It only reports what it
+// can prove: anything it cannot infer is Any and never an error.
+type Checker struct {
+	scope  *scope
+	types  map[string]Type
+	errors []string
+
+	// Globals defined more than once, whose type is Any
+	redefined map[string]bool
+
+	// One entry per enclosing function literal being checked
+	functions []*function
+}
+
+type scope struct {
+	vars  map[string]Type
+	outer *scope
+}
+
+type function struct {
+	declared Type   // The annotated return type, or nil
+	returns  []Type // Types of the values of its return statements
+}
+
+var builtins = map[string]Type{
+	"len":   &Function{Params: []Type{Any}, Return: Int},
+	"puts":  &Function{Return: Null},
+	"first": &Function{Params: []Type{Any}, Return: Any},
+	"last":  &Function{Params: []Type{Any}, Return: Any},
+	"rest":  &Function{Params: []Type{Any}, Return: Any},
+	"push":  &Function{Params: []Type{Any, Any}, Return: Any},
+	"chan":  &Function{Return: Chan},
+	"send":  &Function{Params: []Type{Chan, Any}, Return: Null},
+	"recv":  &Function{Params: []Type{Chan}, Return: Any},
+	"close": &Function{Params: []Type{Chan}, Return: Null},
+	"set":   &Function{Return: Set},
+}
+
+// New returns a checker whose global scope persists across calls to Check,
+// so a REPL can check one line at a time.
+func New() *Checker {
+	global := &scope{vars: map[string]Type{}}
+	for name, t := range builtins {
+		global.vars[name] = t
+	}
+
+	return &Checker{scope: global, types: map[string]Type{}, redefined: map[string]bool{}}
+}
+
+// Check checks program and returns the errors found, each prefixed with the
+// line and column it refers to.
+func (c *Checker) Check(program *ast.Program) []string {
+	c.errors = []string{}
+	c.findRedefined(program)
+	c.check(program)
+	return c.errors
+}
+
+// findRedefined notes the globals that program defines again, after an
+// earlier definition in it or in a program checked before. A function using
+// one may run after any of the definitions, so no single type holds for it.
+func (c *Checker) findRedefined(program *ast.Program) {
+	seen := map[string]bool{}
+	for _, s := range program.Statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		name := let.Name.Value
+		if _, defined := c.scope.vars[name]; defined || seen[name] {
+			c.redefined[name] = true
+		}
+		seen[name] = true
+	}
+}
+
+func (c *Checker) check(node ast.Node) Type {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			c.check(s)
+		}
+		return Any
+
+	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			return Any
+		}
+		return c.check(node.Expression)
+
+	case *ast.BlockStatement:
+		return c.checkBlock(node)
+
+	case *ast.LetStatement:
+		c.checkLet(node)
+		return Any
+
+	case *ast.ReturnStatement:
+		t := c.check(node.Value)
+		if len(c.functions) > 0 {
+			fn := c.functions[len(c.functions)-1]
+			fn.returns = append(fn.returns, t)
+			if fn.declared != nil && !assignable(fn.declared, t) {
+				c.errorf(node.Token, "cannot return %s from function returning %s", t, fn.declared)
+			}
+		}
+		return Any
+
+	case *ast.StructStatement:
+		st := &Struct{Name: node.Name.Value}
+		c.types[st.Name] = st
+
+		params := make([]Type, len(node.Fields))
+		for i := range params {
+			params[i] = Any
+		}
+		c.scope.vars[st.Name] = &Function{Params: params, Return: st}
+		return Any
+
+	case *ast.EnumStatement:
+		c.scope.vars[node.Name.Value] = Any
+		return Any
+
+	case *ast.MatchExpression:
+		c.check(node.Subject)
+
+		var result Type
+		for _, arm := range node.Arms {
+			result = c.joinArm(result, c.checkArm(arm.Bindings, arm.Body))
+		}
+		if node.Default == nil {
+			return Any
+		}
+		return c.joinArm(result, c.checkArm(nil, node.Default))
+
+	case *ast.ImplStatement:
+		receiver := c.types[node.Name.Value]
+		for _, m := range node.Methods {
+			c.checkFunction(m, receiver)
+		}
+		return Any
+
+	case *ast.IntegerLiteral:
+		return Int
+
+	case *ast.StringLiteral:
+		return String
+
+	case *ast.Boolean:
+		return Bool
+
+	case *ast.Identifier:
+		if t, ok := c.lookup(node.Value); ok {
+			return t
+		}
+		return Any
+
+	case *ast.ArrayLiteral:
+		var element Type
+		for _, e := range node.Elements {
+			t := c.check(e)
+			if element == nil {
+				element = t
+			} else {
+				element = join(element, t)
+			}
+		}
+		if element == nil {
+			element = Any
+		}
+		return &Array{Element: element}
+
+	case *ast.HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			c.check(key)
+			c.check(node.Pairs[key])
+		}
+		return Hash
+
+	case *ast.PrefixExpression:
+		return c.checkPrefix(node)
+
+	case *ast.InfixExpression:
+		return c.checkInfix(node)
+
+	case *ast.IfExpression:
+		c.check(node.Condition)
+		consequence := c.check(node.Consequence)
+		if node.Alternative == nil {
+			return Any
+		}
+		return join(consequence, c.check(node.Alternative))
+
+	case *ast.IndexExpression:
+		return c.checkIndex(node)
+
+	case *ast.FunctionLiteral:
+		return c.checkFunction(node, nil)
+
+	case *ast.CallExpression:
+		return c.checkCall(node)
+
+	case *ast.MemberExpression:
+		c.check(node.Object)
+		return Any
+
+	case *ast.YieldExpression:
+		c.check(node.Value)
+		return Null
+
+	case *ast.SpawnExpression:
+		c.check(node.Function)
+		for _, a := range node.Arguments {
+			c.check(a)
+		}
+		return Chan
+
+	case *ast.SelectExpression:
+		for _, sc := range node.Cases {
+			c.expect(sc.Channel, Chan, "select case")
+			if sc.Send {
+				c.check(sc.Value)
+			}
+			var names []*ast.Identifier
+			if sc.Name != nil {
+				names = append(names, sc.Name)
+			}
+			c.checkArm(names, sc.Body)
+		}
+		if node.Default != nil {
+			c.checkArm(nil, node.Default)
+		}
+		return Any
+	}
+
+	return Any
+}
+
+// joinArm folds the type of one more branch into result, which is nil
+// before the first branch.
+func (c *Checker) joinArm(result, t Type) Type {
+	if result == nil {
+		return t
+	}
+	return join(result, t)
+}
+
+// checkBlock returns the type of the block's value: that of its last
+// statement if it is an expression, Any otherwise.
+func (c *Checker) checkBlock(block *ast.BlockStatement) Type {
+	var t Type = Any
+	for _, s := range block.Statements {
+		t = c.check(s)
+		if _, ok := s.(*ast.ExpressionStatement); !ok {
+			t = Any
+		}
+	}
+	return t
+}
+
+func (c *Checker) checkLet(node *ast.LetStatement) {
+	var declared Type
+	if node.Name.Type != nil {
+		declared = c.resolve(node.Name.Type)
+	}
+
+	// Let a function refer to itself through its own signature
+	if fl, ok := node.Value.(*ast.FunctionLiteral); ok {
+		if declared != nil {
+			c.scope.vars[node.Name.Value] = declared
+		} else {
+			c.scope.vars[node.Name.Value] = c.signature(fl, nil)
+		}
+	}
+
+	t := c.check(node.Value)
+	if declared != nil && !assignable(declared, t) {
+		c.errorf(node.Token, "cannot assign %s to %s of type %s", t, node.Name.Value, declared)
+	}
+
+	switch {
+	case c.scope.outer == nil && c.redefined[node.Name.Value]:
+		c.scope.vars[node.Name.Value] = Any
+	case declared != nil:
+		c.scope.vars[node.Name.Value] = declared
+	default:
+		c.scope.vars[node.Name.Value] = t
+	}
+}
+
+// signature builds a function's type from its annotations alone. An
+// unannotated first parameter of a method is its receiver.
+func (c *Checker) signature(fl *ast.FunctionLiteral, receiver Type) *Function {
+	params := make([]Type, len(fl.Parameters))
+	for i, p := range fl.Parameters {
+		switch {
+		case p.Type != nil:
+			params[i] = c.resolve(p.Type)
+		case i == 0 && receiver != nil:
+			params[i] = receiver
+		default:
+			params[i] = Any
+		}
+	}
+
+	var ret Type = Any
+	if fl.ReturnType != nil && !fl.Generator {
+		ret = c.resolve(fl.ReturnType)
+	}
+
+	return &Function{Params: params, Return: ret}
+}
+
+func (c *Checker) checkFunction(fl *ast.FunctionLiteral, receiver Type) Type {
+	sig := c.signature(fl, receiver)
+
+	fn := &function{}
+	if fl.ReturnType != nil && !fl.Generator {
+		fn.declared = sig.Return
+	}
+
+	c.scope = &scope{vars: map[string]Type{}, outer: c.scope}
+	c.functions = append(c.functions, fn)
+	for i, p := range fl.Parameters {
+		c.scope.vars[p.Value] = sig.Params[i]
+	}
+
+	body := c.check(fl.Body)
+
+	c.functions = c.functions[:len(c.functions)-1]
+	c.scope = c.scope.outer
+
+	if fl.Generator {
+		return sig
+	}
+
+	if fn.declared != nil {
+		if len(fl.Body.Statements) > 0 && !assignable(fn.declared, body) {
+			last := fl.Body.Statements[len(fl.Body.Statements)-1]
+			c.errorf(tokenOf(last), "cannot return %s from function returning %s", body, fn.declared)
+		}
+		return sig
+	}
+
+	// A body ending in a return statement has no value of its own
+	ret := body
+	if len(fl.Body.Statements) > 0 {
+		if _, ok := fl.Body.Statements[len(fl.Body.Statements)-1].(*ast.ReturnStatement); ok {
+			ret = nil
+		}
+	}
+	for _, t := range fn.returns {
+		if ret == nil {
+			ret = t
+		} else {
+			ret = join(ret, t)
+		}
+	}
+	if ret == nil {
+		ret = Any
+	}
+	sig.Return = ret
+
+	return sig
+}
+
+func (c *Checker) checkCall(node *ast.CallExpression) Type {
+	callee := c.check(node.Function)
+
+	args := make([]Type, len(node.Arguments))
+	for i, a := range node.Arguments {
+		args[i] = c.check(a)
+	}
+
+	// Methods are looked up at run time
+	if _, ok := node.Function.(*ast.MemberExpression); ok {
+		return Any
+	}
+
+	fn, ok := callee.(*Function)
+	if !ok {
+		if callee != Any {
+			c.errorf(node.Token, "cannot call %s of type %s", node.Function, callee)
+		}
+		return Any
+	}
+
+	if fn.Params == nil {
+		return fn.Return
+	}
+
+	if len(args) != len(fn.Params) {
+		c.errorf(node.Token, "wrong number of arguments to %s: want=%d, got=%d", node.Function, len(fn.Params), len(args))
+		return fn.Return
+	}
+
+	for i, arg := range args {
+		if !assignable(fn.Params[i], arg) {
+			c.errorf(tokenOf(node.Arguments[i]), "cannot use %s as %s in argument %d to %s", arg, fn.Params[i], i+1, node.Function)
+		}
+	}
+
+	return fn.Return
+}
+
+func (c *Checker) checkPrefix(node *ast.PrefixExpression) Type {
+	right := c.check(node.Right)
+
+	switch node.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if right != Any && right != Int {
+			c.errorf(node.Token, "invalid operation: -%s", right)
+		}
+		return Int
+	}
+
+	return Any
+}
+
+func (c *Checker) checkInfix(node *ast.InfixExpression) Type {
+	left := c.check(node.Left)
+	right := c.check(node.Right)
+
+	switch node.Operator {
+	case "==", "!=", "in":
+		return Bool
+	case "<", ">":
+		c.expectOperands(node, left, right, Int)
+		return Bool
+	case "-", "*", "/":
+		c.expectOperands(node, left, right, Int)
+		return Int
+	case "+":
+		// Only int + int and string + string succeed at run time, so one
+		// known side decides the result
+		switch {
+		case left == Any && right == Any:
+			return Any
+		case assignable(Int, left) && assignable(Int, right):
+			return Int
+		case assignable(String, left) && assignable(String, right):
+			return String
+		}
+		c.errorf(node.Token, "type mismatch: %s + %s", left, right)
+		return Any
+	}
+
+	return Any
+}
+
+// expectOperands reports an error unless both operands may have type t.
+func (c *Checker) expectOperands(node *ast.InfixExpression, left, right Type, t Type) {
+	if assignable(t, left) && assignable(t, right) {
+		return
+	}
+	c.errorf(node.Token, "type mismatch: %s %s %s", left, node.Operator, right)
+}
+
+func (c *Checker) checkIndex(node *ast.IndexExpression) Type {
+	left := c.check(node.Left)
+	index := c.check(node.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		if !assignable(Int, index) {
+			c.errorf(node.Token, "cannot index %s with %s", left, index)
+		}
+		return left.Element
+	case Basic:
+		if left != Any && left != Hash {
+			c.errorf(node.Token, "cannot index %s", left)
+		}
+	}
+
+	return Any
+}
+
+// expect checks node and reports an error unless its type may be t.
+func (c *Checker) expect(node ast.Expression, t Type, context string) {
+	got := c.check(node)
+	if !assignable(t, got) {
+		c.errorf(tokenOf(node), "cannot use %s as %s in %s", got, t, context)
+	}
+}
+
+// resolve turns an annotation into a type, reporting names that are neither
+// builtin types nor declared structs.
+func (c *Checker) resolve(annotation *ast.TypeAnnotation) Type {
+	if annotation.Element != nil {
+		return &Array{Element: c.resolve(annotation.Element)}
+	}
+
+	switch annotation.Name {
+	case "int":
+		return Int
+	case "string":
+		return String
+	case "bool":
+		return Bool
+	case "null":
+		return Null
+	case "hash":
+		return Hash
+	case "chan":
+		return Chan
+	case "set":
+		return Set
+	case "any":
+		return Any
+	case "array":
+		return &Array{Element: Any}
+	case "fn":
+		return &Function{Return: Any}
+	}
+
+	if t, ok := c.types[annotation.Name]; ok {
+		return t
+	}
+
+	c.errorf(annotation.Token, "unknown type %s", annotation.Name)
+	return Any
+}
+
+// checkArm checks the body of a match arm or select case in a scope of its
+// own, where the names it binds hide variables of the enclosing scope.
+func (c *Checker) checkArm(names []*ast.Identifier, body *ast.BlockStatement) Type {
+	c.scope = &scope{vars: map[string]Type{}, outer: c.scope}
+	for _, name := range names {
+		c.scope.vars[name.Value] = Any
+	}
+	t := c.check(body)
+	c.scope = c.scope.outer
+	return t
+}
+
+func (c *Checker) lookup(name string) (Type, bool) {
+	for s := c.scope; s != nil; s = s.outer {
+		if t, ok := s.vars[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (c *Checker) errorf(tok token.Token, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	c.errors = append(c.errors, fmt.Sprintf("%d:%d: %s", tok.Line, tok.Column, msg))
+}
+
+// tokenOf returns the token an error about node should point at.
+func tokenOf(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression != nil {
+			return tokenOf(node.Expression)
+		}
+		return node.Token
+	case *ast.InfixExpression:
+		return tokenOf(node.Left)
+	case *ast.CallExpression:
+		return tokenOf(node.Function)
+	case *ast.IndexExpression:
+		return tokenOf(node.Left)
+	case *ast.MemberExpression:
+		return tokenOf(node.Object)
+	case *ast.Identifier:
+		return node.Token
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.ArrayLiteral:
+		return node.Token
+	case *ast.HashLiteral:
+		return node.Token
+	case *ast.FunctionLiteral:
+		return node.Token
+	case *ast.IfExpression:
+		return node.Token
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	}
+	return token.Token{}
+}
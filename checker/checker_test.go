@@ -0,0 +1,91 @@
+package checker
+
+import (
+	"testing"
+
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"1" + 1`, []string{"1:5: type mismatch: string + int"}},
+		{`let x: int = 5; let y: string = x;`, []string{"1:17: cannot assign int to y of type string"}},
+		{`let x = "a"; -x`, []string{"1:14: invalid operation: -string"}},
+		{`let x = [1, 2]; x["a"]`, []string{"1:18: cannot index [int] with string"}},
+		{`5[0]`, []string{"1:2: cannot index int"}},
+		{`let f = 5; f(1)`, []string{"1:13: cannot call f of type int"}},
+		{
+			`let add = fn(a: int, b: int) -> int { a + b };
+add(1, "2")`,
+			[]string{`2:8: cannot use string as int in argument 2 to add`},
+		},
+		{`let add = fn(a: int, b: int) { a + b }; add(1)`, []string{"1:44: wrong number of arguments to add: want=2, got=1"}},
+		{`fn() -> int { "a" }`, []string{"1:15: cannot return string from function returning int"}},
+		{`fn(x) -> int { if (x) { return true; } 1 }`, []string{"1:25: cannot return bool from function returning int"}},
+		{`let n: Number = 1;`, []string{"1:8: unknown type Number"}},
+		{`let greet = fn(name) { "hi " + name }; greet("x") - 1`, []string{"1:51: type mismatch: string - int"}},
+		{`let id = fn(x) { return x; }; id(1) + 1`, []string{}},
+		{
+			`struct Point { x, y };
+impl Point { fn norm(p) -> int { p.x * p.x + p.y * p.y } }
+let p: Point = Point(1, 2);
+let q: int = p;`,
+			[]string{"4:1: cannot assign Point to q of type int"},
+		},
+		{`let fib = fn(x) { if (x < 2) { x } else { fib(x - 1) + fib(x - 2) } }; fib(10)`, []string{}},
+		{`let apply = fn(f: fn, x) { f(x) }; apply(len, "abc") + 1`, []string{}},
+		{
+			`enum Shape { Circle(r) };
+let r = "a";
+match (Shape.Circle(1)) { Circle(r) { r + 1 } };
+r - 1`,
+			[]string{"4:3: type mismatch: string - int"},
+		},
+		{`let ch = chan(1); send(ch, 1); recv(ch) + 1`, []string{}},
+		{`select { case recv(5) { } }`, []string{"1:20: cannot use int as chan in select case"}},
+		{
+			`{"a": -"x", "b": -true, "c": -"z"}`,
+			[]string{"1:7: invalid operation: -string", "1:18: invalid operation: -bool", "1:30: invalid operation: -string"},
+		},
+		{`let x = "a"; let g = fn() { x + 1 }; let x = 1; g()`, []string{}},
+		{`let x = "a"; x + 1; let x = 1;`, []string{}},
+		{`let x = "a"; let y = x; y + 1`, []string{"1:27: type mismatch: string + int"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		errors := New().Check(program)
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q. want=%v, got=%v", tt.input, tt.expected, errors)
+			continue
+		}
+
+		for i, e := range tt.expected {
+			if errors[i] != e {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, e, errors[i])
+			}
+		}
+	}
+}
+
+func TestCheckPersistsAcrossPrograms(t *testing.T) {
+	c := New()
+
+	for _, input := range []string{`let x = "a";`, `x + 1`} {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		errors := c.Check(program)
+		if input == `x + 1` && len(errors) != 1 {
+			t.Fatalf("expected one error for %q, got=%v", input, errors)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package checker
+
+import "strings"
+
+// Type is what the checker knows about the value of an expression. Any
+// stands for "not known until run time" and is compatible with everything,
+// which is what keeps unannotated code checking cleanly.
+type Type interface {
+	String() string
+}
+
+type Basic string
+
+func (b Basic) String() string { return string(b) }
+
+const (
+	Int    Basic = "int"
+	String Basic = "string"
+	Bool   Basic = "bool"
+	Null   Basic = "null"
+	Hash   Basic = "hash"
+	Chan   Basic = "chan"
+	Set    Basic = "set"
+	Any    Basic = "any"
+)
+
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+// Function is the type of a function value. Params is nil when the
+// parameters are not known, like for a plain 'fn' annotation or a builtin
+// taking any number of arguments.
+type Function struct {
+	Params []Type
+	Return Type
+}
+
+func (f *Function) String() string {
+	if f.Params == nil {
+		return "fn"
+	}
+
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Return.String()
+}
+
+// Struct is the type of an instance of a declared struct.
+type Struct struct {
+	Name string
+}
+
+func (s *Struct) String() string { return s.Name }
+
+// assignable reports whether a value of type from can be used where a value
+// of type to is expected.
+func assignable(to, from Type) bool {
+	if to == Any || from == Any {
+		return true
+	}
+
+	switch to := to.(type) {
+	case *Array:
+		from, ok := from.(*Array)
+		return ok && assignable(to.Element, from.Element)
+	case *Function:
+		from, ok := from.(*Function)
+		if !ok {
+			return false
+		}
+		if to.Params == nil || from.Params == nil {
+			return true
+		}
+		if len(to.Params) != len(from.Params) {
+			return false
+		}
+		for i := range to.Params {
+			if !assignable(from.Params[i], to.Params[i]) {
+				return false
+			}
+		}
+		return assignable(to.Return, from.Return)
+	case *Struct:
+		from, ok := from.(*Struct)
+		return ok && to.Name == from.Name
+	default:
+		return to == from
+	}
+}
+
+// join is the type of a value that may come from either a or b.
+func join(a, b Type) Type {
+	if a.String() == b.String() {
+		return a
+	}
+	return Any
+}
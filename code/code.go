@@ -39,6 +39,50 @@ const (
 	OpGetBuiltin
 	OpClosure
 	OpGetFree
+	OpGetField // Operands are the constant index of the field name and the index of its field cache
+	OpMethod   // Binds the closure on top of the stack to the struct type below it
+	OpInvoke   // Calls a method by name on the receiver below the arguments
+	OpYield    // Suspends the running generator, handing it the top of the stack
+	OpSpawn    // Calls the function below the arguments on a new goroutine
+	OpSelect   // Waits on the channel cases below it, then takes the matching jump that follows
+
+	OpMatchVariant // Replaces a variant matching a pattern by its values, or jumps to the next arm
+	OpNoMatch      // Fails a match that has no default arm
+	OpIn           // Tests whether the value below the top is in the container on top
+	OpInfix        // Applies a registered infix operator, named by the operand constant
+	OpPrefix       // Applies a registered prefix operator, named by the operand constant
+	OpConstantWide // OpConstant for constant indexes past 65535
+	OpClosureWide  // OpClosure for constant indexes past 65535 or more than 255 free variables
+	OpTailCall     // OpCall right before OpReturnValue, run in the caller's frame
+	OpJumpTruthy   // OpBang followed by OpJumpNotTruthy, as the peephole pass merges them
+	OpStruct       // Pushes a new struct type, copied from the operand constant
+
+	// Superinstructions, each doing the work of the sequence it replaces
+	OpGetLocalConstSub // OpGetLocal, OpConstant, OpSub
+	OpIncLocal         // OpGetLocal, then adding the constant 1
+	OpEqualJump        // OpEqual, OpJumpNotTruthy
+	OpNotEqualJump     // OpNotEqual, OpJumpNotTruthy
+	OpLessThanJump     // OpLessThan, OpJumpNotTruthy
+	OpGreaterThanJump  // OpGreaterThan, OpJumpNotTruthy
+
+	// Variants of the opcodes with a one-byte operand for values past 255
+	OpGetLocalWide
+	OpSetLocalWide
+	OpGetFreeWide
+	OpGetBuiltinWide
+	OpCallWide
+	OpTailCallWide
+	OpSpawnWide
+
+	// Variants of the opcodes with a constant operand for constant indexes
+	// past 65535
+	OpGetFieldWide
+	OpMethodWide
+	OpInvokeWide // Also for more than 255 arguments
+	OpInfixWide
+	OpPrefixWide
+	OpMatchVariantWide // Also for more than 255 bindings
+	OpStructWide
 )
 
 type Instructions []byte
@@ -83,6 +127,45 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
 	OpGetFree:        {"OpGetFree", []int{1}},
+	OpGetField:       {"OpGetField", []int{2, 2}},
+	OpMethod:         {"OpMethod", []int{2}},
+	OpInvoke:         {"OpInvoke", []int{2, 1}},
+	OpYield:          {"OpYield", []int{}},
+	OpSpawn:          {"OpSpawn", []int{1}},
+	OpSelect:         {"OpSelect", []int{2, 1}},
+	OpMatchVariant:   {"OpMatchVariant", []int{2, 1, 2}},
+	OpNoMatch:        {"OpNoMatch", []int{}},
+	OpIn:             {"OpIn", []int{}},
+	OpInfix:          {"OpInfix", []int{2}},
+	OpPrefix:         {"OpPrefix", []int{2}},
+	OpConstantWide:   {"OpConstantWide", []int{4}},
+	OpClosureWide:    {"OpClosureWide", []int{4, 2}},
+	OpTailCall:       {"OpTailCall", []int{1}},
+	OpJumpTruthy:     {"OpJumpTruthy", []int{2}},
+	OpStruct:         {"OpStruct", []int{2}},
+
+	OpGetLocalConstSub: {"OpGetLocalConstSub", []int{1, 2}},
+	OpIncLocal:         {"OpIncLocal", []int{1}},
+	OpEqualJump:        {"OpEqualJump", []int{2}},
+	OpNotEqualJump:     {"OpNotEqualJump", []int{2}},
+	OpLessThanJump:     {"OpLessThanJump", []int{2}},
+	OpGreaterThanJump:  {"OpGreaterThanJump", []int{2}},
+
+	OpGetLocalWide:   {"OpGetLocalWide", []int{2}},
+	OpSetLocalWide:   {"OpSetLocalWide", []int{2}},
+	OpGetFreeWide:    {"OpGetFreeWide", []int{2}},
+	OpGetBuiltinWide: {"OpGetBuiltinWide", []int{2}},
+	OpCallWide:       {"OpCallWide", []int{2}},
+	OpTailCallWide:   {"OpTailCallWide", []int{2}},
+	OpSpawnWide:      {"OpSpawnWide", []int{2}},
+
+	OpGetFieldWide:     {"OpGetFieldWide", []int{4, 2}},
+	OpMethodWide:       {"OpMethodWide", []int{4}},
+	OpInvokeWide:       {"OpInvokeWide", []int{4, 2}},
+	OpInfixWide:        {"OpInfixWide", []int{4}},
+	OpPrefixWide:       {"OpPrefixWide", []int{4}},
+	OpMatchVariantWide: {"OpMatchVariantWide", []int{4, 2, 2}},
+	OpStructWide:       {"OpStructWide", []int{4}},
 }
 
 func (ins Instructions) String() string {
@@ -93,6 +176,7 @@ func (ins Instructions) String() string {
 		def, err := Lookup(ins[i])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
 			continue
 		}
 
@@ -121,6 +205,8 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
 	case 2:
 		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	case 3:
+		return fmt.Sprintf("%s %d %d %d", def.Name, operands[0], operands[1], operands[2])
 	}
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
 }
@@ -140,6 +226,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 
 	for i, width := range def.OperandWidths {
 		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
 		case 1:
@@ -152,6 +240,10 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
@@ -180,8 +272,30 @@ func Make(op Opcode, operands ...int) []byte {
 			instruction[offset] = byte(o)
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		}
 		offset += width
 	}
 	return instruction
 }
+
+// CheckOperands reports an operand too large for its width in op, which
+// Make would truncate.
+func CheckOperands(op Opcode, operands ...int) error {
+	def, ok := definitions[op]
+	if !ok {
+		return fmt.Errorf("opcode %d undefined", op)
+	}
+
+	for i, o := range operands {
+		if i >= len(def.OperandWidths) {
+			break
+		}
+		width := def.OperandWidths[i]
+		if o < 0 || o >= 1<<(8*width) {
+			return fmt.Errorf("operand %d of %s is %d, which does not fit in %d bytes", i, def.Name, o, width)
+		}
+	}
+	return nil
+}
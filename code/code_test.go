@@ -4,6 +4,30 @@ import (
 	"testing"
 )
 
+func TestCheckOperands(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected string
+	}{
+		{OpConstant, []int{65535}, ""},
+		{OpConstant, []int{65536}, "operand 0 of OpConstant is 65536, which does not fit in 2 bytes"},
+		{OpClosure, []int{1, 256}, "operand 1 of OpClosure is 256, which does not fit in 1 bytes"},
+		{OpConstantWide, []int{1 << 20}, ""},
+		{OpJump, []int{-1}, "operand 0 of OpJump is -1, which does not fit in 2 bytes"},
+	}
+
+	for _, tt := range tests {
+		err := CheckOperands(tt.op, tt.operands...)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
 
 func TestInstructionsString(t *testing.T) {
 	instructions := []Instructions{
@@ -12,6 +36,8 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
 		Make(OpClosure, 65535, 255),
+		Make(OpConstantWide, 65536),
+		Make(OpClosureWide, 70000, 2),
 	}
 
 	expected := `0000 OpAdd
@@ -19,6 +45,8 @@ func TestInstructionsString(t *testing.T) {
 0003 OpConstant 2
 0006 OpConstant 65535
 0009 OpClosure 65535 255
+0013 OpConstantWide 65536
+0018 OpClosureWide 70000 2
 `
 
 	concatted := Instructions{}
@@ -41,6 +69,9 @@ func TestReadOperands(t *testing.T) {
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpConstantWide, []int{1 << 20}, 4},
+		{OpClosureWide, []int{1<<32 - 1, 65535}, 6},
+		{OpCallWide, []int{65535}, 2},
 	}
 
 	for _, tt := range tests {
@@ -74,6 +105,8 @@ func TestMake(t *testing.T) {
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpConstantWide, []int{65536}, []byte{byte(OpConstantWide), 0, 1, 0, 0}},
+		{OpGetLocalConstSub, []int{2, 258}, []byte{byte(OpGetLocalConstSub), 2, 1, 2}},
 	}
 
 	for _, tt := range tests {
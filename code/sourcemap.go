@@ -0,0 +1,82 @@
+package code
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Position is a place in the source of a program. A zero Line means the
+// place is not known.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return "?"
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// SourceMap maps the offsets of instructions to the position of the source
+// they were compiled from. It only has an entry where the position changes,
+// so the instructions of one expression share a single entry.
+type SourceMap struct {
+	File    string
+	Entries []SourceMapEntry // By ascending offset
+}
+
+// SourceMapEntry gives the position of the instructions from Offset up to
+// the next entry.
+type SourceMapEntry struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Add records that the instruction at offset, which comes after every one
+// recorded so far, was compiled from line and column.
+func (m *SourceMap) Add(offset, line, column int) {
+	if line == 0 {
+		return
+	}
+
+	if n := len(m.Entries); n > 0 {
+		last := &m.Entries[n-1]
+		if last.Line == line && last.Column == column {
+			return
+		}
+		if last.Offset == offset {
+			last.Line, last.Column = line, column
+			return
+		}
+	}
+	m.Entries = append(m.Entries, SourceMapEntry{Offset: offset, Line: line, Column: column})
+}
+
+// Truncate forgets the instructions from offset on, once they have been
+// removed.
+func (m *SourceMap) Truncate(offset int) {
+	i := sort.Search(len(m.Entries), func(i int) bool { return m.Entries[i].Offset >= offset })
+	m.Entries = m.Entries[:i]
+}
+
+// Position returns the position of the instruction that covers offset,
+// whether offset is its opcode or one of its operands.
+func (m *SourceMap) Position(offset int) (Position, bool) {
+	if m == nil {
+		return Position{}, false
+	}
+
+	i := sort.Search(len(m.Entries), func(i int) bool { return m.Entries[i].Offset > offset })
+	if i == 0 {
+		return Position{}, false
+	}
+	e := m.Entries[i-1]
+	return Position{File: m.File, Line: e.Line, Column: e.Column}, true
+}
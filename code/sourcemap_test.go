@@ -0,0 +1,52 @@
+package code
+
+import "testing"
+
+func TestSourceMap(t *testing.T) {
+	m := &SourceMap{File: "main.mk"}
+	m.Add(0, 1, 1)
+	m.Add(3, 1, 1)
+	m.Add(4, 0, 0)
+	m.Add(6, 2, 5)
+	m.Add(6, 2, 7)
+	m.Add(9, 3, 1)
+
+	expected := []SourceMapEntry{{0, 1, 1}, {6, 2, 7}, {9, 3, 1}}
+	if len(m.Entries) != len(expected) {
+		t.Fatalf("wrong entries. want=%v, got=%v", expected, m.Entries)
+	}
+	for i, e := range expected {
+		if m.Entries[i] != e {
+			t.Fatalf("wrong entries. want=%v, got=%v", expected, m.Entries)
+		}
+	}
+
+	tests := []struct {
+		offset   int
+		expected string
+	}{
+		{0, "main.mk:1:1"},
+		{5, "main.mk:1:1"},
+		{6, "main.mk:2:7"},
+		{8, "main.mk:2:7"},
+		{20, "main.mk:3:1"},
+		{-1, "?"},
+	}
+
+	for _, tt := range tests {
+		pos, _ := m.Position(tt.offset)
+		if pos.String() != tt.expected {
+			t.Errorf("wrong position at %d. want=%s, got=%s", tt.offset, tt.expected, pos)
+		}
+	}
+
+	m.Truncate(6)
+	if pos, _ := m.Position(8); pos.String() != "main.mk:1:1" {
+		t.Errorf("wrong position after Truncate. want=main.mk:1:1, got=%s", pos)
+	}
+
+	var none *SourceMap
+	if _, ok := none.Position(0); ok {
+		t.Errorf("a nil SourceMap has no positions")
+	}
+}
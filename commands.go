@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"monkey/ast"
+	"monkey/checker"
+	"monkey/compiler"
+	"monkey/format"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/vm"
+)
+
+const usage = `usage: monkey [command] [arguments]
+
+Without a command monkey starts the REPL.
+
+commands:
+  ast [--json] file.mk   print the syntax tree of a file
+  fmt [-w] files...      print files in the canonical layout, or rewrite them with -w
+  build file.mk [-o file.mkc]
+                         compile a file to bytecode, by default next to it
+  run file.mkc           run a compiled file, or compile and run a file.mk
+`
+
+// runCommand runs the command named by args[0] and returns the exit status.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "ast":
+		return astCommand(args[1:], stdout, stderr)
+	case "fmt":
+		return fmtCommand(args[1:], stdout, stderr)
+	case "build":
+		return buildCommand(args[1:], stderr)
+	case "run":
+		return runFileCommand(args[1:], stderr)
+	case "help", "-h", "--help":
+		io.WriteString(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "monkey: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func astCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintf(stderr, "usage: monkey ast [--json] file.mk\n")
+		return 2
+	}
+
+	program, ok := parseFile(flags.Arg(0), stderr)
+	if !ok {
+		return 1
+	}
+
+	if !*asJSON {
+		fmt.Fprintln(stdout, program.String())
+		return 0
+	}
+
+	data, err := json.MarshalIndent(program, "", "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s\n", data)
+	return 0
+}
+
+func fmtCommand(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write the result back to the files")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintf(stderr, "usage: monkey fmt [-w] files...\n")
+		return 2
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			status = 1
+			continue
+		}
+
+		formatted, err := format.Source(source)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			status = 1
+			continue
+		}
+
+		if !*write {
+			stdout.Write(formatted)
+			continue
+		}
+		if string(formatted) == string(source) {
+			continue
+		}
+		if err := os.WriteFile(path, formatted, 0644); err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func buildCommand(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "write the bytecode to this file instead of file.mkc")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return 2
+	}
+	if len(paths) != 1 {
+		fmt.Fprintf(stderr, "usage: monkey build file.mk [-o file.mkc]\n")
+		return 2
+	}
+
+	path := paths[0]
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+
+	bytecode, ok := compileFile(path, stderr)
+	if !ok {
+		return 1
+	}
+
+	data, err := bytecode.MarshalBinary()
+	if err == nil {
+		err = os.WriteFile(*output, data, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runFileCommand(args []string, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintf(stderr, "usage: monkey run file.mkc\n")
+		return 2
+	}
+	path := args[0]
+
+	var bytecode *compiler.Bytecode
+	if filepath.Ext(path) == ".mkc" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "monkey: %s\n", err)
+			return 1
+		}
+		bytecode = &compiler.Bytecode{}
+		if err := bytecode.UnmarshalBinary(data); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return 1
+		}
+	} else {
+		var ok bool
+		if bytecode, ok = compileFile(path, stderr); !ok {
+			return 1
+		}
+	}
+
+	if err := vm.New(bytecode).Run(); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// compileFile parses, checks and compiles the Monkey source in path,
+// reporting errors and warnings to stderr.
+func compileFile(path string, stderr io.Writer) (*compiler.Bytecode, bool) {
+	program, ok := parseFile(path, stderr)
+	if !ok {
+		return nil, false
+	}
+
+	if errors := checker.New().Check(program); len(errors) != 0 {
+		for _, msg := range errors {
+			fmt.Fprintf(stderr, "%s:%s\n", path, msg)
+		}
+		return nil, false
+	}
+
+	comp := compiler.New()
+	comp.SetFile(path)
+	if err := comp.Compile(program); err != nil {
+		errs, ok := err.(compiler.CompileErrors)
+		if !ok {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			return nil, false
+		}
+		for _, e := range errs {
+			fmt.Fprintf(stderr, "%s:%d:%d: %s\n", path, e.Line, e.Column, e.Message)
+		}
+		return nil, false
+	}
+	for _, w := range comp.Warnings() {
+		fmt.Fprintf(stderr, "%s:%d:%d: warning: %s\n", path, w.Line, w.Column, w.Message)
+	}
+
+	return comp.Bytecode(), true
+}
+
+// parseInterspersed parses flags that may come after the positional
+// arguments, as in build file.mk -o file.mkc, and returns the positional
+// ones.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// parseFile parses the Monkey source in path, reporting any errors to stderr.
+func parseFile(path string, stderr io.Writer) (*ast.Program, bool) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %s\n", err)
+		return nil, false
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.PositionedErrors() {
+			fmt.Fprintf(stderr, "%s:%s\n", path, msg)
+		}
+		return nil, false
+	}
+
+	return program, true
+}
@@ -2,11 +2,14 @@ package compiler
 
 import (
 	"fmt"
+	"maps"
 	"sort"
+	"strconv"
 
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
+	"monkey/token"
 )
 
 type EmittedInstruction struct {
@@ -16,6 +19,16 @@ type EmittedInstruction struct {
 
 type Compiler struct {
 	constants []object.Object
+	interned  map[constantKey]int // Indexes of the constants that can be shared
+	options   Options
+	warnings  []Warning
+
+	suppressed map[int]bool // Lines whose warnings a comment turns off
+
+	errors []*CompileError // Of the program being compiled
+
+	file     string      // Name of the source file, for the source maps
+	position token.Token // Token of the node being compiled
 
 	symbolTable *SymbolTable
 	scopes      []CompilationScope
@@ -26,18 +39,75 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	lastJumpTarget      int // Where the jump patched last lands
+	sourceMap           *code.SourceMap
+	declarations        []declaration
+	closures            []*object.DebugInfo // Of the function literals compiled in the scope, in order
+	fieldCaches         int                 // Numbered by the OpGetFields of the scope
+}
+
+// Warning points at code that compiles but is likely a mistake, like a
+// statement that can never run.
+type Warning struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%d:%d: %s", w.Line, w.Column, w.Message)
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Debug        *object.DebugInfo // Of the main program, holding that of every function literal
+}
+
+// Options selects the optimizations the compiler applies.
+type Options struct {
+	// FoldConstants computes operators on literals, like 1 + 2 or !true,
+	// at compile time and compiles only the branch an if with a literal
+	// condition takes.
+	FoldConstants bool
+
+	// EliminateDeadCode leaves out the statements of a block after one
+	// that always returns, with a warning, and the branches of an if with
+	// a literal condition that are never taken.
+	EliminateDeadCode bool
+
+	// TailCalls compiles a call whose result the function returns right
+	// away into OpTailCall, which runs the callee in the caller's frame so
+	// that tail recursion needs no more frames than a loop.
+	TailCalls bool
+
+	// Peephole rewrites short instruction sequences of every function,
+	// and of the program, into shorter ones that do the same: jumps to the
+	// next instruction or to another jump, OpNull right before OpPop, and
+	// OpBang right before OpJumpNotTruthy.
+	Peephole bool
+
+	// Superinstructions replaces sequences that run together often, like
+	// a local minus a constant or a comparison followed by a conditional
+	// jump, with one instruction that does the work of all of them.
+	Superinstructions bool
+}
+
+// DefaultOptions turns every optimization on.
+func DefaultOptions() Options {
+	return Options{FoldConstants: true, EliminateDeadCode: true, TailCalls: true, Peephole: true, Superinstructions: true}
 }
 
 func New() *Compiler {
+	return NewWithOptions(DefaultOptions())
+}
+
+func NewWithOptions(options Options) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		sourceMap:           &code.SourceMap{},
 	}
 
 	symbolTable := NewSymbolTable()
@@ -47,6 +117,8 @@ func New() *Compiler {
 
 	return &Compiler{
 		constants:   []object.Object{},
+		interned:    map[constantKey]int{},
+		options:     options,
 		symbolTable: symbolTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
@@ -57,32 +129,72 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
 	compiler.constants = constants
+	for i, obj := range constants {
+		if key, ok := keyOf(obj); ok {
+			compiler.interned[key] = i
+		}
+	}
 	return compiler
 }
 
+// SetFile names the file the compiled program comes from, which the
+// source maps and so runtime errors refer to.
+func (c *Compiler) SetFile(name string) {
+	c.file = name
+}
+
+// Compile compiles node, usually a whole *ast.Program, and returns every
+// error in it as CompileErrors. Code with errors leaves the compiler as it
+// was.
 func (c *Compiler) Compile(node ast.Node) error {
+	c.errors = nil
+	restore := c.checkpoint()
+
+	err := c.compile(node)
+	if err == nil {
+		err = c.compileErrors()
+	}
+	if err != nil {
+		restore()
+	}
+	return err
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	if tok := nodeToken(node); tok.Line > 0 {
+		outer := c.position
+		c.position = tok
+		defer func() { c.position = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
+		c.suppress(node.Comments)
+
 		for _, s := range node.Statements {
-			err := c.Compile(s)
+			err := c.compile(s)
 			if err != nil {
 				return err
 			}
 		}
 	case *ast.CallExpression:
-		err := c.Compile(node.Function)
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			return c.compileInvoke(member, node.Arguments)
+		}
+
+		err := c.compile(node.Function)
 		if err != nil {
 			return err
 		}
 
 		for _, a := range node.Arguments {
-			err := c.Compile(a)
+			err := c.compile(a)
 			if err != nil {
 				return err
 			}
 		}
 
-		c.emit(code.OpCall, len(node.Arguments))
+		c.emitSized(code.OpCall, len(node.Arguments))
 
 	case *ast.FunctionLiteral:
 		c.enterScope()
@@ -92,10 +204,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+			c.declare(p.Token, p.Value, "parameter")
 		}
 
-		err := c.Compile(node.Body)
+		err := c.compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -108,34 +220,136 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpReturn)
 		}
 
+		c.warnUnused()
+
 		freeSymbol := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
-
+		names := c.symbolTable.names
+		scope := c.scopes[c.scopeIndex]
+		instructions, sourceMap := c.optimize(c.leaveScope(), scope.sourceMap, false)
+
+		debug := &object.DebugInfo{
+			Name:      node.Name,
+			Locals:    liveLocals(instructions, names, len(node.Parameters)),
+			Free:      []string{},
+			SourceMap: sourceMap,
+			Closures:  closureSites(instructions, scope.closures),
+		}
 		for _, s := range freeSymbol {
 			c.loadSymbol(s)
+			debug.Free = append(debug.Free, s.Name)
 		}
 
-		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters)}
+		compiledFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters), Generator: node.Generator}
 
 		fnIndex := c.addConstant(compiledFn)
-		c.emit(code.OpClosure, fnIndex, len(freeSymbol))
+		c.scopes[c.scopeIndex].closures = append(c.scopes[c.scopeIndex].closures, debug)
+		c.emitSized(code.OpClosure, fnIndex, len(freeSymbol))
+
+	case *ast.SpawnExpression:
+		err := c.compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emitSized(code.OpSpawn, len(node.Arguments))
+
+	case *ast.SelectExpression:
+		return c.compileSelect(node)
+
+	case *ast.YieldExpression:
+		err := c.compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpYield)
 
 	case *ast.ReturnStatement:
-		err := c.Compile(node.Value)
+		err := c.compile(node.Value)
 		if err != nil {
 			return err
 		}
 
 		c.emit(code.OpReturnValue)
+		c.markTailCall()
+
+	case *ast.StructStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+
+		fields := []string{}
+		for _, f := range node.Fields {
+			fields = append(fields, f.Value)
+		}
+		structType := &object.StructType{Name: node.Name.Value, Fields: fields, Methods: map[string]object.Object{}}
+
+		// The constant is a template: each run of the declaration copies
+		// it, for its impls to attach methods to
+		c.emitSized(code.OpStruct, c.addConstant(structType))
+		c.storeSymbol(symbol)
+
+	case *ast.EnumStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+
+		enum := &object.Enum{Name: node.Name.Value}
+		for _, v := range node.Variants {
+			fields := []string{}
+			for _, f := range v.Fields {
+				fields = append(fields, f.Value)
+			}
+			enum.Variants = append(enum.Variants, object.NewVariantConstructor(enum.Name, v.Name.Value, fields))
+		}
+
+		c.loadConstant(c.addConstant(enum))
+		c.storeSymbol(symbol)
+
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+
+	case *ast.ImplStatement:
+		symbol, ok := c.resolve(node.Name)
+
+		for _, method := range node.Methods {
+			if ok {
+				c.loadSymbol(symbol)
+			} else {
+				c.emit(code.OpNull)
+			}
+
+			err := c.compile(method)
+			if err != nil {
+				return err
+			}
+
+			name := &object.String{Value: method.Name}
+			c.emitSized(code.OpMethod, c.addConstant(name))
+		}
+
+	case *ast.MemberExpression:
+		err := c.compile(node.Object)
+		if err != nil {
+			return err
+		}
+
+		name := &object.String{Value: node.Property.Value}
+		scope := &c.scopes[c.scopeIndex]
+		c.emitSized(code.OpGetField, c.addConstant(name), scope.fieldCaches)
+		scope.fieldCaches++
 
 	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
+		err := c.compile(node.Left)
 		if err != nil {
 			return err
 		}
 
-		err = c.Compile(node.Index)
+		err = c.compile(node.Index)
 		if err != nil {
 			return err
 		}
@@ -150,12 +364,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 		sort.Slice(keys, func(i, j int) bool {
 			return keys[i].String() < keys[j].String()
 		})
+		c.warnDuplicateKeys(keys)
 		for _, k := range keys {
-			err := c.Compile(k)
+			err := c.compile(k)
 			if err != nil {
 				return err
 			}
-			err = c.Compile(node.Pairs[k])
+			err = c.compile(node.Pairs[k])
 			if err != nil {
 				return err
 			}
@@ -164,7 +379,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 	case *ast.ArrayLiteral:
 		for _, ele := range node.Elements {
-			err := c.Compile(ele)
+			err := c.compile(ele)
 			if err != nil {
 				return err
 			}
@@ -172,42 +387,55 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpArray, len(node.Elements))
 
 	case *ast.Identifier:
-		symbol, ok := c.symbolTable.Resolve(node.Value)
+		symbol, ok := c.resolve(node)
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			c.emit(code.OpNull)
+			return nil
 		}
 
 		c.loadSymbol(symbol)
 
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+		symbol := c.declare(node.Name.Token, node.Name.Value, "variable")
+		err := c.compile(node.Value)
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
-		}
+		c.storeSymbol(symbol)
 
 	case *ast.BlockStatement:
-		for _, s := range node.Statements {
-			err := c.Compile(s)
+		for i, s := range node.Statements {
+			err := c.compile(s)
 			if err != nil {
 				return err
 			}
+
+			if c.options.EliminateDeadCode && i < len(node.Statements)-1 && c.returned() {
+				c.warn(nodeToken(node.Statements[i+1]), "unreachable code")
+				for _, s := range node.Statements[i+1:] {
+					if err := c.compileDropped(s); err != nil {
+						return err
+					}
+				}
+				break
+			}
 		}
 
 	case *ast.IfExpression:
-		err := c.Compile(node.Condition)
+		if c.options.FoldConstants || c.options.EliminateDeadCode {
+			if condition, ok := constantValue(node.Condition); ok {
+				return c.compileFoldedIf(node, isTruthy(condition))
+			}
+		}
+
+		err := c.compile(node.Condition)
 		if err != nil {
 			return err
 		}
 
 		// 9999 is a temporary value. The value will be determined later when we compile the consequence block
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
-		err = c.Compile(node.Consequence)
+		err = c.compile(node.Consequence)
 		if err != nil {
 			return err
 		}
@@ -223,7 +451,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if node.Alternative == nil {
 			c.emit(code.OpNull)
 		} else {
-			err := c.Compile(node.Alternative)
+			err := c.compile(node.Alternative)
 			if err != nil {
 				return err
 			}
@@ -237,14 +465,25 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.changeOperand(jumpPos, afterAlternativePos)
 
 	case *ast.ExpressionStatement:
-		err := c.Compile(node.Expression)
+		err := c.compile(node.Expression)
 		if err != nil {
 			return err
 		}
+		if c.options.EliminateDeadCode && c.returned() {
+			// An if whose only branch compiled returns leaves nothing to pop
+			return nil
+		}
 		c.emit(code.OpPop)
 
 	case *ast.PrefixExpression:
-		err := c.Compile(node.Right)
+		if c.options.FoldConstants {
+			if value, ok := constantValue(node); ok {
+				c.emitConstant(value)
+				return nil
+			}
+		}
+
+		err := c.compile(node.Right)
 		if err != nil {
 			return err
 		}
@@ -254,15 +493,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMinus)
 		case "!":
 			c.emit(code.OpBang)
+		default:
+			if _, ok := object.LookupPrefixOperator(node.Operator); !ok {
+				c.errorf(node.Token, ErrUnknownOperator, "unknown operator %s", node.Operator)
+				return nil
+			}
+			c.emitSized(code.OpPrefix, c.addConstant(&object.String{Value: node.Operator}))
 		}
 
 	case *ast.InfixExpression:
-		err := c.Compile(node.Left)
+		if c.options.FoldConstants {
+			if value, ok := constantValue(node); ok {
+				c.emitConstant(value)
+				return nil
+			}
+		}
+
+		err := c.compile(node.Left)
 		if err != nil {
 			return err
 		}
 
-		err = c.Compile(node.Right)
+		err = c.compile(node.Right)
 		if err != nil {
 			return err
 		}
@@ -284,8 +536,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
+		case "in":
+			c.emit(code.OpIn)
 		default:
-			return fmt.Errorf("unkown operator %s", node.Operator)
+			if _, ok := object.LookupInfixOperator(node.Operator); !ok {
+				c.errorf(node.Token, ErrUnknownOperator, "unknown operator %s", node.Operator)
+				return nil
+			}
+			c.emitSized(code.OpInfix, c.addConstant(&object.String{Value: node.Operator}))
 		}
 
 	case *ast.Boolean:
@@ -297,34 +555,503 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(integer))
+		c.loadConstant(c.addConstant(integer))
 
 	case *ast.StringLiteral:
 		string := &object.String{Value: node.Value}
-		c.emit(code.OpConstant, c.addConstant(string))
+		c.loadConstant(c.addConstant(string))
 
 	}
 	return nil
 }
 
+// compileInvoke compiles receiver.name(args...) into a single OpInvoke so the
+// VM can dispatch on the receiver's type without building a bound method.
+func (c *Compiler) compileInvoke(member *ast.MemberExpression, arguments []ast.Expression) error {
+	err := c.compile(member.Object)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range arguments {
+		err := c.compile(a)
+		if err != nil {
+			return err
+		}
+	}
+
+	name := &object.String{Value: member.Property.Value}
+	c.emitSized(code.OpInvoke, c.addConstant(name), len(arguments))
+
+	return nil
+}
+
+// compileSelect pushes a (channel, value, isSend) triple per case and emits
+// OpSelect followed by one OpJump per case, plus one for default. The VM
+// pushes the received value and runs the jump for the chosen case. Each
+// body starts by binding or popping that value.
+func (c *Compiler) compileSelect(node *ast.SelectExpression) error {
+	for _, sc := range node.Cases {
+		err := c.compile(sc.Channel)
+		if err != nil {
+			return err
+		}
+
+		if sc.Send {
+			err := c.compile(sc.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpNull)
+			c.emit(code.OpFalse)
+		}
+	}
+
+	hasDefault := 0
+	if node.Default != nil {
+		hasDefault = 1
+	}
+	c.emit(code.OpSelect, len(node.Cases), hasDefault)
+
+	jumpTable := []int{}
+	for i := 0; i < len(node.Cases)+hasDefault; i++ {
+		jumpTable = append(jumpTable, c.emit(code.OpJump, 9999))
+	}
+
+	jumpsToEnd := []int{}
+	for i, sc := range node.Cases {
+		c.changeOperand(jumpTable[i], len(c.currentInstruction()))
+
+		endBlock := c.symbolTable.block()
+		if sc.Name != nil {
+			c.storeSymbol(c.symbolTable.Define(sc.Name.Value))
+		} else {
+			c.emit(code.OpPop)
+		}
+
+		err := c.compileBranch(sc.Body)
+		if err != nil {
+			return err
+		}
+		endBlock()
+		jumpsToEnd = append(jumpsToEnd, c.emit(code.OpJump, 9999))
+	}
+
+	if node.Default != nil {
+		c.changeOperand(jumpTable[len(node.Cases)], len(c.currentInstruction()))
+		c.emit(code.OpPop)
+
+		endBlock := c.symbolTable.block()
+		err := c.compileBranch(node.Default)
+		if err != nil {
+			return err
+		}
+		endBlock()
+	}
+
+	afterSelectPos := len(c.currentInstruction())
+	for _, pos := range jumpsToEnd {
+		c.changeOperand(pos, afterSelectPos)
+	}
+
+	return nil
+}
+
+// compileMatch keeps the subject on the stack while trying each arm in
+// turn. OpMatchVariant replaces a matching subject with its values, which
+// the arm then binds, and otherwise jumps to the next arm.
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	err := c.compile(node.Subject)
+	if err != nil {
+		return err
+	}
+
+	jumpsToEnd := []int{}
+	for _, arm := range node.Arms {
+		pattern := c.addConstant(&object.String{Value: arm.Pattern})
+		matchPos := c.emitSized(code.OpMatchVariant, pattern, len(arm.Bindings), 9999)
+		matchOp := code.Opcode(c.currentInstruction()[matchPos])
+
+		// Each arm is a block, so its bindings hide variables of the same
+		// name only within it
+		endBlock := c.symbolTable.block()
+		for i := len(arm.Bindings) - 1; i >= 0; i-- {
+			c.storeSymbol(c.symbolTable.Define(arm.Bindings[i].Value))
+		}
+
+		err := c.compileBranch(arm.Body)
+		if err != nil {
+			return err
+		}
+		endBlock()
+		jumpsToEnd = append(jumpsToEnd, c.emit(code.OpJump, 9999))
+
+		nextArmPos := len(c.currentInstruction())
+		c.checkOperands(matchOp, pattern, len(arm.Bindings), nextArmPos)
+		c.replaceInstruction(matchPos, code.Make(matchOp, pattern, len(arm.Bindings), nextArmPos))
+	}
+
+	if node.Default != nil {
+		c.emit(code.OpPop)
+		endBlock := c.symbolTable.block()
+		err := c.compileBranch(node.Default)
+		if err != nil {
+			return err
+		}
+		endBlock()
+	} else {
+		c.emit(code.OpNoMatch)
+	}
+
+	afterMatchPos := len(c.currentInstruction())
+	for _, pos := range jumpsToEnd {
+		c.changeOperand(pos, afterMatchPos)
+	}
+
+	return nil
+}
+
+// compileFoldedIf compiles only the branch of an if whose condition is
+// known at compile time.
+func (c *Compiler) compileFoldedIf(node *ast.IfExpression, truthy bool) error {
+	if truthy {
+		err := c.compileBranch(node.Consequence)
+		if err != nil || node.Alternative == nil {
+			return err
+		}
+		return c.compileDropped(node.Alternative)
+	}
+
+	err := c.compileDropped(node.Consequence)
+	if err != nil {
+		return err
+	}
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+		return nil
+	}
+	return c.compileBranch(node.Alternative)
+}
+
+// compileDropped compiles code the optimizations leave out and throws away
+// the instructions and constants, so that the code is still checked: names
+// it reads count as used, and undefined ones are errors like they are
+// without the optimizations.
+func (c *Compiler) compileDropped(node ast.Node) error {
+	scope := c.scopes[c.scopeIndex]
+	numConstants := len(c.constants)
+	interned := maps.Clone(c.interned)
+
+	err := c.compile(node)
+
+	scope.sourceMap.Truncate(len(scope.instructions))
+	c.scopes[c.scopeIndex] = scope
+	c.constants = c.constants[:numConstants]
+	c.interned = interned
+	return err
+}
+
+// compileBranch compiles a select case or match arm body so that it leaves
+// exactly one value, null if its last statement produces none.
+func (c *Compiler) compileBranch(body *ast.BlockStatement) error {
+	if len(body.Statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	err := c.compile(body)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.options.EliminateDeadCode || !c.returned() {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// returned reports whether the code emitted last always returns, so that
+// nothing compiled after it until the next jump target can run.
+func (c *Compiler) returned() bool {
+	scope := c.scopes[c.scopeIndex]
+	end := len(scope.instructions)
+	if end == 0 || scope.lastJumpTarget == end {
+		return false
+	}
+
+	last := scope.lastInstruction
+	return (last.OpCode == code.OpReturnValue || last.OpCode == code.OpReturn) && last.Position == end-1
+}
+
+// Warnings returns the warnings about the code compiled so far, in the
+// order of their positions.
+func (c *Compiler) Warnings() []Warning {
+	sort.SliceStable(c.warnings, func(i, j int) bool {
+		a, b := c.warnings[i], c.warnings[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return c.warnings
+}
+
+func (c *Compiler) warn(tok token.Token, message string) {
+	if c.suppressed[tok.Line] {
+		return
+	}
+	c.warnings = append(c.warnings, Warning{Line: tok.Line, Column: tok.Column, Message: message})
+}
+
+// nodeToken returns the token node was parsed from: the first token of a
+// statement, and the operator or the token that tells an expression apart,
+// like the '(' of a call, otherwise. A Program has none.
+func nodeToken(node ast.Node) token.Token {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return node.Token
+	case *ast.ReturnStatement:
+		return node.Token
+	case *ast.ExpressionStatement:
+		return node.Token
+	case *ast.BlockStatement:
+		return node.Token
+	case *ast.StructStatement:
+		return node.Token
+	case *ast.EnumStatement:
+		return node.Token
+	case *ast.ImplStatement:
+		return node.Token
+	case *ast.Identifier:
+		return node.Token
+	case *ast.IntegerLiteral:
+		return node.Token
+	case *ast.StringLiteral:
+		return node.Token
+	case *ast.Boolean:
+		return node.Token
+	case *ast.PrefixExpression:
+		return node.Token
+	case *ast.InfixExpression:
+		return node.Token
+	case *ast.IfExpression:
+		return node.Token
+	case *ast.FunctionLiteral:
+		return node.Token
+	case *ast.CallExpression:
+		return node.Token
+	case *ast.ArrayLiteral:
+		return node.Token
+	case *ast.HashLiteral:
+		return node.Token
+	case *ast.IndexExpression:
+		return node.Token
+	case *ast.MemberExpression:
+		return node.Token
+	case *ast.YieldExpression:
+		return node.Token
+	case *ast.SpawnExpression:
+		return node.Token
+	case *ast.SelectExpression:
+		return node.Token
+	case *ast.MatchExpression:
+		return node.Token
+	}
+	return token.Token{}
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+	instructions, sourceMap := c.optimize(scope.instructions, scope.sourceMap, true)
+
 	return &Bytecode{
-		Instructions: c.currentInstruction(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		Debug:        &object.DebugInfo{Locals: []object.Local{}, Free: []string{}, SourceMap: sourceMap, Closures: closureSites(instructions, scope.closures)},
+	}
+}
+
+// closureSites pairs the OpClosure instructions in ins with the DebugInfo
+// of the function literals they were compiled from, which are in the same
+// order: the optimizations move instructions but never drop a closure.
+func closureSites(ins code.Instructions, closures []*object.DebugInfo) map[int]*object.DebugInfo {
+	sites := map[int]*object.DebugInfo{}
+	for i := 0; i < len(ins) && len(sites) < len(closures); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			break
+		}
+		op := code.Opcode(ins[i])
+		if op == code.OpClosure || op == code.OpClosureWide {
+			sites[i] = closures[len(sites)]
+		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+	}
+	return sites
+}
+
+// liveLocals names the local slots of a function and works out when each
+// holds its variable: a parameter from the start, any other local from
+// right after the instruction that sets it. Either lasts until a later
+// local of the same name hides it, or to the end of the function. A local
+// that is never set never holds its variable.
+func liveLocals(ins code.Instructions, names []string, numParameters int) []object.Local {
+	locals := make([]object.Local, len(names))
+	for i, name := range names {
+		locals[i] = object.Local{Name: name, Start: -1, End: len(ins)}
+		if i < numParameters {
+			locals[i].Start = 0
+		}
+	}
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			break
+		}
+		op := code.Opcode(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+
+		if (op == code.OpSetLocal || op == code.OpSetLocalWide) && locals[operands[0]].Start == -1 {
+			locals[operands[0]].Start = i
+		}
+	}
+
+	for i := range locals {
+		if locals[i].Start == -1 {
+			locals[i].Start = len(ins)
+			continue
+		}
+		for _, later := range locals[i+1:] {
+			if later.Name == locals[i].Name && later.Start > locals[i].Start && later.Start < locals[i].End {
+				locals[i].End = later.Start
+			}
+		}
+	}
+	return locals
+}
+
+// optimize applies the passes the options turn on to the finished
+// instructions of a function, or of the program if program is set, and
+// names the file in their source map.
+func (c *Compiler) optimize(ins code.Instructions, sourceMap *code.SourceMap, program bool) (code.Instructions, *code.SourceMap) {
+	if c.options.Peephole {
+		ins, sourceMap = optimize(ins, sourceMap, program)
+	}
+	if c.options.Superinstructions {
+		ins, sourceMap = fuse(ins, sourceMap, c.constants)
 	}
+
+	named := *sourceMap
+	named.File = c.file
+	return ins, &named
 }
 
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
+	c.scopes[c.scopeIndex].sourceMap.Add(pos, c.position.Line, c.position.Column)
 
 	c.setLastInstruction(op, pos)
 	return pos
 }
 
+// addConstant returns the index of obj in the constant pool. Integers,
+// strings and compiled functions equal to one already there share its
+// entry.
 func (c *Compiler) addConstant(obj object.Object) int {
+	key, ok := keyOf(obj)
+	if ok {
+		if index, found := c.interned[key]; found {
+			return index
+		}
+	}
+
 	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+	index := len(c.constants) - 1
+	if ok {
+		c.interned[key] = index
+	}
+	return index
+}
+
+// constantKey identifies a constant by its value.
+type constantKey struct {
+	kind  object.ObjectType
+	value string
+}
+
+// keyOf returns the key of an immutable constant. Struct types and enums
+// collect methods at run time, so each keeps an entry of its own.
+func keyOf(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{obj.Type(), strconv.FormatInt(obj.Value, 10)}, true
+	case *object.String:
+		return constantKey{obj.Type(), obj.Value}, true
+	case *object.CompiledFunction:
+		value := fmt.Sprintf("%d %d %t %s", obj.NumLocals, obj.NumParameters, obj.Generator, obj.Instructions)
+		return constantKey{obj.Type(), value}, true
+	}
+	return constantKey{}, false
+}
+
+// loadConstant pushes the constant at index.
+func (c *Compiler) loadConstant(index int) {
+	c.emitSized(code.OpConstant, index)
+}
+
+// wideVariants maps opcodes to the variant with wider operands the compiler
+// emits instead when the operands do not fit.
+var wideVariants = map[code.Opcode]code.Opcode{
+	code.OpConstant:   code.OpConstantWide,
+	code.OpClosure:    code.OpClosureWide,
+	code.OpGetLocal:   code.OpGetLocalWide,
+	code.OpSetLocal:   code.OpSetLocalWide,
+	code.OpGetFree:    code.OpGetFreeWide,
+	code.OpGetBuiltin: code.OpGetBuiltinWide,
+	code.OpCall:       code.OpCallWide,
+	code.OpSpawn:      code.OpSpawnWide,
+
+	code.OpGetField:     code.OpGetFieldWide,
+	code.OpMethod:       code.OpMethodWide,
+	code.OpInvoke:       code.OpInvokeWide,
+	code.OpInfix:        code.OpInfixWide,
+	code.OpPrefix:       code.OpPrefixWide,
+	code.OpMatchVariant: code.OpMatchVariantWide,
+	code.OpStruct:       code.OpStructWide,
+}
+
+// emitSized emits op, or its wide variant if its operands need one. Values
+// too large even for that fail the compilation like any other operand.
+func (c *Compiler) emitSized(op code.Opcode, operands ...int) int {
+	if wide, ok := wideVariants[op]; ok && code.CheckOperands(op, operands...) != nil {
+		op = wide
+	}
+	return c.emit(op, operands...)
+}
+
+// checkOperands records operands code.Make would truncate, so that Compile
+// fails instead of producing a corrupt program.
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if err := code.CheckOperands(op, operands...); err != nil {
+		c.errorf(c.position, ErrOperandTooLarge, "%s", err)
+	}
+}
+
+// resolve resolves the name ident reads, recording an error if nothing
+// defines it.
+func (c *Compiler) resolve(ident *ast.Identifier) (Symbol, bool) {
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok {
+		c.errorf(ident.Token, ErrUndefinedVariable, "undefined variable %s", ident.Value)
+	}
+	return symbol, ok
 }
 
 func (c *Compiler) addInstruction(ins []byte) int {
@@ -357,6 +1084,7 @@ func (c *Compiler) removeLastPop() {
 	new := old[:last.Position]
 
 	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
 	c.scopes[c.scopeIndex].lastInstruction = previous
 }
 
@@ -369,9 +1097,11 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 
 func (c *Compiler) changeOperand(opPos int, operand int) {
 	op := code.Opcode(c.currentInstruction()[opPos])
+	c.checkOperands(op, operand)
 	newInstruction := code.Make(op, operand)
 
 	c.replaceInstruction(opPos, newInstruction)
+	c.scopes[c.scopeIndex].lastJumpTarget = operand
 }
 
 func (c *Compiler) currentInstruction() code.Instructions {
@@ -383,6 +1113,7 @@ func (c *Compiler) enterScope() {
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
+		sourceMap:           &code.SourceMap{},
 	}
 
 	c.scopes = append(c.scopes, scope)
@@ -405,6 +1136,38 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
 
 	c.scopes[c.scopeIndex].lastInstruction.OpCode = code.OpReturnValue
+	c.markTailCall()
+}
+
+// markTailCall turns an OpCall right before the OpReturnValue just emitted
+// into OpTailCall. Both take the same operand, so nothing moves.
+func (c *Compiler) markTailCall() {
+	if !c.options.TailCalls || c.scopeIndex == 0 {
+		return
+	}
+
+	scope := c.scopes[c.scopeIndex]
+	call := scope.previousInstruction
+	tail, ok := tailCalls[call.OpCode]
+	if !ok || call.Position+len(code.Make(call.OpCode, 0)) != scope.lastInstruction.Position {
+		return
+	}
+
+	c.currentInstruction()[call.Position] = byte(tail)
+	c.scopes[c.scopeIndex].previousInstruction.OpCode = tail
+}
+
+var tailCalls = map[code.Opcode]code.Opcode{
+	code.OpCall:     code.OpTailCall,
+	code.OpCallWide: code.OpTailCallWide,
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emitSized(code.OpSetLocal, s.Index)
+	}
 }
 
 func (c *Compiler) loadSymbol(s Symbol) {
@@ -412,11 +1175,11 @@ func (c *Compiler) loadSymbol(s Symbol) {
 	case GlobalScope:
 		c.emit(code.OpGetGlobal, s.Index)
 	case LocalScope:
-		c.emit(code.OpGetLocal, s.Index)
+		c.emitSized(code.OpGetLocal, s.Index)
 	case FreeScope:
-		c.emit(code.OpGetFree, s.Index)
+		c.emitSized(code.OpGetFree, s.Index)
 	case BuiltinScope:
-		c.emit(code.OpGetBuiltin, s.Index)
+		c.emitSized(code.OpGetBuiltin, s.Index)
 	case FunctionScope:
 		c.emit(code.OpCurrentClosure)
 	}
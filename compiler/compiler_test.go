@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"monkey/ast"
@@ -17,6 +18,697 @@ type compilerTestCase struct {
 	expectedInstructions []code.Instructions
 }
 
+func TestDroppedCodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let h = fn() { if (false) { zzz }; 1 };", "1:29: undefined variable zzz"},
+		{"if (false) { nope }; 1", "1:14: undefined variable nope"},
+		{"if (true) { 1 } else { nope }", "1:24: undefined variable nope"},
+		{"if (1 < 2) { 1 } else { fn() { nope } }", "1:32: undefined variable nope"},
+		{"fn() { return 1; nope }", "1:18: undefined variable nope"},
+		{"fn(x) { if (x) { return 1; let y = nope; y }; 2 }", "1:36: undefined variable nope"},
+	}
+
+	for _, tt := range tests {
+		for _, options := range []Options{{}, DefaultOptions()} {
+			err := NewWithOptions(options).Compile(parse(tt.input))
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%q with %+v: expected error %q, got %v", tt.input, options, tt.expected, err)
+			}
+		}
+	}
+
+	compiler := New()
+	if err := compiler.Compile(parse("if (false) { fn() { 1 } }; fn() { return 3; fn() { 4 } }; 2")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if len(compiler.Bytecode().Constants) != 3 {
+		t.Errorf("the dropped code left constants behind. got=%d", len(compiler.Bytecode().Constants))
+	}
+}
+
+func TestDebugInfo(t *testing.T) {
+	input := `let fibonacci = fn(x) { let a = x; let b = 2; let a = b; let g = fn() { a + x }; g };`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	outer := bytecode.Debug.Closure(0)
+	if outer == nil {
+		t.Fatalf("no debug info for the closure at 0. got=%v", bytecode.Debug.Closures)
+	}
+	fn := bytecode.Constants[2].(*object.CompiledFunction)
+	if outer.Signature(fn) != "fn fibonacci(x)" {
+		t.Errorf("wrong Signature. want=%q, got=%q", "fn fibonacci(x)", outer.Signature(fn))
+	}
+
+	// The second a hides the first once it is set at 13
+	expected := []object.Local{
+		{Name: "x", Start: 0, End: 26},
+		{Name: "a", Start: 4, End: 13},
+		{Name: "b", Start: 9, End: 26},
+		{Name: "a", Start: 13, End: 26},
+		{Name: "g", Start: 23, End: 26},
+	}
+	if fmt.Sprint(outer.Locals) != fmt.Sprint(expected) {
+		t.Errorf("wrong locals.\nwant=%v\ngot=%v", expected, outer.Locals)
+	}
+	if len(outer.Free) != 0 {
+		t.Errorf("fibonacci has no free variables. got=%v", outer.Free)
+	}
+
+	inner := outer.Closure(17)
+	if inner == nil {
+		t.Fatalf("no debug info for the closure at 17. got=%v", outer.Closures)
+	}
+	if inner.Name != "g" || fmt.Sprint(inner.Free) != "[a x]" {
+		t.Errorf("wrong debug info for g. got %q with free variables %v", inner.Name, inner.Free)
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	params := make([]string, 300)
+	args := make([]string, 300)
+	for i := range params {
+		params[i] = "p" + letters(i)
+		args[i] = fmt.Sprint(i)
+	}
+	list := strings.Join(params, ", ")
+
+	var lets strings.Builder
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&lets, "let a%s = %d; ", letters(i), i)
+	}
+
+	tests := []struct {
+		input    string
+		expected []code.Instructions
+	}{
+		{
+			"fn(" + list + ") { pln }(" + strings.Join(args, ", ") + ")",
+			[]code.Instructions{code.Make(code.OpGetLocalWide, 299), code.Make(code.OpCallWide, 300)},
+		},
+		{
+			"fn() { " + lets.String() + "aln }",
+			[]code.Instructions{code.Make(code.OpSetLocalWide, 299), code.Make(code.OpGetLocalWide, 299)},
+		},
+		{
+			"fn(" + list + ") { fn() { [" + list + "] } }",
+			[]code.Instructions{code.Make(code.OpGetFreeWide, 299), code.Make(code.OpClosureWide, 0, 300)},
+		},
+		{
+			"let f = fn(" + list + ") { f(" + list + ") }",
+			[]code.Instructions{code.Make(code.OpTailCallWide, 300)},
+		},
+		{
+			"fn(" + list + ") { spawn(pa, " + list + ") }",
+			[]code.Instructions{code.Make(code.OpSpawnWide, 300)},
+		},
+		{
+			"fn(" + list + ") { pa.m(" + list + ") }",
+			[]code.Instructions{code.Make(code.OpInvokeWide, 0, 300)},
+		},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		all := [][]byte{compiler.Bytecode().Instructions}
+		for _, obj := range compiler.Bytecode().Constants {
+			if fn, ok := obj.(*object.CompiledFunction); ok {
+				all = append(all, fn.Instructions)
+			}
+		}
+
+		for _, want := range tt.expected {
+			found := false
+			for _, ins := range all {
+				found = found || hasInstruction(ins, want)
+			}
+			if !found {
+				t.Errorf("no %q in the compiled code", want)
+			}
+		}
+	}
+}
+
+// letters spells i in base 26 with the letters a to z, since identifiers
+// cannot hold digits.
+func letters(i int) string {
+	s := string(rune('a' + i%26))
+	if i >= 26 {
+		s = letters(i/26) + s
+	}
+	return s
+}
+
+// hasInstruction reports whether ins holds the instruction want.
+func hasInstruction(ins code.Instructions, want code.Instructions) bool {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return false
+		}
+		_, read := code.ReadOperands(def, ins[i+1:])
+		if string(ins[i:i+1+read]) == string(want) {
+			return true
+		}
+		i += 1 + read
+	}
+	return false
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let f = fn(n) { f(n) }; f(1)`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpCurrentClosure),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(g) { if (g) { return g(); } g() + 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotTruthy, 13),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpTailCall, 0),
+					// 0009
+					code.Make(code.OpReturnValue),
+					// 0010
+					code.Make(code.OpJump, 14),
+					// 0013
+					code.Make(code.OpNull),
+					// 0014
+					code.Make(code.OpPop),
+					// 0015
+					code.Make(code.OpGetLocal, 0),
+					// 0017
+					code.Make(code.OpCall, 0),
+					// 0019
+					code.Make(code.OpConstant, 0),
+					// 0022
+					code.Make(code.OpAdd),
+					// 0023
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, tests, Options{TailCalls: true})
+}
+
+func TestConstantInterning(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let f = fn() { "a" + 1 }; let g = fn() { "a" + 1 }; let h = fn*() { "a" + 1 }; 1`,
+			expectedConstants: []interface{}{
+				"a",
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestWideConstantIndexes(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&input, "%d;", i)
+	}
+	input.WriteString("fn() { 1 };")
+
+	compiler := New()
+	if err := compiler.Compile(parse(input.String())); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	tail := []code.Instructions{
+		code.Make(code.OpConstantWide, 69999),
+		code.Make(code.OpPop),
+		code.Make(code.OpClosureWide, 70000, 0),
+		code.Make(code.OpPop),
+	}
+	ins := compiler.Bytecode().Instructions
+	if err := testInstructions(tail, ins[len(ins)-14:]); err != nil {
+		t.Errorf("testInstructions failed: %s", err)
+	}
+	// Constants up to 65535 take OpConstant and OpPop, four bytes
+	first := []code.Instructions{code.Make(code.OpConstantWide, 65536)}
+	if err := testInstructions(first, ins[65536*4:65536*4+5]); err != nil {
+		t.Errorf("testInstructions failed: %s", err)
+	}
+}
+
+func TestOperandsTooLarge(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[" + strings.Repeat("1, ", 65535) + "1]", "1:1: operand 0 of OpArray is 65536, which does not fit in 2 bytes"},
+		{"fn() {}(" + strings.Repeat("1, ", 65535) + "1)", "1:8: operand 0 of OpCallWide is 65536, which does not fit in 2 bytes"},
+		{"struct P { x }; P(1).m(" + strings.Repeat("1, ", 65535) + "1)", "1:23: operand 1 of OpInvokeWide is 65536, which does not fit in 2 bytes"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("expected error %q, got %v", tt.expected, err)
+		}
+	}
+}
+
+func TestDeadCodeElimination(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { return 1; 2; 3 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { if (true) { return 1; }; 2 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if (false) { puts(1) } else { 2 }`,
+			expectedConstants: []interface{}{2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, tests, Options{EliminateDeadCode: true})
+}
+
+func TestUnreachableCodeWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn() { return 1; 2; 3 }", []string{"1:18: unreachable code"}},
+		{"fn() { if (true) { return 1; }; 2 }", []string{"1:33: unreachable code"}},
+		{"fn(x) {\n  if (x) { return 1; 2 }\n  let y = 3;\n  return y;\n  y\n}", []string{"2:22: unreachable code", "5:3: unreachable code"}},
+		{"fn(x) { if (x) { return 1; } else { return 2; }; 3 }", []string{}},
+		{"fn(x) { match (x) { A { return 1; } default { return 2; } }; 3 }", []string{}},
+		{"fn() { return 1; }", []string{}},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		warnings := []string{}
+		for _, w := range compiler.Warnings() {
+			warnings = append(warnings, w.String())
+		}
+		if fmt.Sprint(warnings) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: wrong warnings. want=%q, got=%q", tt.input, tt.expected, warnings)
+		}
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `1 + 2 * 3; -5`,
+			expectedConstants: []interface{}{7, -5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"mon" + "key"`,
+			expectedConstants: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1 < 2; 2 * 2 == 5; !true; true != !false`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `if (1 > 2) { 10 } else { 20 }; if (true) { 30 }; if (!true) { 40 }`,
+			expectedConstants: []interface{}{20, 30},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let x = 1; x + 2 * 3`,
+			expectedConstants: []interface{}{1, 6},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1 / 0; 1 + "a"`,
+			expectedConstants: []interface{}{1, 0, "a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, tests, DefaultOptions())
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `1 in [1]`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestEnums(t *testing.T) {
+	shape := &object.Enum{Name: "Shape", Variants: []*object.VariantConstructor{
+		object.NewVariantConstructor("Shape", "Circle", []string{"r"}),
+		object.NewVariantConstructor("Shape", "Empty", nil),
+	}}
+
+	tests := []compilerTestCase{
+		{
+			input:             `enum Shape { Circle(r), Empty }; match (Shape.Empty) { Circle(r) { r } default { 0 } }`,
+			expectedConstants: []interface{}{shape, "Empty", "Circle", 0},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpGetField, 1, 0),
+				// 0014
+				code.Make(code.OpMatchVariant, 2, 1, 29),
+				// 0020
+				code.Make(code.OpSetGlobal, 1),
+				// 0023
+				code.Make(code.OpGetGlobal, 1),
+				// 0026
+				code.Make(code.OpJump, 33),
+				// 0029
+				code.Make(code.OpPop),
+				// 0030
+				code.Make(code.OpConstant, 3),
+				// 0033
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `match (1) { Shape.Empty { 2 } }`,
+			expectedConstants: []interface{}{1, "Shape.Empty", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMatchVariant, 1, 0, 15),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpJump, 16),
+				code.Make(code.OpNoMatch),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `spawn(len, "a")`,
+			expectedConstants: []interface{}{"a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSpawn, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `select { case v = recv(1) { v } default { 2 } }`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpNull),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpSelect, 1, 1),
+				// 0009
+				code.Make(code.OpJump, 15),
+				// 0012
+				code.Make(code.OpJump, 24),
+				// 0015
+				code.Make(code.OpSetGlobal, 0),
+				// 0018
+				code.Make(code.OpGetGlobal, 0),
+				// 0021
+				code.Make(code.OpJump, 28),
+				// 0024
+				code.Make(code.OpPop),
+				// 0025
+				code.Make(code.OpConstant, 1),
+				// 0028
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn*() { yield 1; }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpYield),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"abc".upper()`,
+			expectedConstants: []interface{}{"abc", "upper"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpInvoke, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `[1].push(2)`,
+			expectedConstants: []interface{}{1, 2, "push"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpInvoke, 2, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `struct Point { x, y }; Point(1, 2).x;`,
+			expectedConstants: []interface{}{
+				&object.StructType{Name: "Point", Fields: []string{"x", "y"}},
+				1,
+				2,
+				"x",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpStruct, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpGetField, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `struct Point { x, y }; impl Point { fn getX(p) { p.x } }`,
+			expectedConstants: []interface{}{
+				&object.StructType{Name: "Point", Fields: []string{"x", "y"}},
+				"x",
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetField, 1, 0),
+					code.Make(code.OpReturnValue),
+				},
+				"getX",
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpStruct, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpMethod, 3),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestImplUndefinedStruct(t *testing.T) {
+	program := parse(`impl Point { fn getX(p) { p.x } }`)
+
+	compiler := New()
+	err := compiler.Compile(program)
+	if err == nil {
+		t.Fatalf("expected compile error, got none")
+	}
+
+	if err.Error() != "1:6: undefined variable Point" {
+		t.Errorf("wrong compile error. got=%q", err)
+	}
+}
+
 func TestDefineAndResolveFunctionName(t *testing.T) {
 	global := NewSymbolTable()
 	global.DefineFunctionName("a")
@@ -63,13 +755,12 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpCall, 1),
 				code.Make(code.OpPop),
 			},
@@ -92,18 +783,17 @@ wrapper();
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 				[]code.Instructions{
 					code.Make(code.OpClosure, 1, 0),
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 2),
+					code.Make(code.OpConstant, 0),
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
@@ -562,14 +1252,14 @@ func TestIndexLiteral(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             "[1, 2, 3][1 + 1]",
-			expectedConstants: []interface{}{1, 2, 3, 1, 1},
+			expectedConstants: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -577,13 +1267,13 @@ func TestIndexLiteral(t *testing.T) {
 		},
 		{
 			input:             "{1: 2}[2 - 1]",
-			expectedConstants: []interface{}{1, 2, 2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSub),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -883,13 +1573,20 @@ func TestIntegerArithmetic(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+// runCompilerTests checks the bytecode compiled without optimizations, so
+// that it follows the source one to one.
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
+	runCompilerTestsWithOptions(t, tests, Options{})
+}
+
+func runCompilerTestsWithOptions(t *testing.T, tests []compilerTestCase, options Options) {
+	t.Helper()
 
 	for _, tt := range tests {
 		program := parse(tt.input)
 
-		compiler := New()
+		compiler := NewWithOptions(options)
 		err := compiler.Compile(program)
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
@@ -951,6 +1648,22 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case *object.StructType:
+			structType, ok := actual[i].(*object.StructType)
+			if !ok {
+				return fmt.Errorf("constant %d - not a struct type: %T", i, actual[i])
+			}
+			if structType.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong struct type. want=%q, got=%q", i, constant.Inspect(), structType.Inspect())
+			}
+		case *object.Enum:
+			enum, ok := actual[i].(*object.Enum)
+			if !ok {
+				return fmt.Errorf("constant %d - not an enum: %T", i, actual[i])
+			}
+			if enum.Inspect() != constant.Inspect() {
+				return fmt.Errorf("constant %d - wrong enum. want=%q, got=%q", i, constant.Inspect(), enum.Inspect())
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -1002,9 +1715,3 @@ func concatInstruction(expected []code.Instructions) code.Instructions {
 
 	return out
 }
-
-func (s *SymbolTable) DefineFunctionName(name string) Symbol {
-	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
-	s.store[name] = symbol
-	return symbol
-}
@@ -0,0 +1,98 @@
+package compiler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"monkey/token"
+)
+
+// ErrorCode tells the kinds of CompileError apart.
+type ErrorCode string
+
+const (
+	ErrUndefinedVariable ErrorCode = "undefined-variable"
+	ErrUnknownOperator   ErrorCode = "unknown-operator"
+	ErrOperandTooLarge   ErrorCode = "operand-too-large"
+)
+
+// CompileError is a problem that keeps a program from compiling, at the
+// position of the node it was found in.
+type CompileError struct {
+	Line    int
+	Column  int
+	Code    ErrorCode
+	Message string
+}
+
+func (e *CompileError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// CompileErrors is what Compile returns for a program with errors: every
+// error it found, in the order of their positions.
+type CompileErrors []*CompileError
+
+func (list CompileErrors) Error() string {
+	messages := []string{}
+	for _, e := range list {
+		messages = append(messages, e.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (list CompileErrors) Unwrap() []error {
+	errs := []error{}
+	for _, e := range list {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// errorf records an error at tok and lets the compiler go on, so that one
+// run reports every error in the program. What it emits after an error is
+// never run.
+func (c *Compiler) errorf(tok token.Token, code ErrorCode, format string, args ...interface{}) {
+	c.errors = append(c.errors, &CompileError{Line: tok.Line, Column: tok.Column, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// compileErrors returns the errors recorded so far, or nil if there are
+// none.
+func (c *Compiler) compileErrors() error {
+	if len(c.errors) == 0 {
+		return nil
+	}
+
+	list := slices.Clone(c.errors)
+	slices.SortStableFunc(list, func(a, b *CompileError) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return CompileErrors(list)
+}
+
+// checkpoint returns a function that undoes what compiling a program does
+// to c: the globals it defines, the constants it adds and the
+// instructions it emits. A program with errors leaves c, and the symbol
+// table the REPL shares between compilers, as they were.
+func (c *Compiler) checkpoint() func() {
+	restoreSymbols := c.symbolTable.checkpoint()
+	scope := c.scopes[c.scopeIndex]
+	numConstants := len(c.constants)
+	interned := maps.Clone(c.interned)
+
+	return func() {
+		restoreSymbols()
+		scope.sourceMap.Truncate(len(scope.instructions))
+		c.scopes[c.scopeIndex] = scope
+		c.constants = c.constants[:numConstants]
+		c.interned = interned
+	}
+}
@@ -0,0 +1,105 @@
+package compiler
+
+import (
+	"errors"
+	"testing"
+
+	"monkey/object"
+)
+
+func TestCompileErrorsOutsideProgram(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`1 + x`).Statements[0])
+
+	var list CompileErrors
+	if !errors.As(err, &list) {
+		t.Fatalf("expected CompileErrors, got %T (%v)", err, err)
+	}
+	if err.Error() != "1:5: undefined variable x" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+	if len(compiler.Bytecode().Instructions) != 0 || len(compiler.Bytecode().Constants) != 0 {
+		t.Errorf("the failed statement left code behind. instructions=%s, constants=%d",
+			compiler.Bytecode().Instructions, len(compiler.Bytecode().Constants))
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	input := `let a = b + 1;
+let f = fn(x) { x + y };
+impl Nope { fn m(p) { q } }
+let g = fn() { a + f(1) };
+g() + c`
+
+	err := New().Compile(parse(input))
+
+	var list CompileErrors
+	if !errors.As(err, &list) {
+		t.Fatalf("expected CompileErrors, got %T (%v)", err, err)
+	}
+
+	expected := []CompileError{
+		{Line: 1, Column: 9, Code: ErrUndefinedVariable, Message: "undefined variable b"},
+		{Line: 2, Column: 21, Code: ErrUndefinedVariable, Message: "undefined variable y"},
+		{Line: 3, Column: 6, Code: ErrUndefinedVariable, Message: "undefined variable Nope"},
+		{Line: 3, Column: 23, Code: ErrUndefinedVariable, Message: "undefined variable q"},
+		{Line: 5, Column: 7, Code: ErrUndefinedVariable, Message: "undefined variable c"},
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d:\n%s", len(expected), len(list), err)
+	}
+	for i, e := range expected {
+		if *list[i] != e {
+			t.Errorf("error %d wrong. want=%+v, got=%+v", i, e, *list[i])
+		}
+	}
+
+	var first *CompileError
+	if !errors.As(err, &first) || first.Message != "undefined variable b" {
+		t.Errorf("errors.As did not find the first CompileError. got=%v", first)
+	}
+
+	want := "1:9: undefined variable b\n2:21: undefined variable y\n3:6: undefined variable Nope\n3:23: undefined variable q\n5:7: undefined variable c"
+	if err.Error() != want {
+		t.Errorf("wrong Error.\nwant=%q\ngot=%q", want, err.Error())
+	}
+}
+
+func TestCompileErrorsRollBack(t *testing.T) {
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	first := NewWithState(symbolTable, []object.Object{})
+	if err := first.Compile(parse(`let x = 1;`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	constants := first.Bytecode().Constants
+
+	failed := NewWithState(symbolTable, constants)
+	if err := failed.Compile(parse(`let y = 2; let z = fn() { w }; 3`)); err == nil {
+		t.Fatalf("expected an error for w")
+	}
+	if len(failed.Bytecode().Instructions) != 0 || len(failed.Bytecode().Constants) != len(constants) {
+		t.Errorf("the failed program left code behind. instructions=%s, constants=%d",
+			failed.Bytecode().Instructions, len(failed.Bytecode().Constants))
+	}
+
+	for _, name := range []string{"y", "z"} {
+		if _, ok := symbolTable.Resolve(name); ok {
+			t.Errorf("%s is defined by a program that failed to compile", name)
+		}
+	}
+	if symbolTable.numDefinitions != 1 {
+		t.Errorf("wrong numDefinitions. want=1, got=%d", symbolTable.numDefinitions)
+	}
+
+	next := NewWithState(symbolTable, constants)
+	if err := next.Compile(parse(`let y = x; y`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if symbol, _ := symbolTable.Resolve("y"); symbol.Index != 1 {
+		t.Errorf("y got index %d, want 1", symbol.Index)
+	}
+}
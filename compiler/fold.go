@@ -0,0 +1,142 @@
+package compiler
+
+import (
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// constantValue returns the value of node when it is made only of literals
+// and operators the compiler can apply ahead of time. It leaves alone what
+// would fail at run time, like 1 / 0 or 1 + "a", so the VM still reports it.
+func constantValue(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}, true
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}, true
+
+	case *ast.Boolean:
+		return object.NativeBoolToBooleanObject(node.Value), true
+
+	case *ast.PrefixExpression:
+		right, ok := constantValue(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldPrefix(node.Operator, right)
+
+	case *ast.InfixExpression:
+		left, ok := constantValue(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := constantValue(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldInfix(node.Operator, left, right)
+	}
+
+	return nil, false
+}
+
+func foldPrefix(operator string, right object.Object) (object.Object, bool) {
+	switch right := right.(type) {
+	case *object.Integer:
+		if operator == "-" {
+			return &object.Integer{Value: -right.Value}, true
+		}
+	case *object.Boolean:
+		if operator == "!" {
+			return object.NativeBoolToBooleanObject(!right.Value), true
+		}
+	}
+	return nil, false
+}
+
+func foldInfix(operator string, left, right object.Object) (object.Object, bool) {
+	switch left := left.(type) {
+	case *object.Integer:
+		right, ok := right.(*object.Integer)
+		if !ok {
+			return nil, false
+		}
+		return foldIntegerInfix(operator, left.Value, right.Value)
+
+	case *object.String:
+		right, ok := right.(*object.String)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "+":
+			return &object.String{Value: left.Value + right.Value}, true
+		case "==":
+			return object.NativeBoolToBooleanObject(left.Value == right.Value), true
+		case "!=":
+			return object.NativeBoolToBooleanObject(left.Value != right.Value), true
+		}
+
+	case *object.Boolean:
+		right, ok := right.(*object.Boolean)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "==":
+			return object.NativeBoolToBooleanObject(left.Value == right.Value), true
+		case "!=":
+			return object.NativeBoolToBooleanObject(left.Value != right.Value), true
+		}
+	}
+
+	return nil, false
+}
+
+func foldIntegerInfix(operator string, left, right int64) (object.Object, bool) {
+	switch operator {
+	case "+":
+		return &object.Integer{Value: left + right}, true
+	case "-":
+		return &object.Integer{Value: left - right}, true
+	case "*":
+		return &object.Integer{Value: left * right}, true
+	case "/":
+		if right == 0 {
+			return nil, false
+		}
+		return &object.Integer{Value: left / right}, true
+	case "<":
+		return object.NativeBoolToBooleanObject(left < right), true
+	case ">":
+		return object.NativeBoolToBooleanObject(left > right), true
+	case "==":
+		return object.NativeBoolToBooleanObject(left == right), true
+	case "!=":
+		return object.NativeBoolToBooleanObject(left != right), true
+	}
+	return nil, false
+}
+
+// isTruthy matches the VM's notion of truth for the values constantValue
+// returns.
+func isTruthy(obj object.Object) bool {
+	if b, ok := obj.(*object.Boolean); ok {
+		return b.Value
+	}
+	return true
+}
+
+// emitConstant pushes a value constantValue returned.
+func (c *Compiler) emitConstant(obj object.Object) {
+	switch obj {
+	case object.TRUE:
+		c.emit(code.OpTrue)
+	case object.FALSE:
+		c.emit(code.OpFalse)
+	default:
+		c.loadConstant(c.addConstant(obj))
+	}
+}
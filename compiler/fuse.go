@@ -0,0 +1,89 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// compareJumps maps each comparison to the superinstruction that makes it
+// and then jumps like OpJumpNotTruthy.
+var compareJumps = map[code.Opcode]code.Opcode{
+	code.OpEqual:       code.OpEqualJump,
+	code.OpNotEqual:    code.OpNotEqualJump,
+	code.OpLessThan:    code.OpLessThanJump,
+	code.OpGreaterThan: code.OpGreaterThanJump,
+}
+
+// fuse replaces sequences of instructions that run together often, like the
+// n - 1 and n < 2 of recursive functions, with one superinstruction each so
+// the VM dispatches once instead of two or three times. constants is the
+// pool the instructions load from. A sequence is only fused when no jump
+// lands in the middle of it, and takes the position of the instruction in
+// it that can fail.
+func fuse(ins code.Instructions, sourceMap *code.SourceMap, constants []object.Object) (code.Instructions, *code.SourceMap) {
+	list, end, ok := decode(ins, sourceMap)
+	if !ok {
+		return ins, sourceMap
+	}
+
+	targeted := map[*instruction]bool{}
+	for _, in := range list {
+		if in.target != nil {
+			targeted[in.target] = true
+		}
+	}
+
+	// following returns the n instructions after in, or nil if a jump lands
+	// on any of them
+	following := func(in *instruction, n int) []*instruction {
+		after := []*instruction{}
+		for next := in.next; len(after) < n; next = next.next {
+			if next == end || targeted[next] {
+				return nil
+			}
+			after = append(after, next)
+		}
+		return after
+	}
+
+	for _, in := range list {
+		if in.removed {
+			continue
+		}
+
+		switch in.op {
+		case code.OpGetLocal:
+			after := following(in, 2)
+			if after == nil || after[0].op != code.OpConstant {
+				continue
+			}
+			constant := after[0].operands[0]
+
+			switch {
+			case after[1].op == code.OpSub:
+				in.op, in.operands = code.OpGetLocalConstSub, []int{in.operands[0], constant}
+			case after[1].op == code.OpAdd && isOne(constants[constant]):
+				in.op = code.OpIncLocal
+			default:
+				continue
+			}
+			in.line, in.column = after[1].line, after[1].column
+			after[0].removed, after[1].removed = true, true
+
+		case code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan:
+			after := following(in, 1)
+			if after == nil || after[0].op != code.OpJumpNotTruthy {
+				continue
+			}
+			in.op, in.operands, in.target = compareJumps[in.op], []int{0}, after[0].target
+			after[0].removed = true
+		}
+	}
+
+	return encode(list, end, sourceMap)
+}
+
+func isOne(obj object.Object) bool {
+	integer, ok := obj.(*object.Integer)
+	return ok && integer.Value == 1
+}
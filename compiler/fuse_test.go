@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"testing"
+
+	"monkey/code"
+	"monkey/object"
+)
+
+func TestFuse(t *testing.T) {
+	constants := []object.Object{
+		&object.Integer{Value: 2},
+		&object.Integer{Value: 1},
+	}
+
+	tests := []struct {
+		name     string
+		input    []code.Instructions
+		expected []code.Instructions
+	}{
+		{
+			name: "local minus constant",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSub),
+				code.Make(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocalConstSub, 0, 0),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "local plus one",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 3),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpGetLocal, 3),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpIncLocal, 3),
+				code.Make(code.OpGetLocal, 3),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpAdd),
+			},
+		},
+		{
+			name: "compare and jump",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),       // 0000
+				code.Make(code.OpConstant, 0),       // 0002
+				code.Make(code.OpLessThan),          // 0005
+				code.Make(code.OpJumpNotTruthy, 12), // 0006
+				code.Make(code.OpGetLocal, 0),       // 0009
+				code.Make(code.OpReturnValue),       // 0011
+				code.Make(code.OpGetLocal, 0),       // 0012
+				code.Make(code.OpConstant, 1),       // 0014
+				code.Make(code.OpSub),               // 0017
+				code.Make(code.OpReturnValue),       // 0018
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),            // 0000
+				code.Make(code.OpConstant, 0),            // 0002
+				code.Make(code.OpLessThanJump, 11),       // 0005
+				code.Make(code.OpGetLocal, 0),            // 0008
+				code.Make(code.OpReturnValue),            // 0010
+				code.Make(code.OpGetLocalConstSub, 0, 1), // 0011
+				code.Make(code.OpReturnValue),            // 0015
+			},
+		},
+		{
+			name: "jump into the sequence",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 9), // 0001
+				code.Make(code.OpGetLocal, 0),      // 0004
+				code.Make(code.OpConstant, 0),      // 0006
+				code.Make(code.OpSub),              // 0009
+				code.Make(code.OpReturnValue),      // 0010
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 9), // 0001
+				code.Make(code.OpGetLocal, 0),      // 0004
+				code.Make(code.OpConstant, 0),      // 0006
+				code.Make(code.OpSub),              // 0009
+				code.Make(code.OpReturnValue),      // 0010
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		fused, _ := fuse(concatInstruction(tt.input), nil, constants)
+
+		err := testInstructions(tt.expected, fused)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
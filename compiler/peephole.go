@@ -0,0 +1,187 @@
+package compiler
+
+import "monkey/code"
+
+// instruction is one decoded instruction of the peephole pass. A jump points
+// at the instruction it lands on rather than at an offset, so instructions
+// can be dropped and the jumps rewritten once the offsets settle.
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	target   *instruction // Where the jump operand lands, nil if there is none
+	next     *instruction // The instruction after this one, removed or not
+	removed  bool
+	pinned   bool // An entry of an OpSelect jump table, which must stay in place
+
+	// The source position the instruction was compiled from
+	line, column int
+}
+
+// jumpOperand returns which operand of op is a jump target.
+func jumpOperand(op code.Opcode) (int, bool) {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpTruthy,
+		code.OpEqualJump, code.OpNotEqualJump, code.OpLessThanJump, code.OpGreaterThanJump:
+		return 0, true
+	case code.OpMatchVariant, code.OpMatchVariantWide:
+		return 2, true
+	}
+	return 0, false
+}
+
+// optimize runs the peephole pass over ins until nothing changes:
+//
+//   - a jump to an OpJump lands where that one goes instead
+//   - an OpJump to the instruction right after it is dropped
+//   - OpNull followed by OpPop is dropped
+//   - OpBang followed by OpJumpNotTruthy becomes OpJumpTruthy
+//
+// Instructions that some jump lands on are left alone wherever dropping
+// them would change what that jump does. keepPops leaves OpNull and OpPop
+// in place for the program, whose last popped value the REPL prints.
+//
+// It returns the source map of the new instructions along with them.
+func optimize(ins code.Instructions, sourceMap *code.SourceMap, keepPops bool) (code.Instructions, *code.SourceMap) {
+	list, end, ok := decode(ins, sourceMap)
+	if !ok {
+		return ins, sourceMap
+	}
+
+	for changed := true; changed; {
+		changed = false
+
+		targeted := map[*instruction]bool{}
+		for _, in := range list {
+			if in.target == nil || in.removed {
+				continue
+			}
+			target := live(in.target)
+			for hops := 0; target.op == code.OpJump && target != end && hops < len(list); hops++ {
+				target = live(target.target)
+			}
+			if target != live(in.target) {
+				changed = true
+			}
+			in.target = target
+			targeted[target] = true
+		}
+
+		for _, in := range list {
+			if in.removed {
+				continue
+			}
+			next := live(in.next)
+
+			switch {
+			case in.op == code.OpJump && !in.pinned && in.target == next:
+				in.removed = true
+				changed = true
+
+			case in.op == code.OpNull && next.op == code.OpPop && next != end && !targeted[next] && !keepPops:
+				in.removed, next.removed = true, true
+				changed = true
+
+			case in.op == code.OpBang && next.op == code.OpJumpNotTruthy && next != end && !targeted[next]:
+				in.op, in.operands, in.target = code.OpJumpTruthy, []int{0}, next.target
+				next.removed = true
+				changed = true
+			}
+		}
+	}
+
+	return encode(list, end, sourceMap)
+}
+
+// live returns in, or the first instruction after it that was not removed.
+func live(in *instruction) *instruction {
+	for in.removed {
+		in = in.next
+	}
+	return in
+}
+
+// decode splits ins into instructions and links each jump to the one it
+// lands on, and gives each the position sourceMap has for it. end stands
+// for the offset right after the last instruction. It reports false if ins
+// holds something the compiler does not emit.
+func decode(ins code.Instructions, sourceMap *code.SourceMap) ([]*instruction, *instruction, bool) {
+	list := []*instruction{}
+	at := map[int]*instruction{}
+	pinned := 0
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return nil, nil, false
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		in := &instruction{op: code.Opcode(ins[i]), operands: operands}
+		if pos, ok := sourceMap.Position(i); ok {
+			in.line, in.column = pos.Line, pos.Column
+		}
+		if in.op == code.OpJump && pinned > 0 {
+			in.pinned = true
+			pinned--
+		}
+		if in.op == code.OpSelect {
+			pinned = operands[0] + operands[1]
+		}
+
+		at[i] = in
+		list = append(list, in)
+		i += 1 + read
+	}
+
+	end := &instruction{}
+	at[len(ins)] = end
+	for i, in := range list {
+		if i+1 < len(list) {
+			in.next = list[i+1]
+		} else {
+			in.next = end
+		}
+		if n, ok := jumpOperand(in.op); ok {
+			target, ok := at[in.operands[n]]
+			if !ok {
+				return nil, nil, false
+			}
+			in.target = target
+		}
+	}
+
+	return list, end, true
+}
+
+// encode lays out the instructions that were not removed, pointing each
+// jump at the new offset of its target, and maps them to their positions
+// in the file of sourceMap.
+func encode(list []*instruction, end *instruction, sourceMap *code.SourceMap) (code.Instructions, *code.SourceMap) {
+	offsets := map[*instruction]int{}
+	size := 0
+	for _, in := range list {
+		if in.removed {
+			continue
+		}
+		offsets[in] = size
+		size += len(code.Make(in.op, in.operands...))
+	}
+	offsets[end] = size
+
+	out := make(code.Instructions, 0, size)
+	positions := &code.SourceMap{}
+	if sourceMap != nil {
+		positions.File = sourceMap.File
+	}
+	for _, in := range list {
+		if in.removed {
+			continue
+		}
+		if n, ok := jumpOperand(in.op); ok {
+			in.operands[n] = offsets[live(in.target)]
+		}
+		positions.Add(len(out), in.line, in.column)
+		out = append(out, code.Make(in.op, in.operands...)...)
+	}
+	return out, positions
+}
@@ -0,0 +1,187 @@
+package compiler
+
+import (
+	"testing"
+
+	"monkey/code"
+)
+
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []code.Instructions
+		keepPops bool
+		expected []code.Instructions
+	}{
+		{
+			name: "jump to the next instruction",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJump, 4),
+				code.Make(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "jump chain",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpReturnValue),      // 0005
+				code.Make(code.OpNull),             // 0006
+				code.Make(code.OpReturnValue),      // 0007
+				code.Make(code.OpJump, 11),         // 0008
+				code.Make(code.OpJump, 14),         // 0011
+				code.Make(code.OpFalse),            // 0014
+				code.Make(code.OpReturnValue),      // 0015
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpNull),             // 0004
+				code.Make(code.OpReturnValue),      // 0005
+				code.Make(code.OpNull),             // 0006
+				code.Make(code.OpReturnValue),      // 0007
+				code.Make(code.OpFalse),            // 0008
+				code.Make(code.OpReturnValue),      // 0009
+			},
+		},
+		{
+			name: "null then pop",
+			input: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "null then pop in the program",
+			input: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+			keepPops: true,
+			expected: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "pop that a jump lands on",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpTrue),             // 0004
+				code.Make(code.OpJump, 9),          // 0005
+				code.Make(code.OpNull),             // 0008
+				code.Make(code.OpPop),              // 0009
+				code.Make(code.OpReturn),           // 0010
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0001
+				code.Make(code.OpTrue),             // 0004
+				code.Make(code.OpJump, 9),          // 0005
+				code.Make(code.OpNull),             // 0008
+				code.Make(code.OpPop),              // 0009
+				code.Make(code.OpReturn),           // 0010
+			},
+		},
+		{
+			name: "negated condition",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpBang),             // 0001
+				code.Make(code.OpJumpNotTruthy, 7), // 0002
+				code.Make(code.OpNull),             // 0005
+				code.Make(code.OpReturnValue),      // 0006
+				code.Make(code.OpFalse),            // 0007
+				code.Make(code.OpReturnValue),      // 0008
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),          // 0000
+				code.Make(code.OpJumpTruthy, 6), // 0001
+				code.Make(code.OpNull),          // 0004
+				code.Make(code.OpReturnValue),   // 0005
+				code.Make(code.OpFalse),         // 0006
+				code.Make(code.OpReturnValue),   // 0007
+			},
+		},
+		{
+			name: "negated condition that a jump lands between",
+			input: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 5), // 0001
+				code.Make(code.OpBang),             // 0004
+				code.Make(code.OpJumpNotTruthy, 8), // 0005
+				code.Make(code.OpReturn),           // 0008
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpTrue),             // 0000
+				code.Make(code.OpJumpNotTruthy, 5), // 0001
+				code.Make(code.OpBang),             // 0004
+				code.Make(code.OpJumpNotTruthy, 8), // 0005
+				code.Make(code.OpReturn),           // 0008
+			},
+		},
+		{
+			name: "select jump table",
+			input: []code.Instructions{
+				code.Make(code.OpSelect, 1, 0), // 0000
+				code.Make(code.OpJump, 7),      // 0004
+				code.Make(code.OpPop),          // 0007
+				code.Make(code.OpNull),         // 0008
+				code.Make(code.OpJump, 12),     // 0009
+				code.Make(code.OpReturnValue),  // 0012
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpSelect, 1, 0), // 0000
+				code.Make(code.OpJump, 7),      // 0004
+				code.Make(code.OpPop),          // 0007
+				code.Make(code.OpNull),         // 0008
+				code.Make(code.OpReturnValue),  // 0009
+			},
+		},
+		{
+			name: "match arm after removed instructions",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),            // 0000
+				code.Make(code.OpMatchVariant, 0, 0, 12), // 0002
+				code.Make(code.OpNull),                   // 0008
+				code.Make(code.OpPop),                    // 0009
+				code.Make(code.OpTrue),                   // 0010
+				code.Make(code.OpReturnValue),            // 0011
+				code.Make(code.OpPop),                    // 0012
+				code.Make(code.OpFalse),                  // 0013
+				code.Make(code.OpReturnValue),            // 0014
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),            // 0000
+				code.Make(code.OpMatchVariant, 0, 0, 10), // 0002
+				code.Make(code.OpTrue),                   // 0008
+				code.Make(code.OpReturnValue),            // 0009
+				code.Make(code.OpPop),                    // 0010
+				code.Make(code.OpFalse),                  // 0011
+				code.Make(code.OpReturnValue),            // 0012
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		optimized, _ := optimize(concatInstruction(tt.input), nil, tt.keepPops)
+
+		err := testInstructions(tt.expected, optimized)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"maps"
+	"math"
+	"slices"
+
+	"monkey/code"
+	"monkey/object"
+)
+
+// The bytecode file format, version 4. Numbers are unsigned varints unless
+// noted otherwise, and strings are their length followed by their bytes.
+//
+//	magic        "MKBC"
+//	version      big-endian uint16
+//	instructions length and bytes of the program
+//	debug info   of the program
+//	constants    count, then each as a tag byte and its fields
+//	checksum     big-endian CRC-32 (IEEE) of everything before it
+//
+// Debug info is a name, a local count and each local's name, start and
+// end, a free variable count and names, a source map, and the count of
+// closure sites followed by the offset and debug info of each, in the
+// order of their offsets. A source map is its file name, its entry count,
+// and for each entry the offset from the entry before it, the line and the
+// column. The constants are:
+//
+//	'i' integer            signed varint
+//	's' string             string
+//	'f' compiled function  instructions, locals, parameters, generator byte
+//	't' struct type        name, field count, fields
+//	'e' enum               name, variant count, then each variant's name,
+//	                       field count and fields
+//
+// Struct types are written without methods, which OpMethod attaches to the
+// copies OpStruct makes when the program runs.
+const (
+	bytecodeMagic   = "MKBC"
+	BytecodeVersion = 6 // 6 added OpSpawnWide, 5 OpStruct and the field caches of OpGetField
+)
+
+const (
+	tagInteger  = 'i'
+	tagString   = 's'
+	tagFunction = 'f'
+	tagStruct   = 't'
+	tagEnum     = 'e'
+)
+
+var errTruncated = errors.New("bytecode: unexpected end of data")
+
+// MarshalBinary encodes b in the bytecode file format.
+func (b *Bytecode) MarshalBinary() ([]byte, error) {
+	w := &bytecodeWriter{}
+	w.buf.WriteString(bytecodeMagic)
+	w.buf.Write(binary.BigEndian.AppendUint16(nil, BytecodeVersion))
+
+	w.bytes(b.Instructions)
+	w.debugInfo(b.Debug)
+
+	w.uint(len(b.Constants))
+	for i, obj := range b.Constants {
+		if err := w.constant(obj); err != nil {
+			return nil, fmt.Errorf("bytecode: constant %d: %w", i, err)
+		}
+	}
+
+	w.buf.Write(binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(w.buf.Bytes())))
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes data written by MarshalBinary into b. It fails on
+// data from another version of the format and on data whose checksum does
+// not match.
+func (b *Bytecode) UnmarshalBinary(data []byte) error {
+	header := len(bytecodeMagic) + 2
+	if len(data) < header+4 || string(data[:len(bytecodeMagic)]) != bytecodeMagic {
+		return errors.New("bytecode: not a bytecode file")
+	}
+	if version := binary.BigEndian.Uint16(data[len(bytecodeMagic):]); version != BytecodeVersion {
+		return fmt.Errorf("bytecode: unsupported version %d, want %d", version, BytecodeVersion)
+	}
+
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return errors.New("bytecode: checksum mismatch")
+	}
+
+	r := &bytecodeReader{data: body[header:]}
+	decoded := &Bytecode{}
+	decoded.Instructions = code.Instructions(r.bytes())
+	decoded.Debug = r.debugInfo(0)
+
+	n := r.uint()
+	if r.err == nil && n > len(r.data) {
+		// Every constant takes at least a byte
+		r.err = errTruncated
+	}
+	decoded.Constants = make([]object.Object, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		decoded.Constants = append(decoded.Constants, r.constant())
+	}
+
+	if r.err == nil && len(r.data) != 0 {
+		r.err = errors.New("bytecode: unexpected data after the constants")
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	*b = *decoded
+	return nil
+}
+
+type bytecodeWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *bytecodeWriter) uint(n int) {
+	w.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (w *bytecodeWriter) bytes(b []byte) {
+	w.uint(len(b))
+	w.buf.Write(b)
+}
+
+func (w *bytecodeWriter) string(s string) {
+	w.bytes([]byte(s))
+}
+
+func (w *bytecodeWriter) strings(ss []string) {
+	w.uint(len(ss))
+	for _, s := range ss {
+		w.string(s)
+	}
+}
+
+func (w *bytecodeWriter) sourceMap(m *code.SourceMap) {
+	if m == nil {
+		m = &code.SourceMap{}
+	}
+
+	w.string(m.File)
+	w.uint(len(m.Entries))
+	offset := 0
+	for _, e := range m.Entries {
+		w.uint(e.Offset - offset)
+		w.uint(e.Line)
+		w.uint(e.Column)
+		offset = e.Offset
+	}
+}
+
+func (w *bytecodeWriter) debugInfo(d *object.DebugInfo) {
+	if d == nil {
+		d = &object.DebugInfo{}
+	}
+
+	w.string(d.Name)
+	w.uint(len(d.Locals))
+	for _, local := range d.Locals {
+		w.string(local.Name)
+		w.uint(local.Start)
+		w.uint(local.End)
+	}
+	w.strings(d.Free)
+	w.sourceMap(d.SourceMap)
+
+	offsets := slices.Sorted(maps.Keys(d.Closures))
+	w.uint(len(offsets))
+	for _, offset := range offsets {
+		w.uint(offset)
+		w.debugInfo(d.Closures[offset])
+	}
+}
+
+func (w *bytecodeWriter) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		w.buf.WriteByte(tagInteger)
+		w.buf.Write(binary.AppendVarint(nil, obj.Value))
+
+	case *object.String:
+		w.buf.WriteByte(tagString)
+		w.string(obj.Value)
+
+	case *object.CompiledFunction:
+		w.buf.WriteByte(tagFunction)
+		w.bytes(obj.Instructions)
+		w.uint(obj.NumLocals)
+		w.uint(obj.NumParameters)
+		if obj.Generator {
+			w.buf.WriteByte(1)
+		} else {
+			w.buf.WriteByte(0)
+		}
+
+	case *object.StructType:
+		w.buf.WriteByte(tagStruct)
+		w.string(obj.Name)
+		w.strings(obj.Fields)
+
+	case *object.Enum:
+		w.buf.WriteByte(tagEnum)
+		w.string(obj.Name)
+		w.uint(len(obj.Variants))
+		for _, v := range obj.Variants {
+			w.string(v.Name)
+			w.strings(v.Fields)
+		}
+
+	default:
+		return fmt.Errorf("cannot encode %s", obj.Type())
+	}
+	return nil
+}
+
+// bytecodeReader reads what bytecodeWriter wrote. After the first failure
+// err is set and every read returns a zero value.
+type bytecodeReader struct {
+	data []byte
+	err  error
+}
+
+func (r *bytecodeReader) uint() int {
+	if r.err != nil {
+		return 0
+	}
+	n, read := binary.Uvarint(r.data)
+	if read <= 0 || n > math.MaxInt {
+		r.err = errTruncated
+		return 0
+	}
+	r.data = r.data[read:]
+	return int(n)
+}
+
+func (r *bytecodeReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = errTruncated
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *bytecodeReader) bytes() []byte {
+	n := r.uint()
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errTruncated
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, r.data)
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *bytecodeReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *bytecodeReader) strings() []string {
+	n := r.uint()
+	ss := []string{}
+	for i := 0; i < n && r.err == nil; i++ {
+		ss = append(ss, r.string())
+	}
+	return ss
+}
+
+func (r *bytecodeReader) sourceMap() *code.SourceMap {
+	m := &code.SourceMap{File: r.string()}
+	n := r.uint()
+	offset := 0
+	for i := 0; i < n && r.err == nil; i++ {
+		offset += r.uint()
+		line, column := r.uint(), r.uint()
+		m.Entries = append(m.Entries, code.SourceMapEntry{Offset: offset, Line: line, Column: column})
+	}
+	return m
+}
+
+// maxDebugDepth bounds how deeply debug info may nest, so that corrupt
+// data cannot recurse without end.
+const maxDebugDepth = 1000
+
+func (r *bytecodeReader) debugInfo(depth int) *object.DebugInfo {
+	d := &object.DebugInfo{Name: r.string(), Locals: []object.Local{}, Closures: map[int]*object.DebugInfo{}}
+	n := r.uint()
+	for i := 0; i < n && r.err == nil; i++ {
+		d.Locals = append(d.Locals, object.Local{Name: r.string(), Start: r.uint(), End: r.uint()})
+	}
+	d.Free = r.strings()
+	d.SourceMap = r.sourceMap()
+
+	n = r.uint()
+	if r.err == nil && depth >= maxDebugDepth && n > 0 {
+		r.err = errors.New("bytecode: function literals nested too deeply")
+	}
+	for i := 0; i < n && r.err == nil; i++ {
+		offset := r.uint()
+		d.Closures[offset] = r.debugInfo(depth + 1)
+	}
+	return d
+}
+
+func (r *bytecodeReader) constant() object.Object {
+	switch tag := r.byte(); tag {
+	case tagInteger:
+		if r.err != nil {
+			return nil
+		}
+		value, read := binary.Varint(r.data)
+		if read <= 0 {
+			r.err = errTruncated
+			return nil
+		}
+		r.data = r.data[read:]
+		return &object.Integer{Value: value}
+
+	case tagString:
+		return &object.String{Value: r.string()}
+
+	case tagFunction:
+		fn := &object.CompiledFunction{Instructions: r.bytes()}
+		fn.NumLocals = r.uint()
+		fn.NumParameters = r.uint()
+		fn.Generator = r.byte() == 1
+		return fn
+
+	case tagStruct:
+		name := r.string()
+		return &object.StructType{Name: name, Fields: r.strings(), Methods: map[string]object.Object{}}
+
+	case tagEnum:
+		enum := &object.Enum{Name: r.string()}
+		n := r.uint()
+		for i := 0; i < n && r.err == nil; i++ {
+			name := r.string()
+			enum.Variants = append(enum.Variants, object.NewVariantConstructor(enum.Name, name, r.strings()))
+		}
+		return enum
+
+	default:
+		if r.err == nil {
+			r.err = fmt.Errorf("bytecode: unknown constant tag %q", tag)
+		}
+		return nil
+	}
+}
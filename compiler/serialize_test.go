@@ -0,0 +1,113 @@
+package compiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"monkey/code"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `struct Point { x, y }
+	impl Point { fn norm(p) { p.x * p.x + p.y * p.y } }
+	enum Shape { Circle(r), Rect(w, h), Empty }
+	let area = fn(s) { match (s) { Circle(r) { 3 * r * r } Rect(w, h) { w * h } Empty { 0 } } };
+	let counter = fn*(n) { let step = fn(x) { x - 1 }; yield n; yield step(n) };
+	let big = -9223372036854775807 - 1;
+	let one = fn() { 1 };
+	[Point(3, 4).norm(), area(Shape.Rect(2, 3)), "mon" + "key", big, 1 in set([1])]`
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := New()
+	comp.SetFile("shapes.mk")
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %s", err)
+	}
+
+	decoded := &Bytecode{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %s", err)
+	}
+
+	if !reflect.DeepEqual(bytecode.Instructions, decoded.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%s\ngot=%s", bytecode.Instructions, decoded.Instructions)
+	}
+	if !reflect.DeepEqual(bytecode.Debug, decoded.Debug) {
+		t.Errorf("wrong debug info.\nwant=%+v\ngot=%+v", bytecode.Debug, decoded.Debug)
+	}
+	for offset, debug := range bytecode.Debug.Closures {
+		if debug.SourceMap.File != "shapes.mk" {
+			t.Errorf("closure at %d: source map of the wrong file %q", offset, debug.SourceMap.File)
+		}
+	}
+	if len(bytecode.Constants) != len(decoded.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d", len(bytecode.Constants), len(decoded.Constants))
+	}
+
+	kinds := map[object.ObjectType]bool{}
+	for i, want := range bytecode.Constants {
+		got := decoded.Constants[i]
+		kinds[want.Type()] = true
+
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("constant %d: want=%s, got=%s", i, want.Inspect(), got.Inspect())
+		}
+	}
+
+	for _, kind := range []object.ObjectType{object.INTEGER_OBJ, object.STRING_OBJ, object.COMPILED_FUNCTIN_OBJ, object.STRUCT_TYPE_OBJ, object.ENUM_OBJ} {
+		if !kinds[kind] {
+			t.Errorf("the program has no %s constant to round-trip", kind)
+		}
+	}
+}
+
+func TestBytecodeDecodeErrors(t *testing.T) {
+	bytecode := &Bytecode{
+		Instructions: code.Make(code.OpConstant, 0),
+		Constants:    []object.Object{&object.Integer{Value: 1}},
+	}
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %s", err)
+	}
+
+	corrupt := append([]byte{}, data...)
+	corrupt[8] ^= 0xff
+
+	newer := append([]byte{}, data...)
+	newer[5] = BytecodeVersion + 1
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"source", []byte("let x = 1;"), "bytecode: not a bytecode file"},
+		{"empty", nil, "bytecode: not a bytecode file"},
+		{"version", newer, "bytecode: unsupported version 7, want 6"},
+		{"checksum", corrupt, "bytecode: checksum mismatch"},
+		{"truncated", data[:len(data)-1], "bytecode: checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		err := (&Bytecode{}).UnmarshalBinary(tt.data)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+
+	_, err = (&Bytecode{Constants: []object.Object{&object.Array{}}}).MarshalBinary()
+	if err == nil || !strings.Contains(err.Error(), "cannot encode ARRAY") {
+		t.Errorf("expected an error encoding an array constant, got %v", err)
+	}
+}
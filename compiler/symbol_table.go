@@ -1,5 +1,10 @@
 package compiler
 
+import (
+	"maps"
+	"slices"
+)
+
 type SymbolScope string
 
 const (
@@ -21,6 +26,8 @@ type SymbolTable struct {
 	FreeSymbols    []Symbol
 	store          map[string]Symbol
 	numDefinitions int
+	names          []string // Of the definitions, by index
+	used           []bool   // Whether each definition has been resolved
 }
 
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
@@ -49,12 +56,17 @@ func (s *SymbolTable) Define(name string) Symbol {
 		symbol.Scope = LocalScope
 	}
 	s.store[name] = symbol
+	s.names = append(s.names, name)
+	s.used = append(s.used, false)
 	s.numDefinitions++
 	return symbol
 }
 
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
+	if ok {
+		s.markUsed(obj)
+	}
 	if !ok && s.Outer != nil {
 		obj, ok = s.Outer.Resolve(name)
 		if !ok {
@@ -86,3 +98,58 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	s.store[name] = symbol
 	return symbol
 }
+
+// lookup finds the symbol name resolves to and the table that holds it,
+// without capturing it as a free variable or marking it used like Resolve.
+func (s *SymbolTable) lookup(name string) (Symbol, *SymbolTable, bool) {
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol, table, true
+		}
+	}
+	return Symbol{}, nil, false
+}
+
+// markUsed records that the definition of symbol, which s holds, is read.
+func (s *SymbolTable) markUsed(symbol Symbol) {
+	if (symbol.Scope == LocalScope || symbol.Scope == GlobalScope) && symbol.Index < len(s.used) {
+		s.used[symbol.Index] = true
+	}
+}
+
+// checkpoint returns a function that undoes everything defined in s after
+// the call.
+func (s *SymbolTable) checkpoint() func() {
+	store := maps.Clone(s.store)
+	numDefinitions, numFree := s.numDefinitions, len(s.FreeSymbols)
+	names, used := slices.Clone(s.names), slices.Clone(s.used)
+
+	return func() {
+		s.store = store
+		s.numDefinitions = numDefinitions
+		s.FreeSymbols = s.FreeSymbols[:numFree]
+		s.names, s.used = names, used
+	}
+}
+
+// block starts a block, like the body of a match arm, whose variables end
+// with it. It returns the function that ends the block, after which the
+// names defined in it refer to what they did before. The variables keep
+// their slots.
+func (s *SymbolTable) block() func() {
+	outer := maps.Clone(s.store)
+	start := s.numDefinitions
+
+	return func() {
+		for name, symbol := range s.store {
+			if (symbol.Scope != LocalScope && symbol.Scope != GlobalScope) || symbol.Index < start {
+				continue
+			}
+			if previous, ok := outer[name]; ok {
+				s.store[name] = previous
+			} else {
+				delete(s.store, name)
+			}
+		}
+	}
+}
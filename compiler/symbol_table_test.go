@@ -134,8 +134,8 @@ func TestDefineResolveBuiltins(t *testing.T) {
 		for _, sym := range expected {
 			result, ok := table.Resolve(sym.Name)
 			if !ok {
-				continue
 				t.Errorf("name %s not resolvable", sym.Name)
+				continue
 			}
 			if result != sym {
 				t.Errorf("expected %s to resolve to %+v, got=%+v",
@@ -0,0 +1,103 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// nowarn is the comment that turns off the warnings about its line, as in
+//
+//	let len = fn(x) { 0 }; # nowarn
+const nowarn = "nowarn"
+
+// declaration is a let or a parameter of the function being compiled, to
+// warn about when the function ends if nothing reads it.
+type declaration struct {
+	symbol Symbol
+	token  token.Token
+	kind   string // "variable" or "parameter"
+}
+
+// suppress turns off the warnings about the lines of the program that end
+// with a nowarn comment. Anything after the word, or a colon right after
+// it, is a note for the reader.
+func (c *Compiler) suppress(comments []*ast.Comment) {
+	c.suppressed = map[int]bool{}
+	for _, comment := range comments {
+		words := strings.Fields(strings.TrimPrefix(comment.Token.Literal, "#"))
+		if len(words) > 0 && strings.TrimSuffix(words[0], ":") == nowarn {
+			c.suppressed[comment.Token.Line] = true
+		}
+	}
+}
+
+// declare defines the let or parameter name written at tok, warning if it
+// hides a builtin or a variable of an enclosing scope. A let that defines
+// a name again in the same scope hides nothing that is still in use.
+func (c *Compiler) declare(tok token.Token, name, kind string) Symbol {
+	if outer, table, ok := c.symbolTable.lookup(name); ok {
+		switch {
+		case outer.Scope == BuiltinScope:
+			c.warn(tok, fmt.Sprintf("%s %s shadows the builtin %s", kind, name, name))
+		case table != c.symbolTable || outer.Scope == FreeScope || outer.Scope == FunctionScope:
+			c.warn(tok, fmt.Sprintf("%s %s shadows a variable of an enclosing scope", kind, name))
+		}
+	}
+
+	symbol := c.symbolTable.Define(name)
+
+	// Globals may be read by code compiled later, like the next line of
+	// the REPL, and names starting with _ are unused on purpose
+	if c.scopeIndex > 0 && !strings.HasPrefix(name, "_") {
+		scope := &c.scopes[c.scopeIndex]
+		scope.declarations = append(scope.declarations, declaration{symbol: symbol, token: tok, kind: kind})
+	}
+	return symbol
+}
+
+// warnUnused warns about the lets and parameters of the function being
+// compiled that nothing read.
+func (c *Compiler) warnUnused() {
+	for _, d := range c.scopes[c.scopeIndex].declarations {
+		if !c.symbolTable.used[d.symbol.Index] {
+			c.warn(d.token, fmt.Sprintf("unused %s %s", d.kind, d.symbol.Name))
+		}
+	}
+}
+
+// warnDuplicateKeys warns about each key of a hash literal that is a
+// constant equal to a key written before it, which one of them replaces.
+func (c *Compiler) warnDuplicateKeys(keys []ast.Expression) {
+	ordered := append([]ast.Expression{}, keys...)
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := nodeToken(ordered[i]), nodeToken(ordered[j])
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	seen := map[object.HashKey]bool{}
+	for _, key := range ordered {
+		value, ok := constantValue(key)
+		if !ok {
+			continue
+		}
+		hashable, ok := value.(object.Hashable)
+		if !ok {
+			continue
+		}
+
+		if seen[hashable.HashKey()] {
+			name := value.Inspect()
+			if str, ok := value.(*object.String); ok {
+				name = strconv.Quote(str.Value)
+			}
+			c.warn(nodeToken(key), fmt.Sprintf("duplicate key %s in hash literal", name))
+		}
+		seen[hashable.HashKey()] = true
+	}
+}
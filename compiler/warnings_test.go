@@ -0,0 +1,73 @@
+package compiler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn(x) { 1 }", []string{"1:4: unused parameter x"}},
+		{"fn(x, _y) { let z = x; 2 }", []string{"1:17: unused variable z"}},
+		{"fn(x) { fn() { x } }", []string{}},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };", []string{}},
+		{"fn(x) { if (false) { x } }", []string{}},
+		{"fn(x) { return 1; x }", []string{"1:19: unreachable code"}},
+		{"let x = 1; let x = 2;", []string{}},
+
+		{"let len = 1;", []string{"1:5: variable len shadows the builtin len"}},
+		{"fn(puts) { puts }", []string{"1:4: parameter puts shadows the builtin puts"}},
+		{"let x = 1; fn(x) { x }", []string{"1:15: parameter x shadows a variable of an enclosing scope"}},
+		{"fn(x) { fn() { let x = 2; x } }", []string{"1:4: unused parameter x", "1:20: variable x shadows a variable of an enclosing scope"}},
+		{"let f = fn() { let f = 1; f };", []string{"1:20: variable f shadows a variable of an enclosing scope"}},
+		{"fn(x) { x; fn() { x; let x = 2; x } }", []string{"1:26: variable x shadows a variable of an enclosing scope"}},
+
+		{`{1: "a", "1": "b", 1: "c"}`, []string{"1:20: duplicate key 1 in hash literal"}},
+		{`{"a": 1, "a": 2, "a": 3}`, []string{`1:10: duplicate key "a" in hash literal`, `1:18: duplicate key "a" in hash literal`}},
+		{`{true: 1, 2 - 1: 2, 1: 3}`, []string{"1:21: duplicate key 1 in hash literal"}},
+		{`fn(x) { {x: 1, x: 2} }`, []string{}},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		warnings := []string{}
+		for _, w := range compiler.Warnings() {
+			warnings = append(warnings, w.String())
+		}
+		if fmt.Sprint(warnings) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: wrong warnings. want=%q, got=%q", tt.input, tt.expected, warnings)
+		}
+	}
+}
+
+func TestSuppressedWarnings(t *testing.T) {
+	input := `let len = 1; # nowarn
+let puts = 1; # nowarn: kept for the old callers
+let f = fn(x) {
+  let y = 2; # nowarn
+  let z = 3;
+  x
+};
+let first = 1; # nowarnings`
+
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := []string{"5:7: unused variable z", "8:5: variable first shadows the builtin first"}
+	warnings := []string{}
+	for _, w := range compiler.Warnings() {
+		warnings = append(warnings, w.String())
+	}
+	if fmt.Sprint(warnings) != fmt.Sprint(expected) {
+		t.Errorf("wrong warnings. want=%q, got=%q", expected, warnings)
+	}
+}
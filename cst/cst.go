@@ -0,0 +1,266 @@
+// Package cst builds a concrete syntax tree: the tree of the ast package
+// with every token, space and comment of the source kept in place, so that
+// printing it gives back the source byte for byte. Tools can edit the text
+// of its tokens and parse the result again with Reparse.
+package cst
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+)
+
+// Element is either a *Node or a *Token.
+type Element interface {
+	String() string
+}
+
+// Token is a token of the source along with the whitespace and comments
+// right before it.
+type Token struct {
+	Leading []*Trivia
+	Token   token.Token
+	Text    string // The token exactly as written, quotes included
+}
+
+func (t *Token) String() string {
+	var out strings.Builder
+	for _, trivia := range t.Leading {
+		out.WriteString(trivia.Text)
+	}
+	out.WriteString(t.Text)
+	return out.String()
+}
+
+// Trivia is a run of whitespace or a comment.
+type Trivia struct {
+	Type token.TokenType // token.WHITESPACE or token.COMMENT
+	Text string
+}
+
+// Node is the concrete form of the ast node AST. Its Children are its child
+// nodes interleaved with the tokens that belong to it alone, like the
+// keywords and punctuation, in source order.
+type Node struct {
+	AST      ast.Node
+	Children []Element
+}
+
+func (n *Node) String() string {
+	var out strings.Builder
+	for _, child := range n.Children {
+		out.WriteString(child.String())
+	}
+	return out.String()
+}
+
+// Tokens returns every token under n in source order.
+func (n *Node) Tokens() []*Token {
+	tokens := []*Token{}
+	for _, child := range n.Children {
+		switch child := child.(type) {
+		case *Token:
+			tokens = append(tokens, child)
+		case *Node:
+			tokens = append(tokens, child.Tokens()...)
+		}
+	}
+	return tokens
+}
+
+// Parse builds the concrete syntax tree of src. The root's AST is the
+// *ast.Program, and its last child is the EOF token, which holds the
+// whitespace and comments at the end of the source.
+func Parse(src string) (*Node, error) {
+	p := parser.New(lexer.New(src))
+	p.RecordSpans()
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+
+	b := &builder{tokens: tokenize(src), spans: p.Spans(), index: map[position]int{}}
+	for i, t := range b.tokens {
+		b.index[position{t.Token.Line, t.Token.Column}] = i
+	}
+
+	return b.build(program).node, nil
+}
+
+// Reparse parses the current text of a tree into a new program, so that it
+// sees the edits made since Parse built the tree. The AST fields of the tree
+// keep the nodes of the source as it was.
+func Reparse(root *Node) (*ast.Program, error) {
+	p := parser.New(lexer.New(root.String()))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+	return program, nil
+}
+
+// tokenize splits src into tokens carrying the trivia before them, ending
+// with EOF.
+func tokenize(src string) []*Token {
+	lineStarts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(t token.Token) int {
+		return lineStarts[t.Line-1] + t.Column - 1
+	}
+
+	l := lexer.NewWithTrivia(src)
+	pieces := []token.Token{}
+	for {
+		t := l.NextToken()
+		pieces = append(pieces, t)
+		if t.Type == token.EOF {
+			break
+		}
+	}
+
+	tokens := []*Token{}
+	leading := []*Trivia{}
+	for i, t := range pieces {
+		end := len(src)
+		if i+1 < len(pieces) {
+			end = offset(pieces[i+1])
+		}
+		text := ""
+		if t.Type != token.EOF {
+			text = src[offset(t):end]
+		}
+
+		if t.Type == token.WHITESPACE || t.Type == token.COMMENT {
+			leading = append(leading, &Trivia{Type: t.Type, Text: text})
+			continue
+		}
+		tokens = append(tokens, &Token{Leading: leading, Token: t, Text: text})
+		leading = []*Trivia{}
+	}
+
+	return tokens
+}
+
+type position struct {
+	line, column int
+}
+
+type builder struct {
+	tokens []*Token
+	spans  map[ast.Node]parser.Span
+	index  map[position]int // Index in tokens of the token at a position
+}
+
+// span is the range of token indexes a node covers, or lo > hi if none.
+type span struct {
+	lo, hi int
+}
+
+func (s span) empty() bool { return s.lo > s.hi }
+
+func (s span) cover(i int) span {
+	if s.empty() {
+		return span{i, i}
+	}
+	if i < s.lo {
+		s.lo = i
+	}
+	if i > s.hi {
+		s.hi = i
+	}
+	return s
+}
+
+// built is a Node along with the tokens it covers.
+type built struct {
+	node *Node
+	span span
+}
+
+// build makes the Node for n, whose children are its child nodes and the
+// tokens within its span that none of them covers.
+func (b *builder) build(n ast.Node) built {
+	s := span{1, 0}
+
+	if t, ok := nodeToken(n); ok {
+		if i, ok := b.index[position{t.Line, t.Column}]; ok {
+			s = s.cover(i)
+		}
+	}
+	if recorded, ok := b.spans[n]; ok {
+		for _, t := range []token.Token{recorded.Start, recorded.End} {
+			if i, ok := b.index[position{t.Line, t.Column}]; ok {
+				s = s.cover(i)
+			}
+		}
+	}
+
+	children := []built{}
+	for _, child := range childNodes(n) {
+		c := b.build(child)
+		if c.span.empty() {
+			continue
+		}
+		s = s.cover(c.span.lo).cover(c.span.hi)
+		children = append(children, c)
+	}
+	sort.SliceStable(children, func(i, j int) bool { return children[i].span.lo < children[j].span.lo })
+
+	if _, ok := n.(*ast.Program); ok {
+		s = span{0, len(b.tokens) - 1}
+	}
+
+	node := &Node{AST: n}
+	i := s.lo
+	for _, c := range children {
+		if c.span.lo < i {
+			// Overlaps the sibling before it, so its tokens stay loose
+			continue
+		}
+		for ; i < c.span.lo; i++ {
+			node.Children = append(node.Children, b.tokens[i])
+		}
+		node.Children = append(node.Children, c.node)
+		i = c.span.hi + 1
+	}
+	for ; i <= s.hi; i++ {
+		node.Children = append(node.Children, b.tokens[i])
+	}
+
+	return built{node: node, span: s}
+}
+
+// childNodes returns the nodes directly below n.
+func childNodes(n ast.Node) []ast.Node {
+	children := []ast.Node{}
+	ast.Inspect(n, func(child ast.Node) bool {
+		if child == n {
+			return true
+		}
+		if child != nil {
+			children = append(children, child)
+		}
+		return false
+	})
+	return children
+}
+
+// nodeToken returns the token n was parsed from. A Program and an
+// EnumVariant have none of their own.
+func nodeToken(n ast.Node) (token.Token, bool) {
+	field := reflect.ValueOf(n).Elem().FieldByName("Token")
+	if !field.IsValid() {
+		return token.Token{}, false
+	}
+	return field.Interface().(token.Token), true
+}
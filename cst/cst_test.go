@@ -0,0 +1,160 @@
+package cst
+
+import (
+	"testing"
+
+	"monkey/ast"
+)
+
+const source = `# Fibonacci numbers
+let fib = fn(n) {   # naive
+  if (n < 2) { return n; }
+  fib(n-1)+fib(n - 2)
+
+};
+let xs = [1,2 , 3];   let h = {"a": 1, "b": (1+2)*3};
+puts(fib(10)) ;
+struct Point {
+  x,
+  y
+}
+impl Point { fn norm(self) { self.x*self.x + self.y*self.y } fn* each(self) { yield self.x; } }
+enum Shape { Circle(r), Empty }
+let area = fn(s: Shape) -> [int] { match (s) { Circle(r) { 3*r*r } default { 0 } } };
+select { case v = recv(ch) { v } case send(ch, 1) { } default {
+  # nothing ready
+} }
+a - (b - c) ; (a - b) - c; -(a + b); !(-a); f(x)[0].y; (fn(x) { x })(1); spawn(f, 1);
+"in" in  set(["in"])
+# end
+`
+
+func TestLossless(t *testing.T) {
+	inputs := []string{source, "", "  \n", "# only a comment", "1", "let a = 1;\r\n  a  "}
+
+	for _, input := range inputs {
+		root, err := Parse(input)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		if root.String() != input {
+			t.Errorf("tree does not print back the source.\nwant %q\ngot  %q", input, root.String())
+		}
+	}
+}
+
+func TestTreeShape(t *testing.T) {
+	root, err := Parse("let x = (1 + 2) * 3; # note\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := root.AST.(*ast.Program); !ok {
+		t.Fatalf("root is not the program, got %T", root.AST)
+	}
+
+	let := root.Children[0].(*Node)
+	if _, ok := let.AST.(*ast.LetStatement); !ok {
+		t.Fatalf("first child is not the let statement, got %T", let.AST)
+	}
+	if let.String() != "let x = (1 + 2) * 3;" {
+		t.Errorf("wrong let text %q", let.String())
+	}
+
+	product := let.Children[3].(*Node)
+	if product.String() != " (1 + 2) * 3" {
+		t.Errorf("wrong product text %q", product.String())
+	}
+	sum := product.Children[0].(*Node)
+	if _, ok := sum.AST.(*ast.InfixExpression); !ok || sum.String() != " (1 + 2)" {
+		t.Errorf("expected the parentheses to belong to the sum, got %T %q", sum.AST, sum.String())
+	}
+
+	eof := root.Children[len(root.Children)-1].(*Token)
+	if len(eof.Leading) != 3 || eof.Leading[1].Text != "# note" {
+		t.Errorf("expected the EOF token to hold the trailing comment, got %v", eof.Leading)
+	}
+}
+
+func TestExpressionsKeepTheirText(t *testing.T) {
+	root, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checked := 0
+	var check func(n *Node)
+	check = func(n *Node) {
+		for _, child := range n.Children {
+			if child, ok := child.(*Node); ok {
+				check(child)
+			}
+		}
+
+		switch e := n.AST.(type) {
+		case *ast.FunctionLiteral, *ast.YieldExpression:
+			// Only valid inside a let or a generator
+			return
+		case *ast.Identifier:
+			if e.Type != nil {
+				return
+			}
+		case ast.Expression:
+		default:
+			return
+		}
+
+		// The text of an expression node parses back to the same expression
+		program, err := Reparse(n)
+		if err != nil {
+			t.Errorf("%q does not parse: %s", n.String(), err)
+			return
+		}
+		if got := program.String(); got != n.AST.String() {
+			t.Errorf("%q parses to %q, want %q", n.String(), got, n.AST.String())
+		}
+		checked++
+	}
+	check(root)
+
+	if checked < 50 {
+		t.Errorf("expected to check most expressions, checked %d", checked)
+	}
+
+	tokens := root.Tokens()
+	if last := tokens[len(tokens)-1]; last.Token.Type != "EOF" {
+		t.Errorf("expected the last token to be EOF, got %s", last.Token.Type)
+	}
+}
+
+func TestEditAndReparse(t *testing.T) {
+	root, err := Parse("let total = price * 2; # doubled\nputs(total);\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tok := range root.Tokens() {
+		if tok.Text == "total" {
+			tok.Text = "sum"
+		}
+	}
+
+	expected := "let sum = price * 2; # doubled\nputs(sum);\n"
+	if root.String() != expected {
+		t.Errorf("wrong text after renaming.\nwant %q\ngot  %q", expected, root.String())
+	}
+
+	program, err := Reparse(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.String() != "let sum = (price * 2);puts(sum)" {
+		t.Errorf("wrong reparsed program %q", program.String())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("let = 1;"); err == nil {
+		t.Errorf("expected a parse error")
+	}
+}
@@ -10,5 +10,10 @@ var builtins = map[string]*object.Builtin{
 	"last":  object.GetBuildinByName("last"),
 	"push":  object.GetBuildinByName("push"),
 	"rest":  object.GetBuildinByName("rest"),
-	"puts":   object.GetBuildinByName("put"),
+	"puts":  object.GetBuildinByName("put"),
+	"chan":  object.GetBuildinByName("chan"),
+	"send":  object.GetBuildinByName("send"),
+	"recv":  object.GetBuildinByName("recv"),
+	"close": object.GetBuildinByName("close"),
+	"set":   object.GetBuildinByName("set"),
 }
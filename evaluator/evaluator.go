@@ -8,19 +8,28 @@ import (
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
+// Eval evaluates node, usually a whole *ast.Program, in the global
+// environment env, which keeps the variables it defines.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := resolve(node, env); err != nil {
+		return err
+	}
+	return eval(node, env)
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	case *ast.Program:
 		return eval_program(node.Statements, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(node.Expression, env)
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
@@ -32,19 +41,19 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return native_bool_to_boolean_object(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 		return eval_prefix_expression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		right := Eval(node.Right, env)
+		right := eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
@@ -57,18 +66,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return eval_if_expression(node, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.Value, env)
+		val := evalTail(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		env.Store(node.Name.Slot, val)
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
@@ -76,10 +85,32 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Body: body, Env: env, Generator: node.Generator, Slots: node.Slots}
+
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+
+	case *ast.SelectExpression:
+		return evalSelectExpression(node, env)
+
+	case *ast.YieldExpression:
+		yield := env.Yield()
+		if yield == nil {
+			return newError("yield outside of generator")
+		}
+		val := eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		yield(val)
+		return NULL
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
+		if member, ok := node.Function.(*ast.MemberExpression); ok {
+			return evalInvoke(member, node.Arguments, env)
+		}
+
+		function := eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
@@ -88,7 +119,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return applyFunction(function, args, env.Yield())
 
 	case *ast.ArrayLiteral:
 		elements := evalExpression(node.Elements, env)
@@ -98,11 +129,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
@@ -110,6 +141,38 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+
+	case *ast.StructStatement:
+		fields := []string{}
+		for _, f := range node.Fields {
+			fields = append(fields, f.Value)
+		}
+		structType := &object.StructType{Name: node.Name.Value, Fields: fields, Methods: map[string]object.Object{}}
+		env.Store(node.Name.Slot, structType)
+
+	case *ast.ImplStatement:
+		return evalImplStatement(node, env)
+
+	case *ast.EnumStatement:
+		enum := &object.Enum{Name: node.Name.Value}
+		for _, v := range node.Variants {
+			fields := []string{}
+			for _, f := range v.Fields {
+				fields = append(fields, f.Value)
+			}
+			enum.Variants = append(enum.Variants, object.NewVariantConstructor(enum.Name, v.Name.Value, fields))
+		}
+		env.Store(node.Name.Slot, enum)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.MemberExpression:
+		obj := eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Property.Value)
 	}
 
 	return nil
@@ -119,7 +182,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	pairs := make(map[object.HashKey]object.HashPair)
 
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
@@ -129,7 +192,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
@@ -141,6 +204,125 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
+func evalImplStatement(node *ast.ImplStatement, env *object.Environment) object.Object {
+	target := evalIdentifier(node.Name, env)
+	if isError(target) {
+		return target
+	}
+
+	structType, ok := target.(*object.StructType)
+	if !ok {
+		return newError("impl target is not a struct: %s", target.Type())
+	}
+
+	for _, method := range node.Methods {
+		structType.Methods[method.Name] = &object.Function{Parameters: method.Parameters, Body: method.Body, Env: env, Generator: method.Generator, Slots: method.Slots}
+	}
+
+	return nil
+}
+
+func evalInvoke(member *ast.MemberExpression, arguments []ast.Expression, env *object.Environment) object.Object {
+	receiver := eval(member.Object, env)
+	if isError(receiver) {
+		return receiver
+	}
+
+	args := evalExpression(arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	name := member.Property.Value
+
+	switch receiver.(type) {
+	case *object.Struct, *object.Enum, *object.Variant:
+		function := evalMemberExpression(receiver, name)
+		if isError(function) {
+			return function
+		}
+		return applyFunction(function, args, env.Yield())
+	}
+
+	method, ok := object.LookupMethod(receiver.Type(), name)
+	if !ok {
+		return newError("undefined method %s for %s", name, receiver.Type())
+	}
+
+	if result := method(applyFunctionFromGo, receiver, args...); result != nil {
+		return result
+	}
+	return NULL
+}
+
+// applyFunctionFromGo is the Applier handed to builtin methods. Callbacks run
+// outside of any generator, the same as in the VM.
+func applyFunctionFromGo(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args, nil)
+}
+
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Struct:
+		member, ok := obj.Member(name)
+		if !ok {
+			return newError("unknown field %s on %s", name, obj.Definition.Name)
+		}
+		return member
+	case *object.Enum:
+		member, ok := obj.Member(name)
+		if !ok {
+			return newError("unknown variant %s of %s", name, obj.Name)
+		}
+		return member
+	case *object.Variant:
+		member, ok := obj.Member(name)
+		if !ok {
+			return newError("unknown field %s on %s.%s", name, obj.Constructor.Enum, obj.Constructor.Name)
+		}
+		return member
+	default:
+		return newError("member access not supported: %s", obj.Type())
+	}
+}
+
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	variant, _ := subject.(*object.Variant)
+	for _, arm := range node.Arms {
+		if variant == nil || !variant.Matches(arm.Pattern) {
+			continue
+		}
+
+		if len(arm.Bindings) > 0 {
+			if len(arm.Bindings) != len(variant.Values) {
+				return newError("pattern %s binds %d values, %s has %d", arm.Pattern, len(arm.Bindings), variant.Inspect(), len(variant.Values))
+			}
+			for i, b := range arm.Bindings {
+				env.Store(b.Slot, variant.Values[i])
+			}
+		}
+
+		return blockValue(eval(arm.Body, env))
+	}
+
+	if node.Default == nil {
+		return newError("no match arm for %s", subject.Inspect())
+	}
+	return blockValue(eval(node.Default, env))
+}
+
+// blockValue turns the nil result of a block without a value into null.
+func blockValue(result object.Object) object.Object {
+	if result == nil {
+		return NULL
+	}
+	return result
+}
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
@@ -187,17 +369,41 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	}
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction calls fn, and then in turn each function its body ends by
+// calling, so tail calls take no Go stack.
+func applyFunction(fn object.Object, args []object.Object, yield func(object.Object)) object.Object {
+	for {
+		result := callFunction(fn, args, yield)
+		call, ok := result.(*tailCall)
+		if !ok {
+			return result
+		}
+		fn, args = call.fn, call.args
+	}
+}
+
+// callFunction calls fn once. A Monkey function can return a tailCall.
+func callFunction(fn object.Object, args []object.Object, yield func(object.Object)) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if fn.Generator {
+			return newGenerator(fn, args)
+		}
 		extendedEnv := extendEnvironment(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		extendedEnv.SetYield(yield)
+		evaluated := evalTail(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
 		if result := fn.Fn(args...); result != nil {
 			return result
 		}
 		return NULL
+	case *object.StructType:
+		return fn.New(args)
+	case *object.VariantConstructor:
+		return fn.New(args)
+	case *object.BoundMethod:
+		return applyFunction(fn.Method, append([]object.Object{fn.Receiver}, args...), yield)
 	default:
 		return newError("not a function %s", fn.Type())
 	}
@@ -211,10 +417,10 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 func extendEnvironment(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+	env := object.NewEnclosedEnvironment(fn.Env, fn.Slots)
 
 	for paramId, param := range fn.Parameters {
-		env.Set(param.Value, args[paramId])
+		env.Store(param.Slot, args[paramId])
 	}
 
 	return env
@@ -223,7 +429,7 @@ func extendEnvironment(fn *object.Function, args []object.Object) *object.Enviro
 func evalExpression(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -232,29 +438,96 @@ func evalExpression(exps []ast.Expression, env *object.Environment) []object.Obj
 	return result
 }
 
+// evalIdentifier reads the variable the resolver found for node. It can
+// still be missing when the let defining it has not run yet.
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(node.Value); ok {
-		return val
+	if node.Depth < 0 {
+		return builtins[node.Value]
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
-		return builtin
+	if val, ok := env.Load(node.Depth, node.Slot); ok {
+		return val
 	}
 
 	return newError("identifier not found: " + node.Value)
 }
 
+// evalSpawnExpression calls the function on a new goroutine. A Monkey
+// function gets a snapshot of its environment, so bindings made after the
+// spawn are not visible to it.
+func evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	function := eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+
+	args := evalExpression(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	if fn, ok := function.(*object.Function); ok {
+		snapshot := *fn
+		snapshot.Env = fn.Env.Snapshot()
+		function = &snapshot
+	}
+
+	result := object.NewChannel(1)
+	go func() {
+		result.Ch <- applyFunction(function, args, nil)
+		close(result.Ch)
+	}()
+
+	return result
+}
+
+func evalSelectExpression(node *ast.SelectExpression, env *object.Environment) object.Object {
+	cases := make([]object.SelectCase, len(node.Cases))
+	for i, c := range node.Cases {
+		channel := eval(c.Channel, env)
+		if isError(channel) {
+			return channel
+		}
+		cases[i] = object.SelectCase{Channel: channel, Send: c.Send}
+
+		if c.Send {
+			value := eval(c.Value, env)
+			if isError(value) {
+				return value
+			}
+			cases[i].Value = value
+		}
+	}
+
+	chosen, value, err := object.Select(cases, node.Default != nil)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	var body *ast.BlockStatement
+	if chosen == len(cases) {
+		body = node.Default
+	} else {
+		if name := node.Cases[chosen].Name; name != nil {
+			env.Store(name.Slot, value)
+		}
+		body = node.Cases[chosen].Body
+	}
+
+	return blockValue(eval(body, env))
+}
+
 func eval_if_expression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+	condition := eval(ie.Condition, env)
 
 	if isError(condition) {
 		return condition
 	}
 
 	if is_truthy(condition) {
-		return Eval(ie.Consequence, env)
+		return eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
@@ -275,12 +548,30 @@ func is_truthy(obj object.Object) bool {
 	}
 }
 
+// builtinInfixOperators are the infix operators the evaluator implements
+// itself, like the VM has opcodes for them. Registering a function for one
+// of them changes neither engine.
+var builtinInfixOperators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "<": true, ">": true,
+	"==": true, "!=": true, "in": true,
+}
+
 func eval_infix_expression(operator string, left object.Object, right object.Object) object.Object {
+	if fn, ok := object.LookupInfixOperator(operator); ok && !builtinInfixOperators[operator] {
+		return apply_custom_operator(fn(left, right))
+	}
+
 	switch {
+	case operator == "in":
+		return object.In(left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return eval_string_infix_expression(operator, left, right)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return eval_integer_infix_expression(operator, left, right)
+	case object.ComparesByValue(left, right) && operator == "==":
+		return native_bool_to_boolean_object(object.Equal(left, right))
+	case object.ComparesByValue(left, right) && operator == "!=":
+		return native_bool_to_boolean_object(!object.Equal(left, right))
 	case operator == "==":
 		return native_bool_to_boolean_object(left == right)
 	case operator == "!=":
@@ -330,8 +621,13 @@ func eval_string_infix_expression(operator string, left object.Object, right obj
 	left_value := left.(*object.String).Value
 	right_value := right.(*object.String).Value
 
-	if operator == "+" {
+	switch operator {
+	case "+":
 		return &object.String{Value: left_value + right_value}
+	case "==":
+		return native_bool_to_boolean_object(left_value == right_value)
+	case "!=":
+		return native_bool_to_boolean_object(left_value != right_value)
 	}
 	return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 }
@@ -347,10 +643,22 @@ func eval_prefix_expression(operator string, right object.Object) object.Object
 			return eval_minus_operator(right)
 		}
 	default:
+		if fn, ok := object.LookupPrefixOperator(operator); ok {
+			return apply_custom_operator(fn(right))
+		}
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
+// apply_custom_operator turns the nil an embedder's operator may return into
+// NULL.
+func apply_custom_operator(result object.Object) object.Object {
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
 func eval_minus_operator(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
@@ -379,11 +687,11 @@ func eval_program(stmts []ast.Statement, env *object.Environment) object.Object
 	var result object.Object
 
 	for _, statement := range stmts {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return completeTailCall(result.Value, env.Yield())
 		case *object.Error:
 			return result
 		}
@@ -396,7 +704,7 @@ func eval_block_statement(block *ast.BlockStatement, env *object.Environment) ob
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
@@ -1,13 +1,416 @@
 package evaluator
 
 import (
+	"runtime/debug"
 	"testing"
 
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
 )
 
+func TestEvalOutsideProgram(t *testing.T) {
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(`let x = 5; let y = 7;`)).ParseProgram(), env)
+
+	statement := func(input string) *ast.ExpressionStatement {
+		return parser.New(lexer.New(input)).ParseProgram().Statements[0].(*ast.ExpressionStatement)
+	}
+
+	test_integer_object(t, Eval(statement(`y - x`), env), 2)
+	test_integer_object(t, Eval(statement(`fn(a) { a * y }(3)`).Expression, env), 21)
+
+	evaluated := Eval(statement(`x + z`), env)
+	if err, ok := evaluated.(*object.Error); !ok || err.Message != "identifier not found: z" {
+		t.Errorf("expected an error for z, got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// Without tail calls each level of recursion takes several Go frames
+	defer debug.SetMaxStack(debug.SetMaxStack(4 << 20))
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)`, 5000050000},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0)`, 5000050000},
+		{`let even = fn(n) { if (n == 0) { 1 } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { 0 } else { even(n - 1) } }; even(100001)`, 0},
+		{`let f = fn(n) { if (n == 0) { return len([1, 2]); } f(n - 1) }; f(100000)`, 2},
+		{`let f = fn(x) { x * 2 }; return f(21);`, 42},
+	}
+
+	for _, tt := range tests {
+		test_integer_object(t, test_eval(tt.input), tt.expected)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let x = 1; let f = fn(y) { let z = 3; x + y + z }; f(2)`, 6},
+		{`let x = 1; let f = fn() { let x = 2; x }; f() + x`, 3},
+		{`let x = 1; let f = fn() { let y = x; let x = 10; y + x }; f()`, 11},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; if (even(10)) { 1 } else { 0 }`, 1},
+		{`let adder = fn(a) { fn(b) { fn(c) { a + b + c } } }; adder(1)(2)(3)`, 6},
+		{`let f = fn(c) { if (c) { let v = 1; }; v }; f(true)`, 1},
+		{`let f = fn(c) { if (c) { let v = 1; }; v }; f(false)`, "identifier not found: v"},
+		{`let len = fn(x) { 42 }; len([1])`, 42},
+		{`let f = fn() { nope }; 5`, "identifier not found: nope"},
+		{`a + fn() { b + a }()`, "identifiers not found: a, b"},
+		{`x; let x = 1`, "identifier not found: x"},
+		{`let f = fn() { g() }; f(); let g = fn() { 1 }`, "identifier not found: g"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: object is not Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestGlobalsPersistAcrossPrograms(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("answer", &object.Integer{Value: 40})
+
+	inputs := []string{`let inc = fn(x) { x + 1 };`, `let two = inc(1);`, `answer + two`}
+
+	var result object.Object
+	for _, input := range inputs {
+		result = Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+	test_integer_object(t, result, 42)
+
+	if val, ok := env.Get("two"); !ok || val.Inspect() != "2" {
+		t.Errorf("expected two to be 2, got %v", val)
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len(set([1, 2, 2, 3, 1]))`, 3},
+		{`if (2 in set([1, 2])) { 1 } else { 0 }`, 1},
+		{`if ("c" in set(["a", "b"])) { 1 } else { 0 }`, 0},
+		{`if ("key" in "monkey") { 1 } else { 0 }`, 1},
+		{`set([1, 2]).union(set([2, 3])).len()`, 3},
+		{`set([1, 2, 3]).intersection(set([3, 2, 5])).values().first()`, 2},
+		{`set([1, 2, 3]).difference(set([2])).values().last()`, 3},
+		{`if (set([1, 2]) == set([2, 1])) { 1 } else { 0 }`, 1},
+		{`set([1, 2, 3]).reduce(fn(acc, x) { acc + x }, 0)`, 6},
+		{`set([[1]])`, "unusable as set element: ARRAY"},
+		{`1 in 2`, "operator `in` not supported for INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	shapes := `enum Shape { Circle(r), Rect(w, h), Empty };
+	let area = fn(s) {
+		match (s) {
+			Circle(r) { 3 * r * r }
+			Shape.Rect(w, h) { w * h }
+			Empty { 0 }
+		}
+	};`
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{shapes + `area(Shape.Circle(2))`, 12},
+		{shapes + `area(Shape.Rect(2, 5))`, 10},
+		{shapes + `area(Shape.Empty)`, 0},
+		{shapes + `if (Shape.Circle(2) == Shape.Circle(2)) { 1 } else { 0 }`, 1},
+		{shapes + `if (Shape.Circle(2) != Shape.Circle(3)) { 1 } else { 0 }`, 1},
+		{shapes + `Shape.Rect(2, 3).h`, 3},
+		{shapes + `match (5) { Circle { 1 } default { 2 } }`, 2},
+		{shapes + `Shape.Circle(1, 2)`, "wrong number of fields for Shape.Circle: want=1, got=2"},
+		{shapes + `Shape.Square`, "unknown variant Square of Shape"},
+		{shapes + `match (Shape.Empty) { Circle(r) { r } }`, "no match arm for Shape.Empty"},
+		{shapes + `match (Shape.Circle(1)) { Circle(a, b) { a } }`, "pattern Circle binds 2 values, Shape.Circle(1) has 1"},
+		{shapes + `let r = 10; match (Shape.Circle(1)) { Circle(r) { r } }; r`, 10},
+		{shapes + `let f = fn(r) { match (Shape.Circle(1)) { Circle(r) { r } }; r }; f(10)`, 10},
+		{shapes + `let g = match (Shape.Circle(4)) { Circle(r) { fn() { r } } }; let r = 1; g()`, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestEnumInspect(t *testing.T) {
+	input := `enum Shape { Circle(r), Rect(w, h), Empty }; [Shape, Shape.Rect, Shape.Rect(1, "a"), Shape.Empty]`
+
+	expected := `[enum Shape { Circle(r), Rect(w, h), Empty }, variant Shape.Rect(w, h), Shape.Rect(1, a), Shape.Empty]`
+	if got := test_eval(input).Inspect(); got != expected {
+		t.Errorf("wrong inspect. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let ch = chan(1); send(ch, 5); recv(ch)`, 5},
+		{`recv(spawn(fn(a, b) { a + b }, 2, 3))`, 5},
+		{
+			`let work = fn(x) { x * x };
+			let fanout = fn(xs, out) {
+				if (len(xs) > 0) {
+					spawn(fn() { send(out, work(first(xs))) });
+					fanout(rest(xs), out);
+				}
+			};
+			let out = chan(3);
+			fanout([1, 2, 3], out);
+			recv(out) + recv(out) + recv(out)`,
+			14,
+		},
+		{`let x = 1; let r = spawn(fn() { x }); let x = 2; recv(r)`, 1},
+		{
+			`let a = chan(1); let b = chan(1); send(b, 7);
+			select { case v = recv(a) { v } case v = recv(b) { v * 2 } }`,
+			14,
+		},
+		{`let a = chan(); select { case recv(a) { 1 } default { 2 } }`, 2},
+		{`let a = chan(1); select { case send(a, 3) { } }; recv(a)`, 3},
+		{`let v = 5; let a = chan(1); send(a, 1); select { case v = recv(a) { v } }; v`, 5},
+		{`let f = fn(v) { let a = chan(1); send(a, 1); select { case v = recv(a) { v } } + v }; f(5)`, 6},
+		{`let a = chan(); close(a); close(a)`, "close of closed channel"},
+		{`recv(spawn(fn() { 1 + true }))`, "type mismatch: INTEGER + BOOLEAN"},
+		{`recv(spawn(len, "abc"))`, 3},
+		{`recv(spawn(len, 1))`, "argument to `len` not supported, got INTEGER"},
+		{`struct P { n }; impl P { fn get(self) { self.n } }; let p = P(3); recv(spawn(p.get))`, 3},
+		{`struct P { n }; recv(spawn(P, 4)).n`, 4},
+		{`enum Shape { Circle(r) }; match (recv(spawn(Shape.Circle, 5))) { Circle(r) { r } }`, 5},
+		{`select { case recv(1) { 1 } }`, "select case needs a CHANNEL, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`let upto = fn(i, n) { if (i < n) { yield i; upto(i + 1, n); } };
+			let count = fn*(n) { upto(0, n); };
+			count(3).take(10).reduce(fn(a, b) { a + b }, 0)`,
+			3,
+		},
+		{
+			`let from = fn(i) { yield i; from(i + 1); };
+			let naturals = fn*() { from(0); };
+			naturals().filter(fn(x) { x / 2 * 2 == x }).map(fn(x) { x * x }).take(3).last()`,
+			16,
+		},
+		{
+			`let g = fn*() { yield 1; };
+			let it = g();
+			it.next();
+			it.next();
+			if (it.done()) { 1 } else { 2 }`,
+			1,
+		},
+		{
+			`let emit = fn(x) { yield x * 10; };
+			let g = fn*() { emit(1); emit(2); };
+			g().take(5).last()`,
+			20,
+		},
+		{`yield 1`, "yield outside of generator"},
+		{`fn*() { yield 1 + true; }().next()`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc".upper().len()`, 3},
+		{`"a,b,c".split(",").len()`, 3},
+		{`[1, 2, 3].map(fn(x) { x * 2 }).reduce(fn(acc, x) { acc + x }, 0)`, 12},
+		{`[1, 2, 3, 4].filter(fn(x) { x > 2 }).first()`, 3},
+		{`{"b": 2, "a": 1}.values().last()`, 2},
+		{`if ("monkey".contains("key")) { 1 } else { 2 }`, 1},
+		{`if ({"a": 1}.has("b")) { 1 } else { 2 }`, 2},
+		{
+			`struct Point { x, y };
+			impl Point { fn sum(p) { p.x + p.y } }
+			[Point(1, 2), Point(3, 4)].map(fn(p) { p.sum() }).reduce(fn(a, b) { a + b }, 0)`,
+			10,
+		},
+		{`5.upper()`, "undefined method upper for INTEGER"},
+		{`[1].map(fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"struct Point { x, y }; let p = Point(1, 2); p.x;", 1},
+		{"struct Point { x, y }; let p = Point(1, 2); p.y;", 2},
+		{"struct Pair { left, right }; Pair(Pair(1, 2), 3).left.right;", 2},
+		{
+			`struct Point { x, y };
+			impl Point {
+				fn sum(p) { p.x + p.y }
+				fn scale(p, k) { Point(p.x * k, p.y * k) }
+			}
+			Point(1, 2).scale(10).sum();`,
+			30,
+		},
+		{"let make = fn(v) { struct P { n }; impl P { fn next(self) { P(v) } }; P(0) }; let a = make(5); let b = make(7); a.next().n", 5},
+		{
+			`struct Counter { n };
+			let step = 5;
+			impl Counter { fn next(c) { Counter(c.n + step) } }
+			let c = Counter(0);
+			let bump = c.next;
+			bump().n;`,
+			5,
+		},
+		{"struct Point { x, y }; Point(1);", "wrong number of fields for Point: want=2, got=1"},
+		{"struct Point { x, y }; Point(1, 2).z;", "unknown field z on Point"},
+		{"let p = 5; p.x;", "member access not supported: INTEGER"},
+		{"let p = 5; impl p { fn f(s) { s } }", "impl target is not a struct: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := test_eval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			test_integer_object(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestStructInspect(t *testing.T) {
+	evaluated := test_eval(`struct Point { x, y }; Point(1, "two")`)
+
+	if evaluated.Inspect() != "Point{x: 1, y: two}" {
+		t.Errorf("Inspect() wrong. got=%q", evaluated.Inspect())
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -201,6 +604,22 @@ func TestBuildinFunctions(t *testing.T) {
 	}
 }
 
+func TestStringEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		test_boolean_object(t, test_eval(tt.input), tt.expected)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 	evaluated := test_eval(input)
@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"errors"
+	"runtime"
+
+	"monkey/ast"
+	"monkey/object"
+)
+
+// errGeneratorClosed unwinds the goroutine of a generator that was garbage
+// collected while suspended.
+var errGeneratorClosed = errors.New("generator closed")
+
+// generatorState runs a generator body on its own goroutine. Control is
+// handed back and forth over unbuffered channels, so only one side ever
+// runs at a time.
+type generatorState struct {
+	resume   chan struct{}
+	yields   chan object.Object
+	finished chan object.Object
+	stop     chan struct{}
+	started  bool
+	running  bool
+}
+
+func newGenerator(fn *object.Function, args []object.Object) object.Object {
+	state := &generatorState{
+		resume:   make(chan struct{}),
+		yields:   make(chan object.Object),
+		finished: make(chan object.Object),
+		stop:     make(chan struct{}),
+	}
+
+	env := extendEnvironment(fn, args)
+	env.SetYield(state.yield)
+
+	gen := &object.Generator{}
+	gen.Resume = func() (object.Object, bool) {
+		return state.next(fn.Body, env)
+	}
+	runtime.SetFinalizer(gen, func(*object.Generator) { close(state.stop) })
+
+	return gen
+}
+
+func (s *generatorState) next(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	if s.running {
+		return newError("generator is already running"), false
+	}
+
+	if !s.started {
+		s.started = true
+		go s.run(body, env)
+	}
+
+	s.running = true
+	defer func() { s.running = false }()
+
+	s.resume <- struct{}{}
+
+	select {
+	case value := <-s.yields:
+		return value, true
+	case result := <-s.finished:
+		if isError(result) {
+			return result, false
+		}
+		return nil, false
+	}
+}
+
+func (s *generatorState) run(body *ast.BlockStatement, env *object.Environment) {
+	defer func() {
+		if r := recover(); r != nil && r != errGeneratorClosed {
+			panic(r)
+		}
+	}()
+
+	select {
+	case <-s.resume:
+	case <-s.stop:
+		return
+	}
+
+	s.finished <- completeTailCall(unwrapReturnValue(eval(body, env)), env.Yield())
+}
+
+func (s *generatorState) yield(value object.Object) {
+	s.yields <- value
+
+	select {
+	case <-s.resume:
+	case <-s.stop:
+		panic(errGeneratorClosed)
+	}
+}
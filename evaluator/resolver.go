@@ -0,0 +1,287 @@
+package evaluator
+
+import (
+	"slices"
+	"strings"
+
+	"monkey/ast"
+	"monkey/object"
+)
+
+// resolver gives every variable a slot in the environment of the function
+// that defines it, and every identifier the depth and slot of the variable
+// it names, the way the compiler's symbol table does for the VM. Eval can
+// then index into environments instead of looking names up.
+//
+// Within a function a name refers to a variable defined before it, since
+// that is all a call has set when it gets there. Function bodies are
+// resolved once their enclosing function is complete, though, as they can
+// run after the rest of it: a function can call itself, or one defined
+// after it.
+//
+// A match arm or select case is a block: the variables it binds get slots
+// of their own, and hide variables of the same name only within it.
+type resolver struct {
+	scope      *scope
+	unresolved []string
+}
+
+type scope struct {
+	slots   map[string]int
+	size    int
+	global  *object.Environment // Holds the slots of the global scope instead
+	outer   *scope
+	blocks  []map[string]int // Variables of the blocks being resolved, innermost last
+	pending []pendingFunction
+}
+
+// pendingFunction is a function literal to resolve once its scope is
+// complete, with the blocks it was written in.
+type pendingFunction struct {
+	fn     *ast.FunctionLiteral
+	blocks []map[string]int
+}
+
+func (s *scope) define(name string) int {
+	if len(s.blocks) > 0 {
+		slot := s.newSlot()
+		s.blocks[len(s.blocks)-1][name] = slot
+		return slot
+	}
+
+	if s.global != nil {
+		return s.global.Define(name)
+	}
+
+	slot, ok := s.slots[name]
+	if !ok {
+		slot = s.newSlot()
+		s.slots[name] = slot
+	}
+	return slot
+}
+
+func (s *scope) newSlot() int {
+	if s.global != nil {
+		return s.global.NewSlot()
+	}
+	s.size++
+	return s.size - 1
+}
+
+func (s *scope) lookup(name string) (int, bool) {
+	for i := len(s.blocks) - 1; i >= 0; i-- {
+		if slot, ok := s.blocks[i][name]; ok {
+			return slot, true
+		}
+	}
+
+	if s.global != nil {
+		return s.global.Slot(name)
+	}
+	slot, ok := s.slots[name]
+	return slot, ok
+}
+
+func (s *scope) deferFunction(fn *ast.FunctionLiteral) {
+	s.pending = append(s.pending, pendingFunction{fn: fn, blocks: slices.Clone(s.blocks)})
+}
+
+// resolve resolves node to run in the global environment env. It returns
+// an error naming the identifiers that refer to no variable.
+func resolve(node ast.Node, env *object.Environment) *object.Error {
+	r := &resolver{scope: &scope{global: env}}
+	r.resolve(node)
+	r.finish()
+
+	switch len(r.unresolved) {
+	case 0:
+		return nil
+	case 1:
+		return newError("identifier not found: %s", r.unresolved[0])
+	default:
+		return newError("identifiers not found: %s", strings.Join(r.unresolved, ", "))
+	}
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			r.resolve(s)
+		}
+
+	case *ast.ExpressionStatement:
+		if node.Expression != nil {
+			r.resolve(node.Expression)
+		}
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			r.resolve(s)
+		}
+
+	case *ast.LetStatement:
+		if node.Value != nil {
+			r.resolve(node.Value)
+		}
+		r.define(node.Name)
+
+	case *ast.ReturnStatement:
+		if node.Value != nil {
+			r.resolve(node.Value)
+		}
+
+	case *ast.StructStatement:
+		r.define(node.Name)
+
+	case *ast.EnumStatement:
+		r.define(node.Name)
+
+	case *ast.ImplStatement:
+		r.resolve(node.Name)
+		for _, m := range node.Methods {
+			r.scope.deferFunction(m)
+		}
+
+	case *ast.Identifier:
+		r.lookup(node)
+
+	case *ast.FunctionLiteral:
+		r.scope.deferFunction(node)
+
+	case *ast.PrefixExpression:
+		r.resolve(node.Right)
+
+	case *ast.InfixExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Right)
+
+	case *ast.IfExpression:
+		r.resolve(node.Condition)
+		r.resolve(node.Consequence)
+		if node.Alternative != nil {
+			r.resolve(node.Alternative)
+		}
+
+	case *ast.CallExpression:
+		r.resolve(node.Function)
+		r.resolveAll(node.Arguments)
+
+	case *ast.SpawnExpression:
+		r.resolve(node.Function)
+		r.resolveAll(node.Arguments)
+
+	case *ast.YieldExpression:
+		r.resolve(node.Value)
+
+	case *ast.ArrayLiteral:
+		r.resolveAll(node.Elements)
+
+	case *ast.IndexExpression:
+		r.resolve(node.Left)
+		r.resolve(node.Index)
+
+	case *ast.HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			r.resolve(key)
+			r.resolve(node.Pairs[key])
+		}
+
+	case *ast.MemberExpression:
+		r.resolve(node.Object)
+
+	case *ast.MatchExpression:
+		r.resolve(node.Subject)
+		for _, arm := range node.Arms {
+			r.block(func() {
+				for _, b := range arm.Bindings {
+					r.define(b)
+				}
+				r.resolve(arm.Body)
+			})
+		}
+		if node.Default != nil {
+			r.block(func() { r.resolve(node.Default) })
+		}
+
+	case *ast.SelectExpression:
+		for _, c := range node.Cases {
+			r.resolve(c.Channel)
+			if c.Send {
+				r.resolve(c.Value)
+			}
+			r.block(func() {
+				if c.Name != nil {
+					r.define(c.Name)
+				}
+				r.resolve(c.Body)
+			})
+		}
+		if node.Default != nil {
+			r.block(func() { r.resolve(node.Default) })
+		}
+	}
+}
+
+func (r *resolver) resolveAll(exps []ast.Expression) {
+	for _, e := range exps {
+		r.resolve(e)
+	}
+}
+
+// finish resolves the bodies of the functions defined in the current scope,
+// which is now complete.
+func (r *resolver) finish() {
+	pending := r.scope.pending
+	r.scope.pending = nil
+
+	blocks := r.scope.blocks
+	for _, p := range pending {
+		r.scope.blocks = p.blocks
+		r.scope = &scope{slots: map[string]int{}, outer: r.scope}
+		for _, param := range p.fn.Parameters {
+			r.define(param)
+		}
+		r.resolve(p.fn.Body)
+		r.finish()
+		p.fn.Slots = r.scope.size
+		r.scope = r.scope.outer
+	}
+	r.scope.blocks = blocks
+}
+
+// block resolves what resolveBody resolves as a block of the current scope.
+func (r *resolver) block(resolveBody func()) {
+	r.scope.blocks = append(r.scope.blocks, map[string]int{})
+	resolveBody()
+	r.scope.blocks = r.scope.blocks[:len(r.scope.blocks)-1]
+}
+
+func (r *resolver) define(ident *ast.Identifier) {
+	ident.Depth = 0
+	ident.Slot = r.scope.define(ident.Value)
+}
+
+func (r *resolver) lookup(ident *ast.Identifier) {
+	depth := 0
+	for s := r.scope; s != nil; s = s.outer {
+		if slot, ok := s.lookup(ident.Value); ok {
+			ident.Depth, ident.Slot = depth, slot
+			return
+		}
+		depth++
+	}
+
+	if _, ok := builtins[ident.Value]; ok {
+		ident.Depth = -1
+		return
+	}
+
+	for _, name := range r.unresolved {
+		if name == ident.Value {
+			return
+		}
+	}
+	r.unresolved = append(r.unresolved, ident.Value)
+}
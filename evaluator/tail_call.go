@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// tailCall is what a call evaluates to when its result is also the result
+// of the function making it: the call still to be made. applyFunction makes
+// it once the function has returned, so a function calling itself last, or
+// two calling each other, recurse as deep as they like without growing the
+// Go stack.
+type tailCall struct {
+	fn   object.Object
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evalTail evaluates node where its value is returned from the function
+// being evaluated, making calls there into tailCalls.
+func evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		var result object.Object
+		for i, statement := range node.Statements {
+			if i == len(node.Statements)-1 {
+				return evalTail(statement, env)
+			}
+
+			result = eval(statement, env)
+			if result != nil {
+				rt := result.Type()
+				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+					return result
+				}
+			}
+		}
+		return result
+
+	case *ast.ExpressionStatement:
+		return evalTail(node.Expression, env)
+
+	case *ast.IfExpression:
+		condition := eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if is_truthy(condition) {
+			return evalTail(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return evalTail(node.Alternative, env)
+		}
+		return NULL
+
+	case *ast.CallExpression:
+		if _, ok := node.Function.(*ast.MemberExpression); ok {
+			return eval(node, env)
+		}
+
+		function := eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpression(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return &tailCall{fn: function, args: args}
+	}
+
+	return eval(node, env)
+}
+
+// completeTailCall makes the call result stands for, if it is a tailCall
+// that reached the top of a program or generator.
+func completeTailCall(result object.Object, yield func(object.Object)) object.Object {
+	if call, ok := result.(*tailCall); ok {
+		return applyFunction(call.fn, call.args, yield)
+	}
+	return result
+}
@@ -0,0 +1,777 @@
+// Package format prints Monkey syntax trees in the canonical layout used by
+// 'monkey fmt': one statement per line, blocks indented with tabs, single
+// spaces around infix operators and only the parentheses the grammar needs.
+// Comments are put back next to the statement, list item or closing brace
+// they were written beside and single blank lines between statements are
+// kept.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+)
+
+// Source formats Monkey source code. It fails if the source does not parse,
+// if the parser skipped some of its tokens, or if the result would not parse
+// back to the same program.
+func Source(src []byte) ([]byte, error) {
+	program, err := parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	formatted := Node(program)
+
+	if t, ok := skipped(string(src), formatted); ok {
+		return nil, fmt.Errorf("format: %d:%d: the parser skipped %q", t.Line, t.Column, t.Literal)
+	}
+
+	check, err := parse(formatted)
+	if err != nil || check.String() != program.String() {
+		return nil, fmt.Errorf("format: formatting would change the program")
+	}
+
+	return []byte(formatted), nil
+}
+
+// skipped returns the first token of src that is missing from formatted,
+// which the parser must have skipped without an error, like the tokens
+// after the value of a let statement up to the next semicolon. The
+// punctuation the printer adds or leaves out is not compared.
+func skipped(src, formatted string) (token.Token, bool) {
+	want := significantTokens(src)
+	got := significantTokens(formatted)
+	for i, t := range want {
+		if i >= len(got) || got[i].Type != t.Type || got[i].Literal != t.Literal && t.Type != token.INT {
+			return t, true
+		}
+	}
+	return token.Token{}, false
+}
+
+// significantTokens lexes src, leaving out semicolons, commas and
+// parentheses.
+func significantTokens(src string) []token.Token {
+	tokens := []token.Token{}
+	l := lexer.New(src)
+	for {
+		t := l.NextToken()
+		switch t.Type {
+		case token.EOF:
+			return tokens
+		case token.SEMICOLON, token.COMMA, token.LPAREN, token.RPAREN:
+		default:
+			tokens = append(tokens, t)
+		}
+	}
+}
+
+func parse(src string) (*ast.Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+	return program, nil
+}
+
+// Node returns the canonical source for node. Only a *ast.Program carries
+// comments, so only formatting a whole program keeps them.
+func Node(node ast.Node) string {
+	p := &printer{first: true}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.comments = node.Comments
+		p.statements(node.Statements, false, token.Token{})
+		for len(p.comments) > 0 {
+			p.comment(p.comments[0])
+		}
+		p.out.WriteString("\n")
+	case ast.Statement:
+		p.statement(node, nil, false)
+	case ast.Expression:
+		p.expression(node)
+	default:
+		p.out.WriteString(node.String())
+	}
+
+	return p.out.String()
+}
+
+type printer struct {
+	out      bytes.Buffer
+	indent   int
+	comments []*ast.Comment // Comments not printed yet, in source order
+	line     int            // Source line of the last thing printed
+	first    bool           // Nothing printed yet in the current block
+}
+
+// newline starts a new output line for something found on source line
+// line, keeping one blank line if the source had any before it.
+func (p *printer) newline(line int) {
+	if p.out.Len() > 0 {
+		p.out.WriteString("\n")
+		if !p.first && line > 0 && p.line > 0 && line > p.line+1 {
+			p.out.WriteString("\n")
+		}
+	}
+	p.out.WriteString(strings.Repeat("\t", p.indent))
+	p.first = false
+}
+
+func (p *printer) comment(c *ast.Comment) {
+	p.newline(c.Token.Line)
+	p.out.WriteString(c.Token.Literal)
+	p.line = c.Token.Line
+	p.comments = p.comments[1:]
+}
+
+// commentsBefore prints the comments that come before source line line,
+// each on a line of its own.
+func (p *printer) commentsBefore(line int) {
+	for len(p.comments) > 0 && line > 0 && p.comments[0].Token.Line < line {
+		p.comment(p.comments[0])
+	}
+}
+
+// item starts a line for a statement or an arm starting on source line
+// line, after the comments above it.
+func (p *printer) item(line int) {
+	p.commentsBefore(line)
+	p.newline(line)
+	if line > 0 {
+		p.line = line
+	}
+}
+
+// statements prints list, which close, if any, ends.
+func (p *printer) statements(list []ast.Statement, inBlock bool, close token.Token) {
+	semicolonAt := -1
+
+	for i, s := range list {
+		p.item(firstLine(s))
+
+		// A statement that starts like the continuation of an expression
+		// needs the one before it to be closed by a semicolon.
+		if semicolonAt >= 0 && continues(s) {
+			p.insert(semicolonAt, ";")
+		}
+
+		var next ast.Statement
+		nextToken := close
+		if i+1 < len(list) {
+			next = list[i+1]
+			nextToken = firstToken(next)
+		}
+		semicolonAt = p.statement(s, next, inBlock)
+
+		p.trailingComments(lastLine(s), nextToken)
+	}
+}
+
+// insert puts s into the output at offset, which is before the current end.
+func (p *printer) insert(offset int, s string) {
+	b := append([]byte{}, p.out.Bytes()[:offset]...)
+	b = append(b, s...)
+	b = append(b, p.out.Bytes()[offset:]...)
+	p.out.Reset()
+	p.out.Write(b)
+}
+
+// trailingComments prints the comments written inside or at the end of a
+// statement that ended on source line line, up to the token next that
+// follows it: the one on its last line stays at the end of it, the ones
+// inside it follow on lines of their own. A comment after next on the same
+// line is left for what next starts.
+func (p *printer) trailingComments(line int, next token.Token) {
+	if line == 0 {
+		return
+	}
+
+	inside := []*ast.Comment{}
+	for len(p.comments) > 0 && p.comments[0].Token.Line <= line {
+		c := p.comments[0]
+		if next.Line > 0 && !before(c.Token, next) {
+			break
+		}
+		p.comments = p.comments[1:]
+		if c.Token.Line == line {
+			p.out.WriteString(" " + c.Token.Literal)
+		} else {
+			inside = append(inside, c)
+		}
+	}
+	for _, c := range inside {
+		p.newline(0)
+		p.out.WriteString(c.Token.Literal)
+	}
+	p.line = line
+}
+
+// statement prints s. If it leaves out a semicolon that the statement after
+// it may need, it returns where to insert one, otherwise -1.
+func (p *printer) statement(s ast.Statement, next ast.Statement, inBlock bool) int {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.out.WriteString("let " + s.Name.String() + " = ")
+		p.expression(s.Value)
+		p.out.WriteString(";")
+
+	case *ast.ReturnStatement:
+		p.out.WriteString("return")
+		if s.Value != nil {
+			p.out.WriteString(" ")
+			p.expression(s.Value)
+		}
+		p.out.WriteString(";")
+
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+		if next == nil && inBlock {
+			// The value of the block
+			return -1
+		}
+		if endsWithBlock(s.Expression) {
+			if next == nil {
+				return -1
+			}
+			return p.out.Len()
+		}
+		p.out.WriteString(";")
+
+	case *ast.StructStatement:
+		p.out.WriteString("struct " + s.Name.Value + " { ")
+		p.identifiers(s.Fields)
+		p.out.WriteString(" }")
+
+	case *ast.EnumStatement:
+		p.out.WriteString("enum " + s.Name.Value + " { ")
+		for i, v := range s.Variants {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.out.WriteString(v.Name.Value)
+			if len(v.Fields) > 0 {
+				p.out.WriteString("(")
+				p.identifiers(v.Fields)
+				p.out.WriteString(")")
+			}
+		}
+		p.out.WriteString(" }")
+
+	case *ast.ImplStatement:
+		p.out.WriteString("impl " + s.Name.Value + " {")
+		p.indent++
+		p.first = true
+		for i, m := range s.Methods {
+			p.item(m.Token.Line)
+			p.function(m, m.Name)
+			next := s.Rbrace
+			if i+1 < len(s.Methods) {
+				next = s.Methods[i+1].Token
+			}
+			p.trailingComments(lastLine(m), next)
+		}
+		p.indent--
+		p.newline(0)
+		p.out.WriteString("}")
+
+	case *ast.BlockStatement:
+		p.block(s)
+
+	default:
+		p.out.WriteString(s.String())
+	}
+
+	return -1
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && !p.commentBefore(b.Rbrace.Line) {
+		p.out.WriteString("{}")
+		return
+	}
+
+	p.out.WriteString("{")
+	p.indent++
+	p.first = true
+	p.statements(b.Statements, true, b.Rbrace)
+	p.commentsBefore(b.Rbrace.Line)
+	p.indent--
+	p.newline(0)
+	p.out.WriteString("}")
+	if b.Rbrace.Line > 0 {
+		p.line = b.Rbrace.Line
+	}
+}
+
+// commentBetween reports whether the next comment to print comes after
+// the token from, on its line, and before the token to.
+func (p *printer) commentBetween(from, to token.Token) bool {
+	if len(p.comments) == 0 || from.Line == 0 {
+		return false
+	}
+	c := p.comments[0].Token
+	return c.Line == from.Line && before(c, to)
+}
+
+// before reports whether token a comes before token b in the source.
+func before(a, b token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// commentBefore reports whether a comment waits to be printed before source
+// line line.
+func (p *printer) commentBefore(line int) bool {
+	return len(p.comments) > 0 && line > 0 && p.comments[0].Token.Line < line
+}
+
+// listItem is an item of a bracketed list: the nodes it starts and ends
+// with, and how to print it.
+type listItem struct {
+	first, last ast.Node
+	print       func()
+}
+
+// list prints items and then close, the end of the list, written as the
+// token closeToken. A list with comments between its items is printed one
+// item to a line, so that each comment stays beside the item it was written
+// after.
+func (p *printer) list(items []listItem, close string, closeToken token.Token) {
+	if !p.commentInList(items, closeToken.Line) {
+		for i, item := range items {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			item.print()
+		}
+		p.out.WriteString(close)
+		return
+	}
+
+	p.indent++
+	p.first = true
+	for i, item := range items {
+		p.item(firstLine(item.first))
+		item.print()
+		next := closeToken
+		if i < len(items)-1 {
+			p.out.WriteString(",")
+			next = firstToken(items[i+1].first)
+		}
+		p.trailingComments(lastLine(item.last), next)
+	}
+	p.commentsBefore(closeToken.Line)
+	p.indent--
+	p.newline(0)
+	p.out.WriteString(close)
+	p.line = closeToken.Line
+}
+
+// commentInList reports whether a comment waiting to be printed comes
+// before source line closeLine without being inside a block or a list
+// nested in one of items, which print their own comments.
+func (p *printer) commentInList(items []listItem, closeLine int) bool {
+	if closeLine == 0 {
+		return false
+	}
+
+	for _, c := range p.comments {
+		line := c.Token.Line
+		if line >= closeLine {
+			return false
+		}
+
+		nested := false
+		for _, item := range items {
+			for _, node := range []ast.Node{item.first, item.last} {
+				ast.Inspect(node, func(node ast.Node) bool {
+					if open, close := span(node); open <= line && line < close {
+						nested = true
+					}
+					return !nested
+				})
+			}
+		}
+		if !nested {
+			return true
+		}
+	}
+	return false
+}
+
+// span is the source lines from the opening to the closing line of node,
+// if it is a block or a list, for the comments within that it prints.
+func span(node ast.Node) (int, int) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		return node.Token.Line, node.Rbrace.Line
+	case *ast.HashLiteral:
+		return node.Token.Line, node.Rbrace.Line
+	case *ast.ArrayLiteral:
+		return node.Token.Line, node.Rbracket.Line
+	case *ast.CallExpression:
+		return node.Token.Line, node.Rparen.Line
+	case *ast.FunctionLiteral:
+		return node.Token.Line, node.Rparen.Line
+	}
+	return 0, 0
+}
+
+func (p *printer) identifiers(list []*ast.Identifier) {
+	for i, ident := range list {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.out.WriteString(ident.String())
+	}
+}
+
+func (p *printer) expressionItems(list []ast.Expression) []listItem {
+	items := []listItem{}
+	for _, e := range list {
+		items = append(items, listItem{e, e, func() { p.expression(e) }})
+	}
+	return items
+}
+
+func (p *printer) expressions(list []ast.Expression) {
+	for i, e := range list {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(e)
+	}
+}
+
+func (p *printer) function(f *ast.FunctionLiteral, name string) {
+	p.out.WriteString("fn")
+	if f.Generator {
+		p.out.WriteString("*")
+	}
+	if name != "" {
+		p.out.WriteString(" " + name)
+	}
+	p.out.WriteString("(")
+	params := []listItem{}
+	for _, param := range f.Parameters {
+		params = append(params, listItem{param, param, func() { p.out.WriteString(param.String()) }})
+	}
+	p.list(params, ")", f.Rparen)
+	if f.ReturnType != nil {
+		p.out.WriteString(" -> " + f.ReturnType.String())
+	}
+	p.out.WriteString(" ")
+	p.block(f.Body)
+}
+
+func (p *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(e.Value)
+
+	case *ast.IntegerLiteral:
+		p.out.WriteString(fmt.Sprint(e.Value))
+
+	case *ast.StringLiteral:
+		p.out.WriteString(`"` + e.Value + `"`)
+
+	case *ast.Boolean:
+		p.out.WriteString(fmt.Sprint(e.Value))
+
+	case *ast.PrefixExpression:
+		p.out.WriteString(e.Operator)
+		if isWord(e.Operator) {
+			p.out.WriteString(" ")
+		}
+		p.operand(e.Right, precedence(e.Right) < parser.PREFIX)
+
+	case *ast.InfixExpression:
+		prec := operatorPrecedence(e.Operator)
+		p.operand(e.Left, precedence(e.Left) < prec)
+		p.out.WriteString(" " + e.Operator + " ")
+		p.operand(e.Right, precedence(e.Right) <= prec)
+
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(e.Condition)
+		p.out.WriteString(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			if p.commentBetween(e.Consequence.Rbrace, e.Alternative.Token) {
+				p.trailingComments(e.Consequence.Rbrace.Line, e.Alternative.Token)
+				p.newline(0)
+				p.out.WriteString("else ")
+			} else {
+				p.out.WriteString(" else ")
+			}
+			p.block(e.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		p.function(e, "")
+
+	case *ast.CallExpression:
+		p.operand(e.Function, precedence(e.Function) < parser.CALL)
+		p.out.WriteString("(")
+		p.list(p.expressionItems(e.Arguments), ")", e.Rparen)
+
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.list(p.expressionItems(e.Elements), "]", e.Rbracket)
+
+	case *ast.HashLiteral:
+		p.out.WriteString("{")
+		pairs := []listItem{}
+		for _, key := range e.OrderedKeys() {
+			pairs = append(pairs, listItem{key, e.Pairs[key], func() {
+				p.expression(key)
+				p.out.WriteString(": ")
+				p.expression(e.Pairs[key])
+			}})
+		}
+		p.list(pairs, "}", e.Rbrace)
+
+	case *ast.IndexExpression:
+		p.operand(e.Left, precedence(e.Left) < parser.INDEX)
+		p.out.WriteString("[")
+		p.expression(e.Index)
+		p.out.WriteString("]")
+
+	case *ast.MemberExpression:
+		p.operand(e.Object, precedence(e.Object) < parser.INDEX)
+		p.out.WriteString("." + e.Property.Value)
+
+	case *ast.YieldExpression:
+		p.out.WriteString("yield ")
+		p.expression(e.Value)
+
+	case *ast.SpawnExpression:
+		p.out.WriteString("spawn(")
+		p.expressions(append([]ast.Expression{e.Function}, e.Arguments...))
+		p.out.WriteString(")")
+
+	case *ast.SelectExpression:
+		p.out.WriteString("select {")
+		p.indent++
+		p.first = true
+		for i, c := range e.Cases {
+			p.item(c.Token.Line)
+			p.selectCase(c)
+			next := e.Rbrace
+			if i+1 < len(e.Cases) {
+				next = e.Cases[i+1].Token
+			} else if e.Default != nil {
+				next = e.Default.Token
+			}
+			p.trailingComments(c.Body.Rbrace.Line, next)
+		}
+		if e.Default != nil {
+			p.item(e.Default.Token.Line)
+			p.out.WriteString("default ")
+			p.block(e.Default)
+			p.trailingComments(e.Default.Rbrace.Line, e.Rbrace)
+		}
+		p.indent--
+		p.newline(0)
+		p.out.WriteString("}")
+
+	case *ast.MatchExpression:
+		p.out.WriteString("match (")
+		p.expression(e.Subject)
+		p.out.WriteString(") {")
+		p.indent++
+		p.first = true
+		for i, arm := range e.Arms {
+			p.item(arm.Token.Line)
+			p.out.WriteString(arm.Pattern)
+			if len(arm.Bindings) > 0 {
+				p.out.WriteString("(")
+				p.identifiers(arm.Bindings)
+				p.out.WriteString(")")
+			}
+			p.out.WriteString(" ")
+			p.block(arm.Body)
+			next := e.Rbrace
+			if i+1 < len(e.Arms) {
+				next = e.Arms[i+1].Token
+			} else if e.Default != nil {
+				next = e.Default.Token
+			}
+			p.trailingComments(arm.Body.Rbrace.Line, next)
+		}
+		if e.Default != nil {
+			p.item(e.Default.Token.Line)
+			p.out.WriteString("default ")
+			p.block(e.Default)
+			p.trailingComments(e.Default.Rbrace.Line, e.Rbrace)
+		}
+		p.indent--
+		p.newline(0)
+		p.out.WriteString("}")
+
+	default:
+		p.out.WriteString(e.String())
+	}
+}
+
+func (p *printer) selectCase(c *ast.SelectCase) {
+	p.out.WriteString("case ")
+	if c.Send {
+		p.out.WriteString("send(")
+		p.expressions([]ast.Expression{c.Channel, c.Value})
+		p.out.WriteString(")")
+	} else {
+		if c.Name != nil {
+			p.out.WriteString(c.Name.Value + " = ")
+		}
+		p.out.WriteString("recv(")
+		p.expression(c.Channel)
+		p.out.WriteString(")")
+	}
+	p.out.WriteString(" ")
+	p.block(c.Body)
+}
+
+func (p *printer) operand(e ast.Expression, parenthesize bool) {
+	if parenthesize {
+		p.out.WriteString("(")
+		p.expression(e)
+		p.out.WriteString(")")
+		return
+	}
+	p.expression(e)
+}
+
+// precedence is how tightly e holds together when used as an operand.
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return operatorPrecedence(e.Operator)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.YieldExpression:
+		return parser.LOWEST
+	default:
+		return parser.INDEX + 1
+	}
+}
+
+func operatorPrecedence(operator string) int {
+	t := token.LookupIdentifier(operator)
+	if t == token.IDENT {
+		t = token.TokenType(operator)
+	}
+	return parser.Precedence(t)
+}
+
+func isWord(s string) bool {
+	return s != "" && unicode.IsLetter(rune(s[0]))
+}
+
+// endsWithBlock reports whether e is printed ending in a block, after which
+// a statement reads fine without a semicolon.
+func endsWithBlock(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IfExpression, *ast.MatchExpression, *ast.SelectExpression, *ast.FunctionLiteral:
+		return true
+	}
+	return false
+}
+
+// continues reports whether s would be read as part of the expression
+// before it.
+func continues(s ast.Statement) bool {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	printed := Node(es.Expression)
+	if printed == "" {
+		return false
+	}
+	switch c := printed[0]; {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return false
+	case c == '_' || c == '"' || c == '{' || c == '!':
+		return false
+	}
+	return true
+}
+
+// firstLine is the source line a node starts on, or 0 if it has no
+// positions.
+func firstLine(node ast.Node) int {
+	line := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		if l := nodeLine(node); l > 0 && (line == 0 || l < line) {
+			line = l
+		}
+		return true
+	})
+	return line
+}
+
+// lastLine is the source line a node ends on, as far as its tokens and
+// closing braces tell.
+func lastLine(node ast.Node) int {
+	line := 0
+	ast.Inspect(node, func(node ast.Node) bool {
+		if l := nodeLine(node); l > line {
+			line = l
+		}
+		for _, name := range []string{"Rbrace", "Rbracket", "Rparen"} {
+			if l := tokenLine(node, name); l > line {
+				line = l
+			}
+		}
+		return true
+	})
+	return line
+}
+
+// firstToken is the token a node starts with, or the zero token if it has
+// no positions.
+func firstToken(node ast.Node) token.Token {
+	first := token.Token{}
+	ast.Inspect(node, func(node ast.Node) bool {
+		if t := nodeToken(node, "Token"); t.Line > 0 && (first.Line == 0 || before(t, first)) {
+			first = t
+		}
+		return true
+	})
+	return first
+}
+
+// nodeLine is the source line of the token a node was parsed from.
+func nodeLine(node ast.Node) int {
+	return tokenLine(node, "Token")
+}
+
+// tokenLine is the line of the token.Token field name of node, or 0 if it
+// has none.
+func tokenLine(node ast.Node, name string) int {
+	return nodeToken(node, name).Line
+}
+
+// nodeToken is the token.Token field name of node, or the zero token if it
+// has none.
+func nodeToken(node ast.Node, name string) token.Token {
+	if node == nil {
+		return token.Token{}
+	}
+	field := reflect.ValueOf(node).Elem().FieldByName(name)
+	if !field.IsValid() {
+		return token.Token{}
+	}
+	return field.Interface().(token.Token)
+}
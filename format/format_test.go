@@ -0,0 +1,179 @@
+package format
+
+import (
+	"testing"
+
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+func TestCommentsStayInPlace(t *testing.T) {
+	inputs := []string{
+		"let h = {\n\t# a\n\t\"a\": 1,\n\t\"b\": 2 # b\n};\n",
+		"let h = {\n\t# nothing yet\n};\n",
+		"let f = fn(\n\tx, # the x\n\ty\n) {\n\tx + y\n};\n",
+		"f(\n\t1, # one\n\t2\n);\n",
+		"f([\n\t1, # one\n\t2\n], 3);\n",
+		"let a = [\n\t1, # one\n\n\t# two\n\t2\n];\nlet b = 1;\n",
+		"map(xs, fn(x) {\n\t# double it\n\tx * 2\n});\n",
+		"match (s) {\n\tCircle(r) {\n\t\tr\n\t} # round\n\tEmpty {\n\t\t0\n\t} # none\n}\n",
+		"select {\n\tcase v = recv(c) {\n\t\tv\n\t} # got\n\tdefault {} # nothing\n}\n",
+		"if (a) {\n\tb\n} # then\nelse {\n\tc\n}\n",
+		"impl P {\n\tfn m(p) {\n\t\tp\n\t} # m\n\tfn n(p) {\n\t\tp\n\t}\n}\n",
+	}
+
+	for _, input := range inputs {
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+			continue
+		}
+		if string(formatted) != input {
+			t.Errorf("formatting moved a comment.\nwant %q\ngot  %q", input, formatted)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x=1+2*3`, "let x = 1 + 2 * 3;\n"},
+		{`(1 + 2) * 3; 1 - (2 - 3); (1 - 2) - 3`, "(1 + 2) * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{`-(a + b); !(-a); -a * b`, "-(a + b);\n!-a;\n-a * b;\n"},
+		{`f(x)[0].y; (fn(x) { x })(1)`, "f(x)[0].y;\nfn(x) {\n\tx\n}(1);\n"},
+		{`let a=[1,2 , 3]; let h={"a":1, "b":[]}; {}`, "let a = [1, 2, 3];\nlet h = {\"a\": 1, \"b\": []};\n{};\n"},
+		{`let f = fn(x: int, y) -> [int] { return [x, y]; }`, "let f = fn(x: int, y) -> [int] {\n\treturn [x, y];\n};\n"},
+		{`let g = fn*() { yield 1; yield 2 }; let e = fn() {}`, "let g = fn*() {\n\tyield 1;\n\tyield 2\n};\nlet e = fn() {};\n"},
+		{`if (a) { b } else { c }`, "if (a) {\n\tb\n} else {\n\tc\n}\n"},
+		{`if (a) { b } puts(1)`, "if (a) {\n\tb\n}\nputs(1);\n"},
+		{`if (a) { b }; -c`, "if (a) {\n\tb\n};\n-c;\n"},
+		{`if (a) { b }; [c]`, "if (a) {\n\tb\n};\n[c];\n"},
+		{`struct Point {x,y}`, "struct Point { x, y }\n"},
+		{`impl Point { fn norm(p) { p.x } fn* each(p) { yield p.x } }`, "impl Point {\n\tfn norm(p) {\n\t\tp.x\n\t}\n\tfn* each(p) {\n\t\tyield p.x\n\t}\n}\n"},
+		{"enum Shape {\n  Circle(r),\n  Empty\n}", "enum Shape { Circle(r), Empty }\n"},
+		{`match (s) { Shape.Circle(r) { r } Empty { 0 } default { 1 } }`, "match (s) {\n\tShape.Circle(r) {\n\t\tr\n\t}\n\tEmpty {\n\t\t0\n\t}\n\tdefault {\n\t\t1\n\t}\n}\n"},
+		{`select { case v = recv(c) { v } case send(c, 1) { 1 } case recv(c) {} }`, "select {\n\tcase v = recv(c) {\n\t\tv\n\t}\n\tcase send(c, 1) {\n\t\t1\n\t}\n\tcase recv(c) {}\n}\n"},
+		{`spawn(f, 1, 2); 1 in set([1])`, "spawn(f, 1, 2);\n1 in set([1]);\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("%q: wrong output.\nwant %q\ngot  %q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"# top\nlet a = 1; # one\n\n\n# two\nlet b = 2;\n# end", "# top\nlet a = 1; # one\n\n# two\nlet b = 2;\n# end\n"},
+		{"let f = fn() { # start\n  a\n  # before the brace\n};", "let f = fn() {\n\t# start\n\ta\n\t# before the brace\n};\n"},
+		{"let f = fn() {\n  # only a comment\n};", "let f = fn() {\n\t# only a comment\n};\n"},
+		{"let h = {\n  \"a\": 1, # first\n  \"b\": 2\n}; # done", "let h = {\n\t\"a\": 1, # first\n\t\"b\": 2\n}; # done\n"},
+		{"if (a) {\n  b\n} # after\nc", "if (a) {\n\tb\n} # after\nc;\n"},
+		{"impl P {\n  # a method\n  fn m(p) { p } # short\n}", "impl P {\n\t# a method\n\tfn m(p) {\n\t\tp\n\t} # short\n}\n"},
+		{"let xs = [1, 2, # after two\n 3];", "let xs = [\n\t1,\n\t2, # after two\n\t3\n];\n"},
+		{"let add = fn(a, b) { a + b }; # trailing", "let add = fn(a, b) {\n\ta + b\n}; # trailing\n"},
+		{"f(1, fn() { 2 } # after the function\n);", "f(\n\t1,\n\tfn() {\n\t\t2\n\t} # after the function\n);\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		if string(formatted) != tt.expected {
+			t.Errorf("%q: wrong output.\nwant %q\ngot  %q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestIdempotentAndPreservesAST(t *testing.T) {
+	inputs := []string{
+		`# Fibonacci numbers
+let fib = fn(n) {   # naive
+  if (n < 2) { return n; }
+  fib(n-1)+fib(n - 2)
+
+};
+let xs = [1,2 , 3];   let h = {"a": 1, "b": (1+2)*3};
+
+# print them
+puts(fib(10)) ;
+if (true) { puts(1) } else { puts(2) }
+-1
+struct Point {
+  x,
+  y
+}
+impl Point {
+  # length squared
+  fn norm(self) { self.x*self.x + self.y*self.y }
+  fn* each(self) { yield self.x; yield self.y }
+}
+enum Shape { Circle(r), Empty }
+let area = fn(s: Shape) -> int { match (s) { Circle(r) { 3*r*r } default { 0 } } };
+select { case v = recv(ch) { v } default {
+  # nothing ready
+} }
+a - (b - c) ; (a - b) - c; -(a + b); !(-a); f(x)[0].y; (fn(x) { x })(1);
+# end`,
+		`let map = fn(arr, f) { let iter = fn(arr, acc) { if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) } }; iter(arr, []) };`,
+		"let a = [\n1, # one\n2 # two\n];\nlet b = 1",
+	}
+
+	for _, input := range inputs {
+		once, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("%q: %s", once, err)
+		}
+		if string(once) != string(twice) {
+			t.Errorf("formatting is not idempotent.\nonce:\n%s\ntwice:\n%s", once, twice)
+		}
+
+		original := parser.New(lexer.New(input)).ParseProgram()
+		formatted := parser.New(lexer.New(string(once))).ParseProgram()
+		if original.String() != formatted.String() {
+			t.Errorf("formatting changed the program.\nwant %s\ngot  %s", original.String(), formatted.String())
+		}
+		if len(original.Comments) != len(formatted.Comments) {
+			t.Errorf("formatting lost comments: %d, then %d", len(original.Comments), len(formatted.Comments))
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let = 1;`, "Expected next token to be IDENT but got = instead\nNo prefix parse function for = found"},
+		{"let q = 2\nlet r = 3;\nputs(q)", `format: 2:1: the parser skipped "let"`},
+		{"fn() { let q = 2 q }", `format: 1:18: the parser skipped "q"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Source([]byte(tt.input))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong error.\nwant %q\ngot  %q", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"strings"
+
 	"monkey/token"
 )
 
@@ -9,19 +11,52 @@ type Lexer struct {
 	position      int  // current position or the index of 'current_char'
 	read_position int  // next position to read
 	current_char  byte // current character that is getting analyzed
+	line          int  // line of current_char
+	line_start    int  // position of the first character of line
+	comments      []token.Token
+	trivia        bool // Return whitespace and comments as tokens too
 }
 
 func New(code string) *Lexer {
-	lexer := &Lexer{input: code}
+	lexer := &Lexer{input: code, line: 1}
 	lexer.read_char()
 	return lexer
 }
 
+// NewWithTrivia returns a lexer that also returns the whitespace and
+// comments between tokens, as WHITESPACE and COMMENT tokens. Together the
+// tokens it returns cover every byte of code.
+func NewWithTrivia(code string) *Lexer {
+	lexer := New(code)
+	lexer.trivia = true
+	return lexer
+}
+
 func (lexer *Lexer) NextToken() token.Token {
 	var tkn token.Token
 
+	if lexer.trivia {
+		if tkn, ok := lexer.readTrivia(); ok {
+			return tkn
+		}
+	}
+
 	lexer.skip_whitespace()
-	lexer.skipComment()
+	for lexer.current_char == '#' {
+		lexer.readComment()
+		lexer.skip_whitespace()
+	}
+
+	line, column := lexer.line, lexer.position-lexer.line_start+1
+
+	if lexer.position < len(lexer.input) {
+		if op, ok := token.LookupOperator(lexer.input[lexer.position:]); ok {
+			for range op {
+				lexer.read_char()
+			}
+			return token.Token{Type: token.TokenType(op), Literal: op, Line: line, Column: column}
+		}
+	}
 
 	switch lexer.current_char {
 	case '=':
@@ -35,7 +70,13 @@ func (lexer *Lexer) NextToken() token.Token {
 	case '+':
 		tkn = new_token(token.PLUS, lexer.current_char)
 	case '-':
-		tkn = new_token(token.MINUS, lexer.current_char)
+		if lexer.peek_next_char() == '>' {
+			tkn.Type = token.ARROW
+			tkn.Literal = "->"
+			lexer.read_char()
+		} else {
+			tkn = new_token(token.MINUS, lexer.current_char)
+		}
 	case '(':
 		tkn = new_token(token.LPAREN, lexer.current_char)
 	case ')':
@@ -50,6 +91,8 @@ func (lexer *Lexer) NextToken() token.Token {
 		tkn = new_token(token.SEMICOLON, lexer.current_char)
 	case ':':
 		tkn = new_token(token.COLON, lexer.current_char)
+	case '.':
+		tkn = new_token(token.DOT, lexer.current_char)
 	case '!':
 		if lexer.peek_next_char() == '=' {
 			tkn.Type = token.NOT_EQ
@@ -80,10 +123,12 @@ func (lexer *Lexer) NextToken() token.Token {
 		if is_letter(lexer.current_char) {
 			tkn.Literal = lexer.read_identifier()
 			tkn.Type = token.LookupIdentifier(tkn.Literal)
+			tkn.Line, tkn.Column = line, column
 			return tkn
 		} else if is_digit(lexer.current_char) {
 			tkn.Type = token.INT
 			tkn.Literal = lexer.read_digit()
+			tkn.Line, tkn.Column = line, column
 			return tkn
 		} else {
 			tkn = new_token(token.ILLEGAL, lexer.current_char)
@@ -91,16 +136,46 @@ func (lexer *Lexer) NextToken() token.Token {
 	}
 
 	lexer.read_char()
+	tkn.Line, tkn.Column = line, column
 	return tkn
 }
 
-func (lexer *Lexer) skipComment() {
-	if lexer.current_char != '#' {
-		return
+// readTrivia reads a run of whitespace or a comment, if one starts at the
+// current character.
+func (lexer *Lexer) readTrivia() (token.Token, bool) {
+	line, column := lexer.line, lexer.position-lexer.line_start+1
+
+	switch lexer.current_char {
+	case ' ', '\t', '\n', '\r':
+		start_position := lexer.position
+		lexer.skip_whitespace()
+		return token.Token{Type: token.WHITESPACE, Literal: lexer.input[start_position:lexer.position], Line: line, Column: column}, true
+	case '#':
+		lexer.readComment()
+		return lexer.comments[len(lexer.comments)-1], true
 	}
-	for lexer.current_char != 0 {
+
+	return token.Token{}, false
+}
+
+// readComment skips a comment running from '#' to the end of the line,
+// keeping it for Comments.
+func (lexer *Lexer) readComment() {
+	comment := token.Token{Type: token.COMMENT, Line: lexer.line, Column: lexer.position - lexer.line_start + 1}
+
+	start_position := lexer.position
+	for lexer.current_char != '\n' && lexer.current_char != 0 {
 		lexer.read_char()
 	}
+	comment.Literal = strings.TrimRight(lexer.input[start_position:lexer.position], " \t\r")
+
+	lexer.comments = append(lexer.comments, comment)
+}
+
+// Comments returns the comments the lexer has skipped so far, in order.
+// Their Literal includes the '#'.
+func (lexer *Lexer) Comments() []token.Token {
+	return lexer.comments
 }
 
 func (lexer *Lexer) readString() string {
@@ -149,6 +224,10 @@ func new_token(token_type token.TokenType, char byte) token.Token {
 }
 
 func (lexer *Lexer) read_char() {
+	if lexer.current_char == '\n' {
+		lexer.line++
+		lexer.line_start = lexer.read_position
+	}
 	if lexer.read_position >= len(lexer.input) {
 		lexer.current_char = 0
 	} else {
@@ -6,6 +6,109 @@ import (
 	"monkey/token"
 )
 
+func TestTrivia(t *testing.T) {
+	input := "let a = 1; # one\n\t a"
+
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+		{Type: token.WHITESPACE, Literal: " ", Line: 1, Column: 4},
+		{Type: token.IDENT, Literal: "a", Line: 1, Column: 5},
+		{Type: token.WHITESPACE, Literal: " ", Line: 1, Column: 6},
+		{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 7},
+		{Type: token.WHITESPACE, Literal: " ", Line: 1, Column: 8},
+		{Type: token.INT, Literal: "1", Line: 1, Column: 9},
+		{Type: token.SEMICOLON, Literal: ";", Line: 1, Column: 10},
+		{Type: token.WHITESPACE, Literal: " ", Line: 1, Column: 11},
+		{Type: token.COMMENT, Literal: "# one", Line: 1, Column: 12},
+		{Type: token.WHITESPACE, Literal: "\n\t ", Line: 1, Column: 17},
+		{Type: token.IDENT, Literal: "a", Line: 2, Column: 3},
+		{Type: token.EOF, Literal: "", Line: 2, Column: 4},
+	}
+
+	l := NewWithTrivia(input)
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok != want {
+			t.Fatalf("tests[%d]: expected %+v, got %+v", i, want, tok)
+		}
+	}
+}
+
+func TestLineComments(t *testing.T) {
+	input := `# header
+let a = 1; # one
+  # indented
+a`
+
+	l := New(input)
+	types := []token.TokenType{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	if len(types) != 6 || types[5] != token.IDENT {
+		t.Fatalf("expected the code after a comment to be lexed, got %v", types)
+	}
+
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "# header", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "# one", Line: 2, Column: 12},
+		{Type: token.COMMENT, Literal: "# indented", Line: 3, Column: 3},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("expected %d comments, got %d", len(expected), len(comments))
+	}
+	for i, want := range expected {
+		if comments[i] != want {
+			t.Errorf("comments[%d]: expected %+v, got %+v", i, want, comments[i])
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x: int = 5;
+fn(a) -> bool {
+  "s"
+}`
+
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.COLON, 1, 6},
+		{token.IDENT, 1, 8},
+		{token.ASSIGN, 1, 12},
+		{token.INT, 1, 14},
+		{token.SEMICOLON, 1, 15},
+		{token.FUNCTION, 2, 1},
+		{token.LPAREN, 2, 3},
+		{token.IDENT, 2, 4},
+		{token.RPAREN, 2, 5},
+		{token.ARROW, 2, 7},
+		{token.IDENT, 2, 10},
+		{token.LBRACE, 2, 15},
+		{token.STRING, 3, 3},
+		{token.RBRACE, 4, 1},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
 func TestComment(t *testing.T) {
 	input := `let five = 5; #Hello
 	`
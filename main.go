@@ -1,9 +1,9 @@
 package main
 
 import (
-	"os"
 	"io"
 	"monkey/repl"
+	"os"
 )
 
 const LANGUAGE_NAME = `
@@ -31,6 +31,10 @@ const LANGUAGE_NAME = `
 `
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	printStartMessage(os.Stdout)
 
 	repl.Start(os.Stdin, os.Stdout)
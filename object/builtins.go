@@ -25,6 +25,21 @@ var Builtins = []struct {
 	{
 		"push", &Builtin{Fn: pushFn},
 	},
+	{
+		"chan", &Builtin{Fn: chanFn},
+	},
+	{
+		"send", &Builtin{Fn: sendFn},
+	},
+	{
+		"recv", &Builtin{Fn: recvFn},
+	},
+	{
+		"close", &Builtin{Fn: closeFn},
+	},
+	{
+		"set", &Builtin{Fn: setFn},
+	},
 }
 
 func pushFn(args ...Object) Object {
@@ -110,6 +125,10 @@ func lenFn(args ...Object) Object {
 		return &Integer{Value: int64(len(arg.Elements))}
 	case *String:
 		return &Integer{Value: int64(len(arg.Value))}
+	case *Hash:
+		return &Integer{Value: int64(len(arg.Pairs))}
+	case *Set:
+		return &Integer{Value: int64(len(arg.Elements))}
 	default:
 		return newError("argument to `len` not supported, got %s", args[0].Type())
 	}
@@ -0,0 +1,147 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Channel wraps a Go channel so that spawned functions can hand values to
+// each other. Receiving from a closed, drained channel yields null.
+type Channel struct {
+	Ch chan Object
+}
+
+func NewChannel(size int) *Channel {
+	return &Channel{Ch: make(chan Object, size)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("chan(%d)", cap(c.Ch)) }
+
+// SelectCase is one arm of a select expression. Value is only used when Send
+// is set.
+type SelectCase struct {
+	Channel Object
+	Value   Object
+	Send    bool
+}
+
+// Select waits until one of the cases can proceed, or returns len(cases)
+// straight away if none can and hasDefault is set. It returns the index of
+// the chosen case and, for a receive, the value received.
+func Select(cases []SelectCase, hasDefault bool) (chosen int, value Object, err error) {
+	selectCases := make([]reflect.SelectCase, 0, len(cases)+1)
+	for _, c := range cases {
+		ch, ok := c.Channel.(*Channel)
+		if !ok {
+			return 0, nil, fmt.Errorf("select case needs a CHANNEL, got %s", c.Channel.Type())
+		}
+
+		if c.Send {
+			selectCases = append(selectCases, reflect.SelectCase{
+				Dir:  reflect.SelectSend,
+				Chan: reflect.ValueOf(ch.Ch),
+				Send: reflect.ValueOf(&c.Value).Elem(),
+			})
+		} else {
+			selectCases = append(selectCases, reflect.SelectCase{
+				Dir:  reflect.SelectRecv,
+				Chan: reflect.ValueOf(ch.Ch),
+			})
+		}
+	}
+
+	if hasDefault {
+		selectCases = append(selectCases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("send on closed channel")
+		}
+	}()
+
+	chosen, received, ok := reflect.Select(selectCases)
+	if chosen == len(cases) || cases[chosen].Send || !ok {
+		return chosen, NULL, nil
+	}
+
+	return chosen, received.Interface().(Object), nil
+}
+
+func chanFn(args ...Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+
+	size := int64(0)
+	if len(args) == 1 {
+		integer, ok := args[0].(*Integer)
+		if !ok {
+			return newError("argument to `chan` must be INTEGER, got %s", args[0].Type())
+		}
+		if integer.Value < 0 {
+			return newError("channel size must not be negative, got %d", integer.Value)
+		}
+		size = integer.Value
+	}
+
+	return NewChannel(int(size))
+}
+
+func sendFn(args ...Object) (result Object) {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	ch, ok := args[0].(*Channel)
+	if !ok {
+		return newError("argument to `send` must be CHANNEL, got %s", args[0].Type())
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("send on closed channel")
+		}
+	}()
+
+	ch.Ch <- args[1]
+	return NULL
+}
+
+func recvFn(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	ch, ok := args[0].(*Channel)
+	if !ok {
+		return newError("argument to `recv` must be CHANNEL, got %s", args[0].Type())
+	}
+
+	value, ok := <-ch.Ch
+	if !ok {
+		return NULL
+	}
+	return value
+}
+
+func closeFn(args ...Object) (result Object) {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	ch, ok := args[0].(*Channel)
+	if !ok {
+		return newError("argument to `close` must be CHANNEL, got %s", args[0].Type())
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("close of closed channel")
+		}
+	}()
+
+	close(ch.Ch)
+	return NULL
+}
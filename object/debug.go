@@ -0,0 +1,80 @@
+package object
+
+import (
+	"strings"
+
+	"monkey/code"
+)
+
+// DebugInfo describes the source of a function literal: its name, the
+// names of its variables and the positions of its instructions. Identical
+// literals share one CompiledFunction, so the DebugInfo goes with each
+// closure instead, which takes it from the function that creates it.
+type DebugInfo struct {
+	Name      string          // Empty for anonymous functions and the main program
+	Locals    []Local         // One per local slot, the parameters first
+	Free      []string        // Names of the free variables, in the order of Closure.Free
+	SourceMap *code.SourceMap // Where in the source each instruction comes from
+
+	// Of the function literals compiled inside, by the offset of the
+	// OpClosure that creates their closures
+	Closures map[int]*DebugInfo
+}
+
+// Local names a local slot of a compiled function. The slot holds the
+// variable while the instructions from Start up to End run.
+type Local struct {
+	Name       string
+	Start, End int
+}
+
+// Closure returns the DebugInfo of the function literal whose closure the
+// OpClosure at offset creates, or nil if there is none.
+func (d *DebugInfo) Closure(offset int) *DebugInfo {
+	if d == nil {
+		return nil
+	}
+	return d.Closures[offset]
+}
+
+// Position returns the position of the instruction at ip.
+func (d *DebugInfo) Position(ip int) (code.Position, bool) {
+	if d == nil {
+		return code.Position{}, false
+	}
+	return d.SourceMap.Position(ip)
+}
+
+// Signature returns fn as written in the source, like fn fibonacci(x).
+func (d *DebugInfo) Signature(fn *CompiledFunction) string {
+	params := []string{}
+	for i := 0; i < fn.NumParameters && i < len(d.Locals); i++ {
+		params = append(params, d.Locals[i].Name)
+	}
+
+	var out strings.Builder
+	out.WriteString("fn")
+	if fn.Generator {
+		out.WriteString("*")
+	}
+	if d.Name != "" {
+		out.WriteString(" " + d.Name)
+	}
+	out.WriteString("(" + strings.Join(params, ", ") + ")")
+	return out.String()
+}
+
+// LocalsAt returns the slots of the locals that hold a variable when the
+// instruction at ip runs, by name.
+func (d *DebugInfo) LocalsAt(ip int) map[string]int {
+	live := map[string]int{}
+	if d == nil {
+		return live
+	}
+	for i, local := range d.Locals {
+		if local.Start <= ip && ip < local.End {
+			live[local.Name] = i
+		}
+	}
+	return live
+}
@@ -0,0 +1,110 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Enum is the value an enum declaration binds to its name. Its variants are
+// reached as members: Shape.Circle is a constructor, while a variant without
+// fields, like Shape.Empty, is the variant value itself.
+type Enum struct {
+	Name     string
+	Variants []*VariantConstructor
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string {
+	variants := []string{}
+	for _, v := range e.Variants {
+		variants = append(variants, v.signature())
+	}
+	return fmt.Sprintf("enum %s { %s }", e.Name, strings.Join(variants, ", "))
+}
+
+func (e *Enum) Member(name string) (Object, bool) {
+	for _, v := range e.Variants {
+		if v.Name != name {
+			continue
+		}
+		if len(v.Fields) == 0 {
+			return v.unit, true
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+// VariantConstructor builds the values of one variant of an enum.
+type VariantConstructor struct {
+	Enum   string
+	Name   string
+	Fields []string
+
+	unit *Variant // The only value of a variant without fields
+}
+
+func NewVariantConstructor(enum, name string, fields []string) *VariantConstructor {
+	vc := &VariantConstructor{Enum: enum, Name: name, Fields: fields}
+	if len(fields) == 0 {
+		vc.unit = &Variant{Constructor: vc}
+	}
+	return vc
+}
+
+func (vc *VariantConstructor) Type() ObjectType { return VARIANT_CONSTRUCTOR_OBJ }
+func (vc *VariantConstructor) Inspect() string  { return "variant " + vc.Enum + "." + vc.signature() }
+
+func (vc *VariantConstructor) signature() string {
+	if len(vc.Fields) == 0 {
+		return vc.Name
+	}
+	return vc.Name + "(" + strings.Join(vc.Fields, ", ") + ")"
+}
+
+func (vc *VariantConstructor) New(values []Object) Object {
+	if len(values) != len(vc.Fields) {
+		return newError("wrong number of fields for %s.%s: want=%d, got=%d", vc.Enum, vc.Name, len(vc.Fields), len(values))
+	}
+
+	slots := make([]Object, len(values))
+	copy(slots, values)
+
+	return &Variant{Constructor: vc, Values: slots}
+}
+
+// Variant is a tagged value of an enum. Two variants are equal when they
+// have the same tag and equal values.
+type Variant struct {
+	Constructor *VariantConstructor
+	Values      []Object
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	tag := v.Constructor.Enum + "." + v.Constructor.Name
+	if len(v.Values) == 0 {
+		return tag
+	}
+
+	values := []string{}
+	for _, value := range v.Values {
+		values = append(values, value.Inspect())
+	}
+	return tag + "(" + strings.Join(values, ", ") + ")"
+}
+
+func (v *Variant) Member(name string) (Object, bool) {
+	for i, f := range v.Constructor.Fields {
+		if f == name {
+			return v.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Matches reports whether a match pattern names this variant, either
+// unqualified ("Circle") or qualified by its enum ("Shape.Circle").
+func (v *Variant) Matches(pattern string) bool {
+	return pattern == v.Constructor.Name || pattern == v.Constructor.Enum+"."+v.Constructor.Name
+}
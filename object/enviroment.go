@@ -1,30 +1,140 @@
 package object
 
+import "sync"
+
+// Environment holds the variables of one function call, or of the program,
+// in the slots the evaluator's resolver gave them. The global environment
+// also knows its variables by name, so a program run in it later, like the
+// next line of the REPL, can refer to what earlier ones defined.
 type Environment struct {
-	store map[string]Object
+	mu    sync.RWMutex // Spawned functions may read an environment another goroutine writes to
+	store []Object
+	names map[string]int // Slots of the globals, nil below the global environment
+	size  int            // Number of global slots handed out
 	outer *Environment
+	yield func(Object)
 }
 
-func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+// NewEnclosedEnvironment returns the environment of a call with size
+// variables, whose free variables live in outer.
+func NewEnclosedEnvironment(outer *Environment, size int) *Environment {
+	return &Environment{store: make([]Object, size), outer: outer}
 }
 
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{names: map[string]int{}}
 }
 
+// Get returns the value of the global variable name.
 func (e *Environment) Get(name string) (Object, bool) {
-	env, ok := e.store[name]
-	if !ok && e.outer != nil {
-		return e.outer.Get(name)
+	slot, ok := e.Slot(name)
+	if !ok {
+		return nil, false
 	}
-	return env, ok
+	return e.Load(0, slot)
 }
 
+// Set defines the global variable name, which programs evaluated in e
+// afterwards can refer to.
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.Store(e.Define(name), val)
 	return val
 }
+
+// Slot returns the slot of the global variable name.
+func (e *Environment) Slot(name string) (int, bool) {
+	e.mu.RLock()
+	slot, ok := e.names[name]
+	e.mu.RUnlock()
+	return slot, ok
+}
+
+// Define returns the slot of the global variable name, giving it the next
+// free one if it has none yet.
+func (e *Environment) Define(name string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	slot, ok := e.names[name]
+	if !ok {
+		slot = e.size
+		e.size++
+		e.names[name] = slot
+	}
+	return slot
+}
+
+// NewSlot returns a global slot that no name refers to, for a variable of a
+// block, like a match arm, at the top level of a program.
+func (e *Environment) NewSlot() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	slot := e.size
+	e.size++
+	return slot
+}
+
+// Load returns the variable in slot of the environment depth levels out
+// from e. It reports false if the variable has not been set yet.
+func (e *Environment) Load(depth, slot int) (Object, bool) {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+
+	e.mu.RLock()
+	var val Object
+	if slot < len(e.store) {
+		val = e.store[slot]
+	}
+	e.mu.RUnlock()
+	return val, val != nil
+}
+
+// Store sets the variable in slot of e.
+func (e *Environment) Store(slot int, val Object) {
+	e.mu.Lock()
+	if slot >= len(e.store) {
+		// Globals get their slots as programs are resolved
+		store := make([]Object, slot+1)
+		copy(store, e.store)
+		e.store = store
+	}
+	e.store[slot] = val
+	e.mu.Unlock()
+}
+
+// Snapshot copies the bindings of e and every enclosing environment, so a
+// spawned function sees the variables as they were when it was spawned and
+// not the ones defined afterwards.
+func (e *Environment) Snapshot() *Environment {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.RLock()
+	store := make([]Object, len(e.store))
+	copy(store, e.store)
+	var names map[string]int
+	if e.names != nil {
+		names = make(map[string]int, len(e.names))
+		for name, slot := range e.names {
+			names[name] = slot
+		}
+	}
+	e.mu.RUnlock()
+
+	return &Environment{store: store, names: names, size: e.size, outer: e.outer.Snapshot()}
+}
+
+// Yield returns the function that suspends the generator running in this
+// environment, or nil outside of a generator. The evaluator hands it from
+// caller to callee, so a yield inside a helper function suspends the
+// generator that called the helper.
+func (e *Environment) Yield() func(Object) {
+	return e.yield
+}
+
+func (e *Environment) SetYield(yield func(Object)) {
+	e.yield = yield
+}
@@ -0,0 +1,64 @@
+package object
+
+import (
+	"sync/atomic"
+
+	"monkey/code"
+)
+
+// FieldCache is where an OpGetField remembers the struct type it last read
+// a field of and the slot of that field, so that reading the field again,
+// of any struct of that type, needs no lookup by name. Spawned functions
+// share their code, and so the caches, with the goroutine that spawned
+// them.
+type FieldCache struct {
+	last atomic.Pointer[fieldSlot]
+}
+
+type fieldSlot struct {
+	definition *StructType
+	index      int
+}
+
+// Field returns the field name of s, if s has one.
+func (c *FieldCache) Field(s *Struct, name string) (Object, bool) {
+	if slot := c.last.Load(); slot != nil && slot.definition == s.Definition {
+		return s.Fields[slot.index], true
+	}
+
+	i, ok := s.Definition.FieldIndex(name)
+	if !ok {
+		return nil, false
+	}
+	c.last.Store(&fieldSlot{definition: s.Definition, index: i})
+	return s.Fields[i], true
+}
+
+// FieldCache returns the field cache numbered i by the OpGetField that uses
+// it. The caches are made the first time one is needed.
+func (cf *CompiledFunction) FieldCache(i int) *FieldCache {
+	caches := cf.fieldCaches.Load()
+	if caches == nil {
+		made := make([]FieldCache, numFieldCaches(cf.Instructions))
+		cf.fieldCaches.CompareAndSwap(nil, &made)
+		caches = cf.fieldCaches.Load()
+	}
+	return &(*caches)[i]
+}
+
+func numFieldCaches(ins code.Instructions) int {
+	n := 0
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return n
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		op := code.Opcode(ins[i])
+		if (op == code.OpGetField || op == code.OpGetFieldWide) && operands[1] >= n {
+			n = operands[1] + 1
+		}
+		i += 1 + read
+	}
+	return n
+}
@@ -0,0 +1,369 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// Applier calls a Monkey function value from Go. Each engine hands its own
+// to a method so that methods like map can call back into user code.
+type Applier func(fn Object, args ...Object) Object
+
+// MethodFunction implements receiver.name(args...) for a builtin type.
+type MethodFunction func(apply Applier, receiver Object, args ...Object) Object
+
+// Methods holds the methods that '.name(...)' resolves to, per object type.
+var Methods = map[ObjectType]map[string]MethodFunction{
+	STRING_OBJ: {
+		"len":      builtinMethod(lenFn),
+		"upper":    stringUpperMethod,
+		"lower":    stringLowerMethod,
+		"trim":     stringTrimMethod,
+		"split":    stringSplitMethod,
+		"contains": stringContainsMethod,
+	},
+	ARRAY_OBJ: {
+		"len":    builtinMethod(lenFn),
+		"first":  builtinMethod(firstFn),
+		"last":   builtinMethod(lastFn),
+		"rest":   builtinMethod(restFn),
+		"push":   builtinMethod(pushFn),
+		"map":    arrayMapMethod,
+		"filter": arrayFilterMethod,
+		"reduce": arrayReduceMethod,
+		"join":   arrayJoinMethod,
+	},
+	HASH_OBJ: {
+		"len":    builtinMethod(lenFn),
+		"keys":   hashKeysMethod,
+		"values": hashValuesMethod,
+		"has":    hashHasMethod,
+	},
+	SET_OBJ: {
+		"len":          builtinMethod(lenFn),
+		"has":          setHasMethod,
+		"add":          setAddMethod,
+		"union":        setUnionMethod,
+		"intersection": setIntersectionMethod,
+		"difference":   setDifferenceMethod,
+		"values":       setValuesMethod,
+		"map":          setArrayMethod(arrayMapMethod),
+		"filter":       setArrayMethod(arrayFilterMethod),
+		"reduce":       setArrayMethod(arrayReduceMethod),
+	},
+	GENERATOR_OBJ: {
+		"next":   generatorNextMethod,
+		"done":   generatorDoneMethod,
+		"take":   generatorTakeMethod,
+		"map":    generatorMapMethod,
+		"filter": generatorFilterMethod,
+	},
+}
+
+// RegisterMethod adds or replaces a method on every value of type t.
+func RegisterMethod(t ObjectType, name string, fn MethodFunction) {
+	if Methods[t] == nil {
+		Methods[t] = map[string]MethodFunction{}
+	}
+	Methods[t][name] = fn
+}
+
+func LookupMethod(t ObjectType, name string) (MethodFunction, bool) {
+	fn, ok := Methods[t][name]
+	return fn, ok
+}
+
+// builtinMethod exposes a free builtin as a method, passing the receiver as
+// its first argument.
+func builtinMethod(fn BuiltinFunction) MethodFunction {
+	return func(apply Applier, receiver Object, args ...Object) Object {
+		return fn(append([]Object{receiver}, args...)...)
+	}
+}
+
+func stringUpperMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &String{Value: strings.ToUpper(receiver.(*String).Value)}
+}
+
+func stringLowerMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &String{Value: strings.ToLower(receiver.(*String).Value)}
+}
+
+func stringTrimMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &String{Value: strings.TrimSpace(receiver.(*String).Value)}
+}
+
+func stringSplitMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	sep, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `split` must be STRING, got %s", args[0].Type())
+	}
+
+	parts := strings.Split(receiver.(*String).Value, sep.Value)
+	elements := make([]Object, len(parts))
+	for i, part := range parts {
+		elements[i] = &String{Value: part}
+	}
+
+	return &Array{Elements: elements}
+}
+
+func stringContainsMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	sub, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `contains` must be STRING, got %s", args[0].Type())
+	}
+
+	return NativeBoolToBooleanObject(strings.Contains(receiver.(*String).Value, sub.Value))
+}
+
+func arrayMapMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	arr := receiver.(*Array)
+	elements := make([]Object, len(arr.Elements))
+	for i, e := range arr.Elements {
+		result := apply(args[0], e)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+
+	return &Array{Elements: elements}
+}
+
+func arrayFilterMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	elements := []Object{}
+	for _, e := range receiver.(*Array).Elements {
+		result := apply(args[0], e)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, e)
+		}
+	}
+
+	return &Array{Elements: elements}
+}
+
+func arrayReduceMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	acc := args[1]
+	for _, e := range receiver.(*Array).Elements {
+		acc = apply(args[0], acc, e)
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+func arrayJoinMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	sep, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `join` must be STRING, got %s", args[0].Type())
+	}
+
+	parts := []string{}
+	for _, e := range receiver.(*Array).Elements {
+		parts = append(parts, e.Inspect())
+	}
+
+	return &String{Value: strings.Join(parts, sep.Value)}
+}
+
+func hashKeysMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	keys := []Object{}
+	for _, pair := range sortedPairs(receiver.(*Hash)) {
+		keys = append(keys, pair.Key)
+	}
+
+	return &Array{Elements: keys}
+}
+
+func hashValuesMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	values := []Object{}
+	for _, pair := range sortedPairs(receiver.(*Hash)) {
+		values = append(values, pair.Value)
+	}
+
+	return &Array{Elements: values}
+}
+
+func hashHasMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	key, ok := args[0].(Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[0].Type())
+	}
+
+	_, ok = receiver.(*Hash).Pairs[key.HashKey()]
+	return NativeBoolToBooleanObject(ok)
+}
+
+func generatorNextMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	value, ok := receiver.(*Generator).Advance()
+	if !ok && !isError(value) {
+		return nil
+	}
+	return value
+}
+
+func generatorDoneMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return NativeBoolToBooleanObject(receiver.(*Generator).Done)
+}
+
+func generatorTakeMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	n, ok := args[0].(*Integer)
+	if !ok {
+		return newError("argument to `take` must be INTEGER, got %s", args[0].Type())
+	}
+
+	gen := receiver.(*Generator)
+	elements := []Object{}
+	for i := int64(0); i < n.Value; i++ {
+		value, ok := gen.Advance()
+		if isError(value) {
+			return value
+		}
+		if !ok {
+			break
+		}
+		elements = append(elements, value)
+	}
+
+	return &Array{Elements: elements}
+}
+
+// generatorMapMethod returns a new generator that applies fn to each value
+// as it is pulled, so pipelines never build intermediate arrays.
+func generatorMapMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	source := receiver.(*Generator)
+	return &Generator{Resume: func() (Object, bool) {
+		value, ok := source.Advance()
+		if !ok {
+			return value, false
+		}
+
+		result := apply(args[0], value)
+		if isError(result) {
+			return result, false
+		}
+		return result, true
+	}}
+}
+
+func generatorFilterMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	source := receiver.(*Generator)
+	return &Generator{Resume: func() (Object, bool) {
+		for {
+			value, ok := source.Advance()
+			if !ok {
+				return value, false
+			}
+
+			result := apply(args[0], value)
+			if isError(result) {
+				return result, false
+			}
+			if isTruthy(result) {
+				return value, true
+			}
+		}
+	}}
+}
+
+// sortedPairs orders hash pairs by their printed key so that keys() and
+// values() line up and do not depend on Go's map iteration order.
+func sortedPairs(h *Hash) []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+	})
+
+	return pairs
+}
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	case nil:
+		return false
+	default:
+		return true
+	}
+}
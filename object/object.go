@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"strings"
+	"sync/atomic"
 
 	"monkey/ast"
 	"monkey/code"
@@ -23,16 +24,202 @@ const (
 	HASH_OBJ             = "HASH"
 	COMPILED_FUNCTIN_OBJ = "COMPILED_FUNCTION_OBJ"
 	CLOSURE_OBJ          = "CLOSURE"
+	STRUCT_TYPE_OBJ      = "STRUCT_TYPE"
+	STRUCT_OBJ           = "STRUCT"
+	BOUND_METHOD_OBJ     = "BOUND_METHOD"
+	GENERATOR_OBJ        = "GENERATOR"
+	CHANNEL_OBJ          = "CHANNEL"
+
+	ENUM_OBJ                = "ENUM"
+	VARIANT_CONSTRUCTOR_OBJ = "VARIANT_CONSTRUCTOR"
+	VARIANT_OBJ             = "VARIANT"
+	SET_OBJ                 = "SET"
 )
 
+// The engines share these so that booleans and null produced by builtins
+// compare equal to the ones produced by the language itself.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+func NativeBoolToBooleanObject(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
+// ComparesByValue reports whether == compares left and right with Equal
+// rather than by identity.
+func ComparesByValue(left, right Object) bool {
+	if left.Type() != right.Type() {
+		return false
+	}
+	return left.Type() == STRING_OBJ || left.Type() == VARIANT_OBJ || left.Type() == SET_OBJ
+}
+
+// Equal compares two variants by tag and contents, or two sets by their
+// elements. Integers and strings inside them compare by value, anything else
+// by identity.
+func Equal(left, right Object) bool {
+	switch left := left.(type) {
+	case *Integer:
+		right, ok := right.(*Integer)
+		return ok && left.Value == right.Value
+	case *String:
+		right, ok := right.(*String)
+		return ok && left.Value == right.Value
+	case *Variant:
+		right, ok := right.(*Variant)
+		if !ok || left.Constructor != right.Constructor {
+			return false
+		}
+		for i := range left.Values {
+			if !Equal(left.Values[i], right.Values[i]) {
+				return false
+			}
+		}
+		return true
+	case *Set:
+		right, ok := right.(*Set)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		for key := range left.Elements {
+			if _, ok := right.Elements[key]; !ok {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
+
 type Closure struct {
-	Fn   *CompiledFunction
-	Free []Object
+	Fn    *CompiledFunction
+	Free  []Object
+	Debug *DebugInfo // Of the function literal the closure was made from
 }
 
 func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
 func (c *Closure) Inspect() string {
-	return fmt.Sprintf("Closure[%p]", c)
+	if c.Debug == nil {
+		return fmt.Sprintf("Closure[%p]", c)
+	}
+	return c.Debug.Signature(c.Fn)
+}
+
+// StructType is the value a struct declaration binds to its name. Calling it
+// builds a Struct with one slot per field, in declaration order.
+type StructType struct {
+	Name    string
+	Fields  []string
+	Methods map[string]Object
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string {
+	return fmt.Sprintf("struct %s { %s }", st.Name, strings.Join(st.Fields, ", "))
+}
+
+// Copy returns a struct type with the name and fields of st and no methods.
+// Each run of a struct declaration makes its own, so an impl run by one call
+// of a function does not change the struct of another.
+func (st *StructType) Copy() *StructType {
+	return &StructType{Name: st.Name, Fields: st.Fields, Methods: map[string]Object{}}
+}
+
+func (st *StructType) FieldIndex(name string) (int, bool) {
+	for i, f := range st.Fields {
+		if f == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (st *StructType) New(fields []Object) Object {
+	if len(fields) != len(st.Fields) {
+		return newError("wrong number of fields for %s: want=%d, got=%d", st.Name, len(st.Fields), len(fields))
+	}
+
+	slots := make([]Object, len(fields))
+	copy(slots, fields)
+
+	return &Struct{Definition: st, Fields: slots}
+}
+
+type Struct struct {
+	Definition *StructType
+	Fields     []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	var out bytes.Buffer
+	fields := []string{}
+	for i, name := range s.Definition.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", name, s.Fields[i].Inspect()))
+	}
+	out.WriteString(s.Definition.Name)
+	out.WriteString("{")
+	out.WriteString(strings.Join(fields, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// Member resolves p.name to a field value, or to a method bound to the
+// instance when no field has that name.
+func (s *Struct) Member(name string) (Object, bool) {
+	if i, ok := s.Definition.FieldIndex(name); ok {
+		return s.Fields[i], true
+	}
+
+	if method, ok := s.Definition.Methods[name]; ok {
+		return &BoundMethod{Receiver: s, Method: method}, true
+	}
+
+	return nil, false
+}
+
+// BoundMethod is a method paired with the instance it was looked up on. The
+// receiver is passed as the first argument when it is called.
+type BoundMethod struct {
+	Receiver Object
+	Method   Object
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string {
+	return fmt.Sprintf("method of %s", bm.Receiver.Inspect())
+}
+
+// Generator is the iterator returned by calling a generator function. Each
+// engine supplies Resume, which runs the body until its next yield and
+// reports false once the body has finished or failed.
+type Generator struct {
+	Resume func() (Object, bool)
+	Done   bool
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+// Advance resumes the generator unless it has already finished. An error
+// raised by the body is returned as the value alongside false.
+func (g *Generator) Advance() (Object, bool) {
+	if g.Done {
+		return nil, false
+	}
+
+	value, ok := g.Resume()
+	if !ok {
+		g.Done = true
+	}
+	return value, ok
 }
 
 type HashPair struct {
@@ -44,6 +231,9 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	Generator     bool
+
+	fieldCaches atomic.Pointer[[]FieldCache]
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTIN_OBJ }
@@ -131,6 +321,8 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Generator  bool
+	Slots      int // Size of the environment a call runs in
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -143,7 +335,11 @@ func (f *Function) Inspect() string {
 		params = append(params, p.String())
 	}
 
-	out.WriteString("fn(")
+	out.WriteString("fn")
+	if f.Generator {
+		out.WriteString("*")
+	}
+	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString("){\n")
 	out.WriteString(f.Body.String())
@@ -4,6 +4,43 @@ import (
 	"testing"
 )
 
+func TestDebugInfoLocalsAt(t *testing.T) {
+	debug := &DebugInfo{
+		Locals: []Local{{"x", 0, 20}, {"a", 4, 13}, {"a", 13, 20}, {"unset", 20, 20}},
+	}
+
+	tests := []struct {
+		ip       int
+		expected map[string]int
+	}{
+		{0, map[string]int{"x": 0}},
+		{4, map[string]int{"x": 0, "a": 1}},
+		{13, map[string]int{"x": 0, "a": 2}},
+		{20, map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		got := debug.LocalsAt(tt.ip)
+		if len(got) != len(tt.expected) {
+			t.Errorf("wrong locals at %d. want=%v, got=%v", tt.ip, tt.expected, got)
+			continue
+		}
+		for name, slot := range tt.expected {
+			if got[name] != slot {
+				t.Errorf("wrong locals at %d. want=%v, got=%v", tt.ip, tt.expected, got)
+			}
+		}
+	}
+
+	fn := &CompiledFunction{NumParameters: 1}
+	if debug.Signature(fn) != "fn(x)" {
+		t.Errorf("wrong Signature. want=%q, got=%q", "fn(x)", debug.Signature(fn))
+	}
+	if got := (*DebugInfo)(nil).LocalsAt(0); len(got) != 0 {
+		t.Errorf("a nil DebugInfo has no locals. got=%v", got)
+	}
+}
+
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
 	hello2 := &String{Value: "Hello World"}
@@ -20,3 +57,44 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestSetDeduplicatesByHashKey(t *testing.T) {
+	set := NewSet()
+	set.Add(&String{Value: "a"})
+	set.Add(&String{Value: "a"})
+	set.Add(&Integer{Value: 1})
+	set.Add(TRUE)
+
+	if len(set.Elements) != 3 {
+		t.Fatalf("set has wrong number of elements. want=3, got=%d", len(set.Elements))
+	}
+
+	if set.Inspect() != "set([a, 1, true])" {
+		t.Errorf("set.Inspect() wrong. got=%q", set.Inspect())
+	}
+
+	if !set.Has(&Integer{Value: 1}) || set.Has(&Integer{Value: 2}) {
+		t.Errorf("set.Has gives wrong membership")
+	}
+}
+
+func TestRegisterMethod(t *testing.T) {
+	RegisterMethod(INTEGER_OBJ, "double", func(apply Applier, receiver Object, args ...Object) Object {
+		return &Integer{Value: receiver.(*Integer).Value * 2}
+	})
+	defer delete(Methods, INTEGER_OBJ)
+
+	method, ok := LookupMethod(INTEGER_OBJ, "double")
+	if !ok {
+		t.Fatalf("registered method not found")
+	}
+
+	result := method(nil, &Integer{Value: 21})
+	if result.(*Integer).Value != 42 {
+		t.Errorf("method returned wrong value. got=%s", result.Inspect())
+	}
+
+	if _, ok := LookupMethod(INTEGER_OBJ, "triple"); ok {
+		t.Errorf("unregistered method was found")
+	}
+}
@@ -0,0 +1,35 @@
+package object
+
+// InfixOperatorFunction implements a registered 'left op right' operator.
+type InfixOperatorFunction func(left, right Object) Object
+
+// PrefixOperatorFunction implements a registered 'op right' operator.
+type PrefixOperatorFunction func(right Object) Object
+
+// Operators registered by embedders, keyed by their literal. Both engines
+// fall back to these for operators they do not implement themselves.
+var (
+	InfixOperators  = map[string]InfixOperatorFunction{}
+	PrefixOperators = map[string]PrefixOperatorFunction{}
+)
+
+// RegisterInfixOperator makes fn implement the infix operator op. The
+// operators the engines implement themselves, like + or ==, keep their
+// meaning.
+func RegisterInfixOperator(op string, fn InfixOperatorFunction) {
+	InfixOperators[op] = fn
+}
+
+func RegisterPrefixOperator(op string, fn PrefixOperatorFunction) {
+	PrefixOperators[op] = fn
+}
+
+func LookupInfixOperator(op string) (InfixOperatorFunction, bool) {
+	fn, ok := InfixOperators[op]
+	return fn, ok
+}
+
+func LookupPrefixOperator(op string) (PrefixOperatorFunction, bool) {
+	fn, ok := PrefixOperators[op]
+	return fn, ok
+}
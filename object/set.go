@@ -0,0 +1,207 @@
+package object
+
+import "strings"
+
+// Set is an unordered collection of distinct hashable values. It keeps
+// insertion order only so that Inspect and iteration are deterministic.
+type Set struct {
+	Elements map[HashKey]Object
+	order    []HashKey
+}
+
+func NewSet() *Set {
+	return &Set{Elements: map[HashKey]Object{}}
+}
+
+func (s *Set) Type() ObjectType { return SET_OBJ }
+func (s *Set) Inspect() string {
+	elements := []string{}
+	for _, e := range s.Values() {
+		elements = append(elements, e.Inspect())
+	}
+	return "set([" + strings.Join(elements, ", ") + "])"
+}
+
+// Add inserts value, reporting an error object if it cannot be hashed.
+func (s *Set) Add(value Object) Object {
+	hashable, ok := value.(Hashable)
+	if !ok {
+		return newError("unusable as set element: %s", value.Type())
+	}
+
+	key := hashable.HashKey()
+	if _, ok := s.Elements[key]; !ok {
+		s.Elements[key] = value
+		s.order = append(s.order, key)
+	}
+	return s
+}
+
+func (s *Set) Has(value Object) bool {
+	hashable, ok := value.(Hashable)
+	if !ok {
+		return false
+	}
+	_, ok = s.Elements[hashable.HashKey()]
+	return ok
+}
+
+// Values returns the elements in the order they were first added.
+func (s *Set) Values() []Object {
+	values := make([]Object, 0, len(s.order))
+	for _, key := range s.order {
+		values = append(values, s.Elements[key])
+	}
+	return values
+}
+
+func setFn(args ...Object) Object {
+	if len(args) > 1 {
+		return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+	}
+
+	set := NewSet()
+	if len(args) == 0 {
+		return set
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return newError("argument to `set` must be ARRAY, got %s", args[0].Type())
+	}
+
+	for _, e := range arr.Elements {
+		if result := set.Add(e); isError(result) {
+			return result
+		}
+	}
+	return set
+}
+
+// In implements 'item in container' for sets, hash keys, array elements and
+// substrings.
+func In(item, container Object) Object {
+	switch container := container.(type) {
+	case *Set:
+		return NativeBoolToBooleanObject(container.Has(item))
+	case *Hash:
+		hashable, ok := item.(Hashable)
+		if !ok {
+			return FALSE
+		}
+		_, ok = container.Pairs[hashable.HashKey()]
+		return NativeBoolToBooleanObject(ok)
+	case *Array:
+		for _, e := range container.Elements {
+			if e == item || Equal(e, item) {
+				return TRUE
+			}
+		}
+		return FALSE
+	case *String:
+		str, ok := item.(*String)
+		if !ok {
+			return newError("type mismatch: %s in STRING", item.Type())
+		}
+		return NativeBoolToBooleanObject(strings.Contains(container.Value, str.Value))
+	default:
+		return newError("operator `in` not supported for %s", container.Type())
+	}
+}
+
+func setOperand(name string, args []Object) (*Set, Object) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	other, ok := args[0].(*Set)
+	if !ok {
+		return nil, newError("argument to `%s` must be SET, got %s", name, args[0].Type())
+	}
+	return other, nil
+}
+
+func setUnionMethod(apply Applier, receiver Object, args ...Object) Object {
+	other, err := setOperand("union", args)
+	if err != nil {
+		return err
+	}
+
+	result := NewSet()
+	for _, e := range receiver.(*Set).Values() {
+		result.Add(e)
+	}
+	for _, e := range other.Values() {
+		result.Add(e)
+	}
+	return result
+}
+
+func setIntersectionMethod(apply Applier, receiver Object, args ...Object) Object {
+	other, err := setOperand("intersection", args)
+	if err != nil {
+		return err
+	}
+
+	result := NewSet()
+	for _, e := range receiver.(*Set).Values() {
+		if other.Has(e) {
+			result.Add(e)
+		}
+	}
+	return result
+}
+
+func setDifferenceMethod(apply Applier, receiver Object, args ...Object) Object {
+	other, err := setOperand("difference", args)
+	if err != nil {
+		return err
+	}
+
+	result := NewSet()
+	for _, e := range receiver.(*Set).Values() {
+		if !other.Has(e) {
+			result.Add(e)
+		}
+	}
+	return result
+}
+
+// setAddMethod returns a new set with the value added, like push does for
+// arrays.
+func setAddMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	result := NewSet()
+	for _, e := range receiver.(*Set).Values() {
+		result.Add(e)
+	}
+	return result.Add(args[0])
+}
+
+func setHasMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	return NativeBoolToBooleanObject(receiver.(*Set).Has(args[0]))
+}
+
+func setValuesMethod(apply Applier, receiver Object, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	return &Array{Elements: receiver.(*Set).Values()}
+}
+
+// setArrayMethod runs an array method over the set's values, turning the
+// result back into a set when it is an array.
+func setArrayMethod(method MethodFunction) MethodFunction {
+	return func(apply Applier, receiver Object, args ...Object) Object {
+		result := method(apply, &Array{Elements: receiver.(*Set).Values()}, args...)
+		if arr, ok := result.(*Array); ok {
+			return setFn(arr)
+		}
+		return result
+	}
+}
@@ -0,0 +1,38 @@
+// Package operators lets a host program add its own operators to Monkey.
+// Register them before parsing anything: the lexer, the parser and both
+// engines pick them up from global tables.
+package operators
+
+import (
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+)
+
+// RegisterInfix adds the binary operator literal, binding as tightly as
+// precedence (parser.EQUALS, parser.SUM, parser.PRODUCT, ...). fn computes
+// its result and reports failures by returning an *object.Error.
+func RegisterInfix(literal string, precedence int, fn object.InfixOperatorFunction) error {
+	t, err := token.RegisterOperator(literal)
+	if err != nil {
+		return err
+	}
+
+	parser.RegisterInfixOperator(t, precedence)
+	object.RegisterInfixOperator(literal, fn)
+
+	return nil
+}
+
+// RegisterPrefix adds the unary operator literal, implemented by fn.
+func RegisterPrefix(literal string, fn object.PrefixOperatorFunction) error {
+	t, err := token.RegisterOperator(literal)
+	if err != nil {
+		return err
+	}
+
+	parser.RegisterPrefixOperator(t)
+	object.RegisterPrefixOperator(literal, fn)
+
+	return nil
+}
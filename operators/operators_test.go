@@ -0,0 +1,225 @@
+package operators
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"monkey/vm"
+)
+
+func init() {
+	power := func(left, right object.Object) object.Object {
+		base, ok1 := left.(*object.Integer)
+		exp, ok2 := right.(*object.Integer)
+		if !ok1 || !ok2 {
+			return &object.Error{Message: "operands of ** must be INTEGER"}
+		}
+		result := int64(1)
+		for i := int64(0); i < exp.Value; i++ {
+			result *= base.Value
+		}
+		return &object.Integer{Value: result}
+	}
+
+	matches := func(left, right object.Object) object.Object {
+		re, err := regexp.Compile(right.(*object.String).Value)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		if re.MatchString(left.(*object.String).Value) {
+			return object.TRUE
+		}
+		return object.FALSE
+	}
+
+	negate := func(right object.Object) object.Object {
+		if i, ok := right.(*object.Integer); ok {
+			return &object.Integer{Value: ^i.Value}
+		}
+		return nil
+	}
+
+	for _, err := range []error{
+		RegisterInfix("**", parser.PRODUCT+1, power),
+		RegisterInfix("matches", parser.EQUALS, matches),
+		RegisterPrefix("~", negate),
+	} {
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+type testCase struct {
+	input    string
+	expected interface{}
+}
+
+var tests = []testCase{
+	{`2 ** 10`, int64(1024)},
+	{`1 + 2 ** 3 * 2`, int64(17)},
+	{`let f = fn(x) { x ** 2 }; f(3)`, int64(9)},
+	{`"monkey" matches "^mon"`, true},
+	{`"monkey" matches "ape" == false`, true},
+	{`~5`, int64(-6)},
+	{`~"x"`, nil},
+}
+
+func TestRegisteredOperatorsWideConstants(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&input, "%d;", i)
+	}
+	input.WriteString(`~(2 ** 3)`)
+
+	comp := compiler.New()
+	if err := comp.Compile(parser.New(lexer.New(input.String())).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	checkObject(t, "~(2 ** 3)", machine.LastPoppedStackElem(), int64(-9))
+}
+
+func TestBuiltinOperatorsWin(t *testing.T) {
+	object.RegisterInfixOperator("-", func(left, right object.Object) object.Object {
+		return &object.Integer{Value: 0}
+	})
+	defer delete(object.InfixOperators, "-")
+
+	input := `5 - 2`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	checkObject(t, input, evaluator.Eval(program, object.NewEnvironment()), int64(3))
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	checkObject(t, input, machine.LastPoppedStackElem(), int64(3))
+}
+
+func TestRegisteredOperatorsParse(t *testing.T) {
+	parsed := map[string]string{
+		`1 + 2 ** 3 * 2`:   `(1 + ((2 ** 3) * 2))`,
+		`a matches b == c`: `((a matches b) == c)`,
+		`~a ** b`:          `((~a) ** b)`,
+	}
+
+	for input, expected := range parsed {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", input, p.Errors())
+		}
+		if program.String() != expected {
+			t.Errorf("%q: expected %q, got %q", input, expected, program.String())
+		}
+	}
+}
+
+func TestRegisteredOperatorsLex(t *testing.T) {
+	l := lexer.New(`a ** *b matches_c`)
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "a"},
+		{Type: "**", Literal: "**"},
+		{Type: token.ASTERISK, Literal: "*"},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: token.IDENT, Literal: "matches_c"},
+		{Type: token.EOF, Literal: ""},
+	}
+
+	for i, want := range expected {
+		tok := l.NextToken()
+		if tok.Type != want.Type || tok.Literal != want.Literal {
+			t.Fatalf("tests[%d]: expected %s %q, got %s %q", i, want.Type, want.Literal, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestRegisteredOperatorsEval(t *testing.T) {
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result := evaluator.Eval(program, object.NewEnvironment())
+		checkObject(t, tt.input, result, tt.expected)
+	}
+}
+
+func TestRegisteredOperatorsVM(t *testing.T) {
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("%q: compiler error: %s", tt.input, err)
+		}
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("%q: vm error: %s", tt.input, err)
+		}
+		checkObject(t, tt.input, machine.LastPoppedStackElem(), tt.expected)
+	}
+}
+
+func TestRegisteredOperatorErrors(t *testing.T) {
+	input := `"a" ** 2`
+
+	result := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if err, ok := result.(*object.Error); !ok || err.Message != "operands of ** must be INTEGER" {
+		t.Errorf("evaluator: expected the operator's error, got %#v", result)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(parser.New(lexer.New(input)).ParseProgram()); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := vm.New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "1:5: operands of ** must be INTEGER" {
+		t.Errorf("vm: expected the operator's error, got %v", err)
+	}
+}
+
+func TestRegisterRejectsBuiltins(t *testing.T) {
+	for _, literal := range []string{"+", "==", "->", "let", "in", "a1", ""} {
+		if err := RegisterInfix(literal, parser.SUM, nil); err == nil {
+			t.Errorf("expected registering %q to fail", literal)
+		}
+	}
+
+	if _, err := token.RegisterOperator("**"); err != nil {
+		t.Errorf("re-registering ** failed: %s", err)
+	}
+}
+
+func checkObject(t *testing.T, input string, obj object.Object, expected interface{}) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok || integer.Value != expected {
+			t.Errorf("%q: expected %d, got %#v", input, expected, obj)
+		}
+	case bool:
+		boolean, ok := obj.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("%q: expected %t, got %#v", input, expected, obj)
+		}
+	case nil:
+		if obj != object.NULL {
+			t.Errorf("%q: expected NULL, got %#v", input, obj)
+		}
+	}
+}
@@ -26,12 +26,43 @@ var precedences = map[token.TokenType]int{
 	token.NOT_EQ:   EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.IN:       LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+}
+
+// Operators registered by embedders, added to every parser New creates.
+var (
+	customInfix  = map[token.TokenType]bool{}
+	customPrefix = map[token.TokenType]bool{}
+)
+
+// RegisterInfixOperator makes parsers created afterwards parse 'left t right'
+// as an InfixExpression binding as tightly as precedence, one of LOWEST
+// through INDEX.
+func RegisterInfixOperator(t token.TokenType, precedence int) {
+	precedences[t] = precedence
+	customInfix[t] = true
+}
+
+// RegisterPrefixOperator makes parsers created afterwards parse 't right' as
+// a PrefixExpression.
+func RegisterPrefixOperator(t token.TokenType) {
+	customPrefix[t] = true
+}
+
+// Precedence returns how tightly the infix operator t binds, or LOWEST if t
+// is not an infix operator.
+func Precedence(t token.TokenType) int {
+	if precedence, ok := precedences[t]; ok {
+		return precedence
+	}
+	return LOWEST
 }
 
 func (p *Parser) peek_precedence() int {
@@ -58,9 +89,49 @@ type Parser struct {
 	current_token token.Token
 	peek_token    token.Token
 	errors        []string
+	errorTokens   []token.Token // The token each of errors is about
 
 	prefix_parse_fns map[token.TokenType]prefix_parse_fn
 	infix_parse_fns  map[token.TokenType]infix_parse_fn
+
+	spans map[ast.Node]Span // Only kept after RecordSpans
+}
+
+// Span is the first and the last token of the source a node was parsed
+// from, including punctuation like parentheses that leaves no node behind.
+type Span struct {
+	Start token.Token
+	End   token.Token
+}
+
+// RecordSpans makes the parser note the Span of every statement, expression
+// and block it parses, for Spans to return.
+func (p *Parser) RecordSpans() {
+	p.spans = map[ast.Node]Span{}
+}
+
+func (p *Parser) Spans() map[ast.Node]Span {
+	return p.spans
+}
+
+// span widens the span of node to run from start to the current token.
+func (p *Parser) span(node ast.Node, start token.Token) {
+	if p.spans == nil || node == nil {
+		return
+	}
+
+	span, ok := p.spans[node]
+	if !ok || before(start, span.Start) {
+		span.Start = start
+	}
+	if !ok || before(span.End, p.current_token) {
+		span.End = p.current_token
+	}
+	p.spans[node] = span
+}
+
+func before(a, b token.Token) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -81,9 +152,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.register_prefix(token.IF, p.parse_if_expression)
 	p.register_prefix(token.FUNCTION, p.parse_function_expression)
 	p.register_prefix(token.LBRACE, p.parseHashLiteral)
+	p.register_prefix(token.YIELD, p.parseYieldExpression)
+	p.register_prefix(token.SPAWN, p.parseSpawnExpression)
+	p.register_prefix(token.SELECT, p.parseSelectExpression)
+	p.register_prefix(token.MATCH, p.parseMatchExpression)
 
 	p.infix_parse_fns = make(map[token.TokenType]infix_parse_fn)
 	p.register_infix(token.LBRACKET, p.parseIndexExpression)
+	p.register_infix(token.DOT, p.parseMemberExpression)
 	p.register_infix(token.LPAREN, p.parse_call_expression)
 	p.register_infix(token.PLUS, p.parse_infix_expression)
 	p.register_infix(token.MINUS, p.parse_infix_expression)
@@ -93,6 +169,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.register_infix(token.NOT_EQ, p.parse_infix_expression)
 	p.register_infix(token.LT, p.parse_infix_expression)
 	p.register_infix(token.GT, p.parse_infix_expression)
+	p.register_infix(token.IN, p.parse_infix_expression)
+
+	for t := range customInfix {
+		p.register_infix(t, p.parse_infix_expression)
+	}
+	for t := range customPrefix {
+		p.register_prefix(t, p.parse_prefix_expression)
+	}
 
 	return p
 }
@@ -113,6 +197,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parse_expression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if !p.peek_token_is(token.RBRACE) && !p.expect_peek(token.COMMA) {
 			return nil
 		}
@@ -121,6 +206,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expect_peek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.current_token
 
 	return hash
 }
@@ -138,9 +224,22 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	exp := &ast.MemberExpression{Token: p.current_token, Object: object}
+
+	if !p.expect_peek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+
+	return exp
+}
+
 func (p *Parser) parseArrayLiterals() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.current_token}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.current_token
 	return array
 }
 
@@ -171,6 +270,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 func (p *Parser) parse_call_expression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{Token: p.current_token, Function: function}
 	expression.Arguments = p.parseExpressionList(token.RPAREN)
+	expression.Rparen = p.current_token
 
 	return expression
 }
@@ -204,11 +304,18 @@ func (p *Parser) parse_call_arguments() []ast.Expression {
 func (p *Parser) parse_function_expression() ast.Expression {
 	expression := &ast.FunctionLiteral{Token: p.current_token}
 
+	if p.peek_token_is(token.ASTERISK) {
+		p.next_token()
+		expression.Generator = true
+	}
+
 	if !p.expect_peek(token.LPAREN) {
 		return nil
 	}
 
 	expression.Parameters = p.parse_function_parameters()
+	expression.Rparen = p.current_token
+	expression.ReturnType = p.parseReturnType()
 
 	if !p.expect_peek(token.LBRACE) {
 		return nil
@@ -230,12 +337,14 @@ func (p *Parser) parse_function_parameters() []*ast.Identifier {
 	p.next_token()
 
 	ident := &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+	ident.Type = p.parseOptionalType()
 	identifier = append(identifier, ident)
 
 	for p.peek_token_is(token.COMMA) {
 		p.next_token()
 		p.next_token()
 		ident = &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+		ident.Type = p.parseOptionalType()
 		identifier = append(identifier, ident)
 	}
 
@@ -246,6 +355,242 @@ func (p *Parser) parse_function_parameters() []*ast.Identifier {
 	return identifier
 }
 
+// parseOptionalType parses the ': type' that may follow a let name or a
+// parameter. It returns nil when there is no annotation.
+func (p *Parser) parseOptionalType() *ast.TypeAnnotation {
+	if !p.peek_token_is(token.COLON) {
+		return nil
+	}
+	p.next_token()
+	p.next_token()
+
+	return p.parseTypeAnnotation()
+}
+
+// parseReturnType parses the '-> type' that may follow a parameter list.
+func (p *Parser) parseReturnType() *ast.TypeAnnotation {
+	if !p.peek_token_is(token.ARROW) {
+		return nil
+	}
+	p.next_token()
+	p.next_token()
+
+	return p.parseTypeAnnotation()
+}
+
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	annotation := &ast.TypeAnnotation{Token: p.current_token}
+
+	switch p.current_token.Type {
+	case token.IDENT:
+		annotation.Name = p.current_token.Literal
+	case token.FUNCTION:
+		annotation.Name = "fn"
+	case token.LBRACKET:
+		p.next_token()
+		annotation.Name = "array"
+		annotation.Element = p.parseTypeAnnotation()
+		if annotation.Element == nil || !p.expect_peek(token.RBRACKET) {
+			return nil
+		}
+	default:
+		p.error(p.current_token, fmt.Sprintf("expected a type, got %s", p.current_token.Type))
+		return nil
+	}
+
+	return annotation
+}
+
+func (p *Parser) parseYieldExpression() ast.Expression {
+	expression := &ast.YieldExpression{Token: p.current_token}
+
+	p.next_token()
+	expression.Value = p.parse_expression(LOWEST)
+
+	return expression
+}
+
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	expression := &ast.SpawnExpression{Token: p.current_token}
+
+	if !p.expect_peek(token.LPAREN) {
+		return nil
+	}
+
+	arguments := p.parseExpressionList(token.RPAREN)
+	if len(arguments) == 0 {
+		p.error(p.current_token, "spawn needs a function to call")
+		return nil
+	}
+
+	expression.Function = arguments[0]
+	expression.Arguments = arguments[1:]
+
+	return expression
+}
+
+func (p *Parser) parseSelectExpression() ast.Expression {
+	expression := &ast.SelectExpression{Token: p.current_token}
+
+	if !p.expect_peek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peek_token_is(token.RBRACE) {
+		p.next_token()
+
+		switch p.current_token.Type {
+		case token.CASE:
+			selectCase := p.parseSelectCase()
+			if selectCase == nil {
+				return nil
+			}
+			expression.Cases = append(expression.Cases, selectCase)
+		case token.DEFAULT:
+			if expression.Default != nil {
+				p.error(p.current_token, "select has more than one default case")
+				return nil
+			}
+			if !p.expect_peek(token.LBRACE) {
+				return nil
+			}
+			expression.Default = p.parse_block_statement()
+		default:
+			p.error(p.current_token, fmt.Sprintf("expected case or default in select, got %s", p.current_token.Type))
+			return nil
+		}
+	}
+
+	if !p.expect_peek(token.RBRACE) {
+		return nil
+	}
+	expression.Rbrace = p.current_token
+
+	return expression
+}
+
+// parseSelectCase parses 'case [name =] recv(ch) { ... }' or
+// 'case send(ch, value) { ... }'.
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	selectCase := &ast.SelectCase{Token: p.current_token}
+
+	if !p.expect_peek(token.IDENT) {
+		return nil
+	}
+
+	if p.peek_token_is(token.ASSIGN) {
+		selectCase.Name = &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+		p.next_token()
+		if !p.expect_peek(token.IDENT) {
+			return nil
+		}
+	}
+
+	operation := p.current_token.Literal
+	if !p.expect_peek(token.LPAREN) {
+		return nil
+	}
+	arguments := p.parseExpressionList(token.RPAREN)
+
+	switch {
+	case operation == "recv" && len(arguments) == 1:
+		selectCase.Channel = arguments[0]
+	case operation == "send" && len(arguments) == 2 && selectCase.Name == nil:
+		selectCase.Send = true
+		selectCase.Channel = arguments[0]
+		selectCase.Value = arguments[1]
+	default:
+		p.error(p.current_token, "select case must be recv(channel) or send(channel, value)")
+		return nil
+	}
+
+	if !p.expect_peek(token.LBRACE) {
+		return nil
+	}
+	selectCase.Body = p.parse_block_statement()
+
+	return selectCase
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	/*
+		Parses 'match (shape) { Circle(r) { ... } Shape.Empty { ... } default { ... } }'
+	*/
+	expression := &ast.MatchExpression{Token: p.current_token}
+
+	if !p.expect_peek(token.LPAREN) {
+		return nil
+	}
+
+	p.next_token()
+	expression.Subject = p.parse_expression(LOWEST)
+
+	if !p.expect_peek(token.RPAREN) || !p.expect_peek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peek_token_is(token.RBRACE) {
+		p.next_token()
+
+		if p.current_token_is(token.DEFAULT) {
+			if expression.Default != nil {
+				p.error(p.current_token, "match has more than one default arm")
+				return nil
+			}
+			if !p.expect_peek(token.LBRACE) {
+				return nil
+			}
+			expression.Default = p.parse_block_statement()
+			continue
+		}
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+	}
+
+	if !p.expect_peek(token.RBRACE) {
+		return nil
+	}
+	expression.Rbrace = p.current_token
+
+	return expression
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	if !p.current_token_is(token.IDENT) {
+		p.error(p.current_token, fmt.Sprintf("expected a variant pattern in match, got %s", p.current_token.Type))
+		return nil
+	}
+
+	arm := &ast.MatchArm{Token: p.current_token, Pattern: p.current_token.Literal}
+
+	if p.peek_token_is(token.DOT) {
+		p.next_token()
+		if !p.expect_peek(token.IDENT) {
+			return nil
+		}
+		arm.Pattern += "." + p.current_token.Literal
+	}
+
+	if p.peek_token_is(token.LPAREN) {
+		p.next_token()
+		arm.Bindings = p.parse_function_parameters()
+		if arm.Bindings == nil {
+			return nil
+		}
+	}
+
+	if !p.expect_peek(token.LBRACE) {
+		return nil
+	}
+	arm.Body = p.parse_block_statement()
+
+	return arm
+}
+
 func (p *Parser) parse_if_expression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.current_token}
 
@@ -294,6 +639,8 @@ func (p *Parser) parse_block_statement() *ast.BlockStatement {
 
 		p.next_token()
 	}
+	block.Rbrace = p.current_token
+	p.span(block, block.Token)
 
 	return block
 }
@@ -339,6 +686,9 @@ func (p *Parser) parse_identifier() ast.Expression {
 func (p *Parser) next_token() {
 	p.current_token = p.peek_token
 	p.peek_token = p.l.NextToken()
+	for p.peek_token.Type == token.WHITESPACE || p.peek_token.Type == token.COMMENT {
+		p.peek_token = p.l.NextToken()
+	}
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -354,18 +704,34 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.next_token()
 	}
 
+	for _, comment := range p.l.Comments() {
+		program.Comments = append(program.Comments, &ast.Comment{Token: comment})
+	}
+
 	return program
 }
 
 func (p *Parser) parse_statement() ast.Statement {
+	start := p.current_token
+
+	var statement ast.Statement
 	switch p.current_token.Type {
 	case token.LET:
-		return p.parse_let_statement()
+		statement = p.parse_let_statement()
 	case token.RETURN:
-		return p.parse_return_statement()
+		statement = p.parse_return_statement()
+	case token.STRUCT:
+		statement = p.parseStructStatement()
+	case token.IMPL:
+		statement = p.parseImplStatement()
+	case token.ENUM:
+		statement = p.parseEnumStatement()
 	default:
-		return p.parse_expression_statement()
+		statement = p.parse_expression_statement()
 	}
+
+	p.span(statement, start)
+	return statement
 }
 
 func (p *Parser) parse_expression_statement() *ast.ExpressionStatement {
@@ -386,7 +752,9 @@ func (p *Parser) parse_expression(precedence int) ast.Expression {
 		return nil
 	}
 
+	start := p.current_token
 	left_exp := prefix()
+	p.span(left_exp, start)
 
 	for !p.peek_token_is(token.SEMICOLON) && precedence < p.peek_precedence() {
 
@@ -397,6 +765,7 @@ func (p *Parser) parse_expression(precedence int) ast.Expression {
 		}
 		p.next_token()
 		left_exp = infix(left_exp)
+		p.span(left_exp, start)
 	}
 
 	return left_exp
@@ -408,7 +777,7 @@ func (p *Parser) parse_integer_literal() ast.Expression {
 	value, error := strconv.ParseInt(p.current_token.Literal, 0, 64)
 	if error != nil {
 		msg := fmt.Sprintf("Could not parser %q as integer", p.current_token.Literal)
-		p.errors = append(p.errors, msg)
+		p.error(p.current_token, msg)
 		return nil
 	}
 
@@ -435,7 +804,7 @@ func (p *Parser) parse_prefix_expression() ast.Expression {
 
 func (p *Parser) no_prefix_parse_fn_error(t token.TokenType) {
 	msg := fmt.Sprintf("No prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.error(p.current_token, msg)
 }
 
 func (p *Parser) parse_return_statement() *ast.ReturnStatement {
@@ -456,6 +825,182 @@ func (p *Parser) parse_return_statement() *ast.ReturnStatement {
 	return statement
 }
 
+func (p *Parser) parseStructStatement() ast.Statement {
+	/*
+		Parses a declaration of the form 'struct Point { x, y }'
+	*/
+	statement := &ast.StructStatement{Token: p.current_token}
+
+	if !p.expect_peek(token.IDENT) {
+		return nil
+	}
+
+	statement.Name = &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+
+	if !p.expect_peek(token.LBRACE) {
+		return nil
+	}
+
+	statement.Fields = []*ast.Identifier{}
+	seen := map[string]bool{}
+
+	for !p.peek_token_is(token.RBRACE) {
+		if !p.expect_peek(token.IDENT) {
+			return nil
+		}
+
+		field := &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+		if seen[field.Value] {
+			msg := fmt.Sprintf("duplicate field %s in struct %s", field.Value, statement.Name.Value)
+			p.error(p.current_token, msg)
+			return nil
+		}
+		seen[field.Value] = true
+		statement.Fields = append(statement.Fields, field)
+
+		if !p.peek_token_is(token.RBRACE) && !p.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expect_peek(token.RBRACE) {
+		return nil
+	}
+	statement.Rbrace = p.current_token
+
+	if p.peek_token_is(token.SEMICOLON) {
+		p.next_token()
+	}
+
+	return statement
+}
+
+func (p *Parser) parseEnumStatement() ast.Statement {
+	/*
+		Parses a declaration of the form 'enum Shape { Circle(r), Rect(w, h), Empty }'
+	*/
+	statement := &ast.EnumStatement{Token: p.current_token}
+
+	if !p.expect_peek(token.IDENT) {
+		return nil
+	}
+
+	statement.Name = &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+
+	if !p.expect_peek(token.LBRACE) {
+		return nil
+	}
+
+	seen := map[string]bool{}
+
+	for !p.peek_token_is(token.RBRACE) {
+		if !p.expect_peek(token.IDENT) {
+			return nil
+		}
+
+		variant := &ast.EnumVariant{Name: &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}}
+		if seen[variant.Name.Value] {
+			msg := fmt.Sprintf("duplicate variant %s in enum %s", variant.Name.Value, statement.Name.Value)
+			p.error(p.current_token, msg)
+			return nil
+		}
+		seen[variant.Name.Value] = true
+
+		if p.peek_token_is(token.LPAREN) {
+			p.next_token()
+			variant.Fields = p.parse_function_parameters()
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		statement.Variants = append(statement.Variants, variant)
+
+		if !p.peek_token_is(token.RBRACE) && !p.expect_peek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expect_peek(token.RBRACE) {
+		return nil
+	}
+	statement.Rbrace = p.current_token
+
+	if p.peek_token_is(token.SEMICOLON) {
+		p.next_token()
+	}
+
+	return statement
+}
+
+func (p *Parser) parseImplStatement() ast.Statement {
+	/*
+		Parses a method block of the form 'impl Point { fn norm(p) { ... } }'
+		The first parameter of every method receives the instance.
+	*/
+	statement := &ast.ImplStatement{Token: p.current_token}
+
+	if !p.expect_peek(token.IDENT) {
+		return nil
+	}
+
+	statement.Name = &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+
+	if !p.expect_peek(token.LBRACE) {
+		return nil
+	}
+
+	statement.Methods = []*ast.FunctionLiteral{}
+
+	for !p.peek_token_is(token.RBRACE) {
+		if !p.expect_peek(token.FUNCTION) {
+			return nil
+		}
+
+		method := &ast.FunctionLiteral{Token: p.current_token}
+
+		if p.peek_token_is(token.ASTERISK) {
+			p.next_token()
+			method.Generator = true
+		}
+
+		if !p.expect_peek(token.IDENT) {
+			return nil
+		}
+		method.Name = p.current_token.Literal
+
+		if !p.expect_peek(token.LPAREN) {
+			return nil
+		}
+
+		method.Parameters = p.parse_function_parameters()
+		method.Rparen = p.current_token
+		if len(method.Parameters) == 0 {
+			msg := fmt.Sprintf("method %s.%s must take a receiver parameter", statement.Name.Value, method.Name)
+			p.error(p.current_token, msg)
+			return nil
+		}
+		method.ReturnType = p.parseReturnType()
+
+		if !p.expect_peek(token.LBRACE) {
+			return nil
+		}
+
+		method.Body = p.parse_block_statement()
+		statement.Methods = append(statement.Methods, method)
+	}
+
+	if !p.expect_peek(token.RBRACE) {
+		return nil
+	}
+	statement.Rbrace = p.current_token
+
+	if p.peek_token_is(token.SEMICOLON) {
+		p.next_token()
+	}
+
+	return statement
+}
+
 func (p *Parser) parse_let_statement() *ast.LetStatement {
 	/*
 		Checks if the statement is of the for 'let x = 5;'
@@ -467,6 +1012,7 @@ func (p *Parser) parse_let_statement() *ast.LetStatement {
 	}
 
 	statement.Name = &ast.Identifier{Token: p.current_token, Value: p.current_token.Literal}
+	statement.Name.Type = p.parseOptionalType()
 
 	if !p.expect_peek(token.ASSIGN) {
 		return nil
@@ -479,7 +1025,7 @@ func (p *Parser) parse_let_statement() *ast.LetStatement {
 		fl.Name = statement.Name.Value
 	}
 
-	for !p.current_token_is(token.SEMICOLON) {
+	for !p.current_token_is(token.SEMICOLON) && !p.current_token_is(token.EOF) {
 		p.next_token()
 	}
 
@@ -508,9 +1054,25 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// PositionedErrors returns the errors prefixed with the line and column of
+// the token each is about, the way the checker reports its errors.
+func (p *Parser) PositionedErrors() []string {
+	errors := make([]string, len(p.errors))
+	for i, msg := range p.errors {
+		t := p.errorTokens[i]
+		errors[i] = fmt.Sprintf("%d:%d: %s", t.Line, t.Column, msg)
+	}
+	return errors
+}
+
 func (p *Parser) peek_error(t token.TokenType) {
 	msg := fmt.Sprintf("Expected next token to be %s but got %s instead", t, p.peek_token.Type)
+	p.error(p.peek_token, msg)
+}
+
+func (p *Parser) error(t token.Token, msg string) {
 	p.errors = append(p.errors, msg)
+	p.errorTokens = append(p.errorTokens, t)
 }
 
 func (p *Parser) register_prefix(tokenType token.TokenType, fn prefix_parse_fn) {
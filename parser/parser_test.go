@@ -8,6 +8,313 @@ import (
 	"monkey/lexer"
 )
 
+func TestEnumParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`enum Shape { Circle(r), Rect(w, h), Empty };`, "enum Shape { Circle(r), Rect(w, h), Empty }"},
+		{
+			`match (s) { Circle(r) { r } Shape.Empty { 0 } default { 1 } }`,
+			"match (s) { Circle(r) { r } Shape.Empty { 0 } default { 1 } }",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		check_parser_errors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestEnumDuplicateVariant(t *testing.T) {
+	l := lexer.New(`enum Shape { Empty, Empty }`)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	if errors[0] != "duplicate variant Empty in enum Shape" {
+		t.Errorf("wrong error. got=%q", errors[0])
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let x: int = 5;`, "let x: int = 5;"},
+		{`let xs: [string] = [];`, "let xs: [string] = [];"},
+		{`fn(a: int, b: string) -> bool { true }`, "fn<>( a: int, b: string) -> bool true"},
+		{`fn(a, b: fn) { a }`, "fn<>( a, b: fn) a"},
+		{`let f = fn(p: Point) -> [[int]] { p };`, "let f = fn<f>( p: Point) -> [[int]] p;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		check_parser_errors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestSpawnAndSelectParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`spawn(f, 1, x)`, "spawn(f, 1, x)"},
+		{
+			`select { case v = recv(a) { v } case send(b, 1) { 2 } default { 3 } }`,
+			"select { case v = recv(a) { v } case send(b, 1) { 2 } default { 3 } }",
+		},
+		{`select { case recv(a) { } }`, "select { case recv(a) {  } }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		check_parser_errors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestPositionedErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let = 1;", []string{"1:5: Expected next token to be IDENT but got = instead", "1:5: No prefix parse function for = found"}},
+		{"puts(1\n", []string{"2:1: Expected next token to be ) but got EOF instead"}},
+		{"let x = 1;\nlet y: 5 = 2;", []string{"2:8: expected a type, got INT"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.PositionedErrors()
+		if len(errors) != len(tt.expected) {
+			t.Fatalf("wrong errors for %q. want=%q, got=%q", tt.input, tt.expected, errors)
+		}
+		for i, e := range tt.expected {
+			if errors[i] != e {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, e, errors[i])
+			}
+		}
+	}
+}
+
+func TestSelectCaseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`select { case len(a) { } }`, "select case must be recv(channel) or send(channel, value)"},
+		{`select { case v = send(a, 1) { } }`, "select case must be recv(channel) or send(channel, value)"},
+		{`select { default { } default { } }`, "select has more than one default case"},
+		{`spawn()`, "spawn needs a function to call"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestGeneratorParsing(t *testing.T) {
+	input := `fn*(n) { yield n; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	check_parser_errors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if !function.Generator {
+		t.Errorf("function.Generator is false")
+	}
+
+	body := function.Body.Statements[0].(*ast.ExpressionStatement)
+	yield, ok := body.Expression.(*ast.YieldExpression)
+	if !ok {
+		t.Fatalf("body.Expression is not ast.YieldExpression. got=%T", body.Expression)
+	}
+
+	test_literal_expression(t, yield.Value, "n")
+
+	if function.String() != "fn*<>( n) yield n" {
+		t.Errorf("function.String() wrong. got=%q", function.String())
+	}
+}
+
+func TestStructStatement(t *testing.T) {
+	input := `struct Point { x, y };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	check_parser_errors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.StructStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.StructStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "Point" {
+		t.Errorf("stmt.Name.Value not 'Point'. got=%q", stmt.Name.Value)
+	}
+
+	if len(stmt.Fields) != 2 {
+		t.Fatalf("struct has wrong number of fields. want 2, got=%d", len(stmt.Fields))
+	}
+
+	test_literal_expression(t, stmt.Fields[0], "x")
+	test_literal_expression(t, stmt.Fields[1], "y")
+}
+
+func TestStructDuplicateField(t *testing.T) {
+	l := lexer.New(`struct Point { x, x }`)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected a parser error, got none")
+	}
+
+	if errors[0] != "duplicate field x in struct Point" {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestImplStatement(t *testing.T) {
+	input := `impl Point {
+	fn sum(p) { p.x + p.y }
+	fn scale(p, k) { Point(p.x * k, p.y * k) }
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	check_parser_errors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ImplStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ImplStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "Point" {
+		t.Errorf("stmt.Name.Value not 'Point'. got=%q", stmt.Name.Value)
+	}
+
+	expected := []struct {
+		name   string
+		params []string
+	}{
+		{"sum", []string{"p"}},
+		{"scale", []string{"p", "k"}},
+	}
+
+	if len(stmt.Methods) != len(expected) {
+		t.Fatalf("impl has wrong number of methods. want %d, got=%d", len(expected), len(stmt.Methods))
+	}
+
+	for i, tt := range expected {
+		method := stmt.Methods[i]
+		if method.Name != tt.name {
+			t.Errorf("method %d has wrong name. want %q, got=%q", i, tt.name, method.Name)
+		}
+		if len(method.Parameters) != len(tt.params) {
+			t.Fatalf("method %s has wrong number of parameters. want %d, got=%d", tt.name, len(tt.params), len(method.Parameters))
+		}
+		for j, param := range tt.params {
+			test_literal_expression(t, method.Parameters[j], param)
+		}
+	}
+
+	body := stmt.Methods[0].Body.Statements[0].(*ast.ExpressionStatement)
+	if body.String() != "((p.x) + (p.y))" {
+		t.Errorf("method body wrong. got=%q", body.String())
+	}
+}
+
+func TestImplMethodWithoutReceiver(t *testing.T) {
+	l := lexer.New(`impl Point { fn origin() { Point(0, 0) } }`)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected a parser error, got none")
+	}
+
+	if errors[0] != "method Point.origin must take a receiver parameter" {
+		t.Errorf("wrong error message. got=%q", errors[0])
+	}
+}
+
+func TestMemberExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"p.x", "(p.x)"},
+		{"p.x.y", "((p.x).y)"},
+		{"p.sum()", "(p.sum)()"},
+		{"-p.x", "(-(p.x))"},
+		{"a.x * b.y", "((a.x) * (b.y))"},
+		{"points[0].x", "((points[0]).x)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		check_parser_errors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
 func TestFunctionLiteralWithName(t *testing.T) {
 	input := `let myFunction = fn() { };`
 	l := lexer.New(input)
@@ -448,6 +755,7 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 in 5;", 5, "in", 5},
 	}
 
 	for _, tt := range infix_tests {
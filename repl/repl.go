@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"monkey/checker"
 	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
@@ -33,6 +34,7 @@ func Start(in io.Reader, out io.Writer) {
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalSize)
 	symbolTable := compiler.NewSymbolTable()
+	typeChecker := checker.New()
 
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
@@ -62,13 +64,22 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		if errors := typeChecker.Check(program); len(errors) != 0 {
+			print_type_errors(out, errors)
+			continue
+		}
+
 		comp := compiler.NewWithState(symbolTable, constants)
 		err := comp.Compile(program)
 		if err != nil {
-			fmt.Fprint(out, "woops! Compilation failed: \n%s\n", err)
+			fmt.Fprintf(out, "woops! Compilation failed: \n%s\n", err)
 			continue
 		}
 
+		for _, w := range comp.Warnings() {
+			fmt.Fprintf(out, "warning: %s\n", w)
+		}
+
 		code := comp.Bytecode()
 		constants = code.Constants
 
@@ -97,6 +108,13 @@ func print_end_message(out io.Writer) {
 	io.WriteString(out, "Good Bye!!\n")
 }
 
+func print_type_errors(out io.Writer, errors []string) {
+	io.WriteString(out, "Woops! Type check failed:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "- "+msg+"\n")
+	}
+}
+
 func print_parser_errors(out io.Writer, errors []string) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
@@ -1,8 +1,14 @@
 package token
 
-const (
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
-	COMMENT = "#"
+const (
+	COMMENT    = "#"
+	WHITESPACE = "WHITESPACE" // Only produced by a lexer keeping trivia
 
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF" // Represent end of the file
@@ -25,6 +31,8 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
+	ARROW     = "->"
 
 	LT = "<"
 	GT = ">"
@@ -42,18 +50,110 @@ const (
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	RETURN   = "RETURN"
+	STRUCT   = "STRUCT"
+	IMPL     = "IMPL"
+	YIELD    = "YIELD"
+	SPAWN    = "SPAWN"
+	SELECT   = "SELECT"
+	CASE     = "CASE"
+	DEFAULT  = "DEFAULT"
+	ENUM     = "ENUM"
+	MATCH    = "MATCH"
+	IN       = "IN"
 
 	STRING = "STRING"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"if":      IF,
+	"else":    ELSE,
+	"true":    TRUE,
+	"false":   FALSE,
+	"return":  RETURN,
+	"struct":  STRUCT,
+	"impl":    IMPL,
+	"yield":   YIELD,
+	"spawn":   SPAWN,
+	"select":  SELECT,
+	"case":    CASE,
+	"default": DEFAULT,
+	"enum":    ENUM,
+	"match":   MATCH,
+	"in":      IN,
+}
+
+// builtinOperators are the symbols the lexer already knows, which cannot be
+// registered again.
+var builtinOperators = map[string]bool{
+	"=": true, "==": true, "!=": true, "+": true, "-": true, "*": true, "/": true,
+	"!": true, "<": true, ">": true, ",": true, ";": true, ":": true, ".": true,
+	"->": true, "(": true, ")": true, "{": true, "}": true, "[": true, "]": true,
+}
+
+// operators are the symbolic operators registered by embedders, longest
+// first so that the lexer prefers '**' over '*'.
+var operators []string
+
+var registered = map[string]bool{}
+
+// RegisterOperator makes the lexer produce a token of its own for literal,
+// which is either a word like 'matches' or a run of punctuation like '**'.
+// Its TokenType is the literal itself. Registering the same literal again is
+// allowed; registering a keyword or a built-in operator is not.
+func RegisterOperator(literal string) (TokenType, error) {
+	if registered[literal] {
+		return TokenType(literal), nil
+	}
+
+	switch {
+	case isWord(literal):
+		if _, ok := keywords[literal]; ok {
+			return "", fmt.Errorf("cannot register operator %q: it is a keyword", literal)
+		}
+		keywords[literal] = TokenType(literal)
+	case isSymbol(literal):
+		if builtinOperators[literal] {
+			return "", fmt.Errorf("cannot register operator %q: it is built in", literal)
+		}
+		operators = append(operators, literal)
+		sort.SliceStable(operators, func(i, j int) bool { return len(operators[i]) > len(operators[j]) })
+	default:
+		return "", fmt.Errorf("cannot register operator %q: use either letters or punctuation", literal)
+	}
+
+	registered[literal] = true
+	return TokenType(literal), nil
+}
+
+// LookupOperator returns the longest registered symbolic operator that input
+// starts with.
+func LookupOperator(input string) (string, bool) {
+	for _, op := range operators {
+		if strings.HasPrefix(input, op) {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func isWord(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isSymbol(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("!$%&*+-./:<=>?@^|~", c) {
+			return false
+		}
+	}
+	return s != ""
 }
 
 func LookupIdentifier(token string) TokenType {
@@ -68,4 +168,6 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 1-based line the token starts on
+	Column  int // 1-based byte offset of the token within its line
 }
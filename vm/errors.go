@@ -0,0 +1,134 @@
+package vm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"monkey/code"
+	"monkey/object"
+)
+
+// RuntimeError is an error the VM ran into while running a program. Trace
+// holds the frame whose instruction failed, followed by the frames below it
+// at the call each was making, innermost first.
+type RuntimeError struct {
+	Err   error
+	Trace []TraceFrame
+}
+
+// TraceFrame is where a frame of a RuntimeError's trace was, in which
+// function and with which variables. Function is empty for the main
+// program and anonymous functions, Signature, like fn f(x), and Locals for
+// the main program only.
+type TraceFrame struct {
+	Function  string
+	Signature string
+	Locals    []Variable // The locals holding a variable there, by slot
+	code.Position
+}
+
+// Variable is a local variable of a TraceFrame and its value.
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+func (f TraceFrame) String() string {
+	return f.Position.String() + f.function() + f.locals()
+}
+
+func (f TraceFrame) function() string {
+	if f.Signature == "" {
+		return ""
+	}
+	return " in " + f.Signature
+}
+
+func (f TraceFrame) locals() string {
+	if len(f.Locals) == 0 {
+		return ""
+	}
+
+	vars := []string{}
+	for _, v := range f.Locals {
+		value := v.Value.Inspect()
+		if str, ok := v.Value.(*object.String); ok {
+			value = strconv.Quote(str.Value)
+		}
+		vars = append(vars, v.Name+" = "+value)
+	}
+	return " with " + strings.Join(vars, ", ")
+}
+
+func (e *RuntimeError) Error() string {
+	known := false
+	for _, frame := range e.Trace {
+		known = known || frame.Line != 0
+	}
+	if !known {
+		return e.Err.Error()
+	}
+
+	var out strings.Builder
+	out.WriteString(e.Trace[0].Position.String() + ": " + e.Err.Error())
+	if e.Trace[0].Signature != "" {
+		out.WriteString("\n\tin " + e.Trace[0].Signature + e.Trace[0].locals())
+	}
+
+	// Deep recursion repeats the same call many times over, with variables
+	// that differ from one call to the next
+	callers := e.Trace[1:]
+	for i := 0; i < len(callers); {
+		n := 1
+		for i+n < len(callers) && callers[i+n].Position == callers[i].Position && callers[i+n].Signature == callers[i].Signature {
+			n++
+		}
+		if n > 1 {
+			fmt.Fprintf(&out, "\n\tcalled from %s%s (%d times)", callers[i].Position, callers[i].function(), n)
+		} else {
+			out.WriteString("\n\tcalled from " + callers[i].String())
+		}
+		i += n
+	}
+	return out.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// runtimeError wraps err with the frames on the stack when it happened.
+// Each frame's ip is still within the instruction it was running.
+func (vm *VM) runtimeError(err error) *RuntimeError {
+	trace := []TraceFrame{}
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		pos, _ := frame.cl.Debug.Position(frame.ip)
+		tf := TraceFrame{Position: pos}
+		if frame.cl.Debug != nil && i > 0 {
+			tf.Function = frame.cl.Debug.Name
+			tf.Signature = frame.cl.Debug.Signature(frame.cl.Fn)
+			tf.Locals = vm.locals(frame)
+		}
+		trace = append(trace, tf)
+	}
+	return &RuntimeError{Err: err, Trace: trace}
+}
+
+// locals returns the variables frame holds at its ip, in the order of their
+// slots.
+func (vm *VM) locals(frame *Frame) []Variable {
+	live := frame.cl.Debug.LocalsAt(frame.ip)
+	names := slices.SortedFunc(maps.Keys(live), func(a, b string) int { return live[a] - live[b] })
+
+	vars := []Variable{}
+	for _, name := range names {
+		if value := vm.stack[frame.basePointer+live[name]]; value != nil {
+			vars = append(vars, Variable{Name: name, Value: value})
+		}
+	}
+	return vars
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"errors"
+
+	"monkey/object"
+)
+
+// errYield is returned by run when OpYield suspends the running generator.
+var errYield = errors.New("yield")
+
+// coroutine is the execution state of a generator: its own stack and frames,
+// which a fresh VM picks up each time the generator is resumed. Resuming continues at the
+// saved ip of whichever frame was executing when it yielded.
+type coroutine struct {
+	stack       []object.Object
+	sp          int
+	frames      []*Frame
+	framesIndex int
+	yielded     object.Object
+	running     bool
+}
+
+func (vm *VM) newGenerator(cl *object.Closure, numArgs int) error {
+	co := &coroutine{
+		stack:  make([]object.Object, StackSize),
+		frames: make([]*Frame, MaxFrames),
+	}
+
+	// Lay out the callee and its arguments the way callClosure would
+	copy(co.stack, vm.stack[vm.sp-1-numArgs:vm.sp])
+	frame := NewFrame(cl, 1)
+	co.frames[0] = frame
+	co.framesIndex = 1
+	co.sp = frame.basePointer + cl.Fn.NumLocals
+
+	vm.sp = vm.sp - numArgs - 1
+
+	gen := &object.Generator{}
+	gen.Resume = func() (object.Object, bool) {
+		return vm.resume(co)
+	}
+
+	return vm.push(gen)
+}
+
+// resume runs the generator on a VM of its own built around the coroutine's
+// stack and frames, so the VM that created it is left untouched.
+func (vm *VM) resume(co *coroutine) (object.Object, bool) {
+	if co.running {
+		return &object.Error{Message: "generator is already running"}, false
+	}
+	co.running = true
+	defer func() { co.running = false }()
+
+	runner := &VM{
+		constants:   vm.constants,
+		stack:       co.stack,
+		sp:          co.sp,
+		globals:     vm.globals,
+		frames:      co.frames,
+		framesIndex: co.framesIndex,
+		coroutine:   co,
+	}
+
+	err := runner.run(0)
+	co.sp, co.framesIndex = runner.sp, runner.framesIndex
+
+	switch {
+	case err == errYield:
+		return co.yielded, true
+	case err != nil:
+		return &object.Error{Message: err.Error()}, false
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,56 @@
+package vm
+
+import "monkey/object"
+
+// executeSpawn calls the callee below the arguments on a new goroutine,
+// running it on a VM of its own. The new VM shares the constants but gets a
+// copy of the globals, so each side only sees its own later assignments. It
+// pushes a channel that receives the result, or the error the call stopped
+// with.
+func (vm *VM) executeSpawn(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	vm.sp = vm.sp - numArgs - 1
+
+	globals := make([]object.Object, len(vm.globals))
+	copy(globals, vm.globals)
+
+	child := &VM{
+		constants: vm.constants,
+		stack:     make([]object.Object, StackSize),
+		globals:   globals,
+		frames:    make([]*Frame, MaxFrames),
+	}
+
+	result := object.NewChannel(1)
+	go func() {
+		result.Ch <- child.apply(callee, args...)
+		close(result.Ch)
+	}()
+
+	return vm.push(result)
+}
+
+// executeSelect pops the (channel, value, isSend) triple of every case, waits
+// for one to proceed and pushes the value it received. It returns the index
+// of the chosen case, numCases meaning default.
+func (vm *VM) executeSelect(numCases int, hasDefault bool) (int, error) {
+	cases := make([]object.SelectCase, numCases)
+	start := vm.sp - numCases*3
+	for i := range cases {
+		cases[i] = object.SelectCase{
+			Channel: vm.stack[start+i*3],
+			Value:   vm.stack[start+i*3+1],
+			Send:    vm.stack[start+i*3+2] == True,
+		}
+	}
+	vm.sp = start
+
+	chosen, value, err := object.Select(cases, hasDefault)
+	if err != nil {
+		return 0, err
+	}
+
+	return chosen, vm.push(value)
+}
@@ -15,9 +15,9 @@ const (
 )
 
 var (
-	True  = &object.Boolean{Value: true}
-	False = &object.Boolean{Value: false}
-	Null  = &object.Null{}
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
 )
 
 type VM struct {
@@ -29,6 +29,8 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	coroutine *coroutine // The generator this VM is running, if any
 }
 
 func NewWithGlobalState(bytecode *compiler.Bytecode, s []object.Object) *VM {
@@ -39,7 +41,7 @@ func NewWithGlobalState(bytecode *compiler.Bytecode, s []object.Object) *VM {
 
 func New(bytecode *compiler.Bytecode) *VM {
 	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &object.Closure{Fn: mainFn}
+	mainClosure := &object.Closure{Fn: mainFn, Debug: bytecode.Debug}
 	mainFrame := NewFrame(mainClosure, 0)
 	frames := make([]*Frame, MaxFrames)
 	frames[0] = mainFrame
@@ -64,12 +66,24 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
+// Run runs the program. The errors it returns are *RuntimeError.
 func (vm *VM) Run() error {
+	err := vm.run(0)
+	if err != nil {
+		return vm.runtimeError(err)
+	}
+	return nil
+}
+
+// run executes instructions until the frame stack unwinds to depth frames or
+// the outermost frame runs out of instructions. A depth above zero lets Go
+// code, like a method's Applier, call back into a closure and wait for it.
+func (vm *VM) run(depth int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().ip++
 
 		ip = vm.currentFrame().ip
@@ -83,7 +97,17 @@ func (vm *VM) Run() error {
 			numFree := code.ReadUint8(ins[ip+3:])
 			vm.currentFrame().ip += 3
 
-			err := vm.pushClosure(int(constIndex), int(numFree))
+			err := vm.pushClosure(int(constIndex), int(numFree), ip)
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosureWide:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			numFree := code.ReadUint16(ins[ip+5:])
+			vm.currentFrame().ip += 6
+
+			err := vm.pushClosure(int(constIndex), int(numFree), ip)
 			if err != nil {
 				return err
 			}
@@ -98,6 +122,16 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpGetFreeWide:
+			freeIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -105,6 +139,23 @@ func (vm *VM) Run() error {
 			frame := vm.currentFrame()
 			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
 
+		case code.OpSetLocalWide:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocalWide:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
@@ -115,10 +166,203 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpGetField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			cacheIndex := code.ReadUint16(ins[ip+3:])
+			vm.currentFrame().ip += 4
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			cache := vm.currentFrame().cl.Fn.FieldCache(int(cacheIndex))
+			err := vm.executeGetField(vm.pop(), name, cache)
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFieldWide:
+			nameIndex := code.ReadUint32(ins[ip+1:])
+			cacheIndex := code.ReadUint16(ins[ip+5:])
+			vm.currentFrame().ip += 6
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			cache := vm.currentFrame().cl.Fn.FieldCache(int(cacheIndex))
+			err := vm.executeGetField(vm.pop(), name, cache)
+			if err != nil {
+				return err
+			}
+
+		case code.OpInvoke:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			numArgs := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			err := vm.executeInvoke(name, int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpInvokeWide:
+			nameIndex := code.ReadUint32(ins[ip+1:])
+			numArgs := code.ReadUint16(ins[ip+5:])
+			vm.currentFrame().ip += 6
+
+			name := vm.constants[nameIndex].(*object.String).Value
+			err := vm.executeInvoke(name, int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpSpawn:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			err := vm.executeSpawn(numArgs)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSpawnWide:
+			numArgs := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.executeSpawn(numArgs)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSelect:
+			numCases := int(code.ReadUint16(ins[ip+1:]))
+			hasDefault := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			chosen, err := vm.executeSelect(numCases, hasDefault)
+			if err != nil {
+				return err
+			}
+
+			// Land on the chosen entry of the jump table that follows,
+			// each an OpJump with a two-byte operand
+			vm.currentFrame().ip += chosen * 3
+
+		case code.OpMatchVariant:
+			patternIndex := code.ReadUint16(ins[ip+1:])
+			numBindings := int(code.ReadUint8(ins[ip+3:]))
+			nextArm := int(code.ReadUint16(ins[ip+4:]))
+			vm.currentFrame().ip += 5
+
+			pattern := vm.constants[patternIndex].(*object.String).Value
+			matched, err := vm.executeMatchVariant(pattern, numBindings)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				vm.currentFrame().ip = nextArm - 1
+			}
+
+		case code.OpMatchVariantWide:
+			patternIndex := code.ReadUint32(ins[ip+1:])
+			numBindings := int(code.ReadUint16(ins[ip+5:]))
+			nextArm := int(code.ReadUint16(ins[ip+7:]))
+			vm.currentFrame().ip += 8
+
+			pattern := vm.constants[patternIndex].(*object.String).Value
+			matched, err := vm.executeMatchVariant(pattern, numBindings)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				vm.currentFrame().ip = nextArm - 1
+			}
+
+		case code.OpIn:
+			container := vm.pop()
+			item := vm.pop()
+
+			result := object.In(item, container)
+			if err, ok := result.(*object.Error); ok {
+				return fmt.Errorf("%s", err.Message)
+			}
+
+			err := vm.push(result)
+			if err != nil {
+				return err
+			}
+
+		case code.OpInfix, code.OpPrefix:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeCustomOperator(op, vm.constants[nameIndex].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpInfixWide, code.OpPrefixWide:
+			nameIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().ip += 4
+
+			err := vm.executeCustomOperator(op, vm.constants[nameIndex].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpNoMatch:
+			return fmt.Errorf("no match arm for %s", vm.pop().Inspect())
+
+		case code.OpYield:
+			if vm.coroutine == nil {
+				return fmt.Errorf("yield outside of generator")
+			}
+
+			vm.coroutine.yielded = vm.pop()
+
+			// The yield expression itself evaluates to null once resumed
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+			return errYield
+
+		case code.OpStruct:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex].(*object.StructType).Copy())
+			if err != nil {
+				return err
+			}
+
+		case code.OpStructWide:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().ip += 4
+
+			err := vm.push(vm.constants[constIndex].(*object.StructType).Copy())
+			if err != nil {
+				return err
+			}
+
+		case code.OpMethod:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeMethod(vm.constants[nameIndex].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpMethodWide:
+			nameIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().ip += 4
+
+			err := vm.executeMethod(vm.constants[nameIndex].(*object.String).Value)
+			if err != nil {
+				return err
+			}
+
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure)
-			if err != nil{
+			if err != nil {
 				return err
 			}
 
@@ -131,6 +375,33 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeTailCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpCallWide:
+			numArgs := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpTailCallWide:
+			numArgs := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeTailCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 			frame := vm.popFrame() // pop the function stack frame
@@ -153,6 +424,17 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpGetBuiltinWide:
+			buildinIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			definition := object.Builtins[buildinIndex]
+
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
+
 		case code.OpReturn:
 			// This is for functions without any return value
 			// In those cases we push null to the stack
@@ -220,6 +502,13 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpConstantWide:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().ip += 4
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
 		case code.OpBang:
 			err := vm.executeBangOperator()
 			if err != nil {
@@ -242,6 +531,51 @@ func (vm *VM) Run() error {
 			if !isTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+
+		case code.OpJumpTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpEqualJump, code.OpNotEqualJump, code.OpLessThanJump, code.OpGreaterThanJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			holds, err := vm.executeCompareJump(op)
+			if err != nil {
+				return err
+			}
+			if !holds {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpGetLocalConstSub:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			constIndex := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+
+			frame := vm.currentFrame()
+			left := vm.stack[frame.basePointer+int(localIndex)]
+			err := vm.executeFusedBinaryOperation(code.OpSub, left, vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpIncLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			left := vm.stack[frame.basePointer+int(localIndex)]
+			err := vm.executeFusedBinaryOperation(code.OpAdd, left, one)
+			if err != nil {
+				return err
+			}
+
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -310,6 +644,10 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if object.ComparesByValue(left, right) {
+		return vm.executeValueComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
 		return vm.push(nativeBoolToBooleanObject(right == left))
@@ -320,6 +658,48 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	}
 }
 
+// executeCustomOperator applies an operator an embedder registered with the
+// object package to the operands on the stack.
+func (vm *VM) executeCustomOperator(op code.Opcode, name string) error {
+	var result object.Object
+
+	if op == code.OpPrefix || op == code.OpPrefixWide {
+		fn, ok := object.LookupPrefixOperator(name)
+		if !ok {
+			return fmt.Errorf("unkown operator: %s", name)
+		}
+		result = fn(vm.pop())
+	} else {
+		fn, ok := object.LookupInfixOperator(name)
+		if !ok {
+			return fmt.Errorf("unkown operator: %s", name)
+		}
+		right := vm.pop()
+		left := vm.pop()
+		result = fn(left, right)
+	}
+
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+	if result == nil {
+		result = Null
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeValueComparison(op code.Opcode, left, right object.Object) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
+	default:
+		return fmt.Errorf("unkown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
@@ -338,6 +718,64 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 	}
 }
 
+// one is the right operand of OpIncLocal.
+var one = &object.Integer{Value: 1}
+
+// executeFusedBinaryOperation applies op to a local and a constant that a
+// superinstruction read without pushing them first.
+func (vm *VM) executeFusedBinaryOperation(op code.Opcode, left, right object.Object) error {
+	if left, ok := left.(*object.Integer); ok {
+		if right, ok := right.(*object.Integer); ok {
+			return vm.executeBinaryIntegerOperation(op, left, right)
+		}
+	}
+
+	err := vm.push(left)
+	if err != nil {
+		return err
+	}
+	err = vm.push(right)
+	if err != nil {
+		return err
+	}
+	return vm.executeBinaryOperation(op)
+}
+
+// compareJumps maps the compare-and-jump superinstructions to the
+// comparison they make.
+var compareJumps = map[code.Opcode]code.Opcode{
+	code.OpEqualJump:       code.OpEqual,
+	code.OpNotEqualJump:    code.OpNotEqual,
+	code.OpLessThanJump:    code.OpLessThan,
+	code.OpGreaterThanJump: code.OpGreaterThan,
+}
+
+// executeCompareJump pops the operands of a compare-and-jump and reports
+// whether the comparison holds, in which case the VM does not jump.
+func (vm *VM) executeCompareJump(op code.Opcode) (bool, error) {
+	right, rightOk := vm.stack[vm.sp-1].(*object.Integer)
+	left, leftOk := vm.stack[vm.sp-2].(*object.Integer)
+	if leftOk && rightOk {
+		vm.sp -= 2
+		switch op {
+		case code.OpEqualJump:
+			return left.Value == right.Value, nil
+		case code.OpNotEqualJump:
+			return left.Value != right.Value, nil
+		case code.OpLessThanJump:
+			return left.Value < right.Value, nil
+		default:
+			return left.Value > right.Value, nil
+		}
+	}
+
+	err := vm.executeComparison(compareJumps[op])
+	if err != nil {
+		return false, err
+	}
+	return isTruthy(vm.pop()), nil
+}
+
 func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -500,9 +938,14 @@ func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= len(vm.frames) {
+		return fmt.Errorf("stack overflow: more than %d nested calls", MaxFrames)
+	}
+
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -510,26 +953,69 @@ func (vm *VM) popFrame() *Frame {
 	return vm.frames[vm.framesIndex]
 }
 
-func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+// callClosure calls cl with the numArgs arguments on top of the stack. A
+// tail call replaces the running function: the callee and its arguments
+// move down into its stack window and the callee runs in its frame.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, tail bool) error {
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
 
-	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	if cl.Fn.Generator {
+		return vm.newGenerator(cl, numArgs)
+	}
+
+	basePointer := vm.sp - numArgs
+	if tail {
+		basePointer = vm.currentFrame().basePointer
+	}
+	// Checked before the frame is pushed, so the error is reported at the
+	// call
+	if basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
 
+	var frame *Frame
+	if tail {
+		frame = vm.currentFrame()
+		copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+		frame.cl = cl
+		frame.ip = -1
+	} else {
+		frame = NewFrame(cl, basePointer)
+		if err := vm.pushFrame(frame); err != nil {
+			return err
+		}
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 
 	return nil
 }
 
+// executeTailCall makes the call of an OpTailCall. Only closures can take
+// over the caller's frame; any other callee is called as usual, and the
+// OpReturnValue that follows returns its result.
+func (vm *VM) executeTailCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	if cl, ok := callee.(*object.Closure); ok {
+		return vm.callClosure(cl, numArgs, true)
+	}
+	return vm.executeCall(numArgs)
+}
+
 func (vm *VM) executeCall(numArgs int) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
 	case *object.Closure:
-		return vm.callClosure(callee, numArgs)
+		return vm.callClosure(callee, numArgs, false)
 	case *object.Builtin:
 		return vm.callBuiltin(callee, numArgs)
+	case *object.StructType:
+		return vm.callStructType(callee, numArgs)
+	case *object.VariantConstructor:
+		return vm.callVariantConstructor(callee, numArgs)
+	case *object.BoundMethod:
+		return vm.callBoundMethod(callee, numArgs)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
 	}
@@ -547,7 +1033,196 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
-func (vm *VM) pushClosure(constIndex int, numFree int) error {
+func (vm *VM) callStructType(structType *object.StructType, numArgs int) error {
+	if numArgs != len(structType.Fields) {
+		return fmt.Errorf("wrong number of fields for %s: want=%d, got=%d", structType.Name, len(structType.Fields), numArgs)
+	}
+
+	instance := structType.New(vm.stack[vm.sp-numArgs : vm.sp])
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.push(instance)
+}
+
+func (vm *VM) callVariantConstructor(vc *object.VariantConstructor, numArgs int) error {
+	variant := vc.New(vm.stack[vm.sp-numArgs : vm.sp])
+	if err, ok := variant.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.push(variant)
+}
+
+// executeMatchVariant replaces the subject on top of the stack with its
+// values if it is a variant matching pattern. Otherwise it leaves the subject
+// for the next arm.
+func (vm *VM) executeMatchVariant(pattern string, numBindings int) (bool, error) {
+	variant, ok := vm.StackTop().(*object.Variant)
+	if !ok || !variant.Matches(pattern) {
+		return false, nil
+	}
+
+	if numBindings > 0 && numBindings != len(variant.Values) {
+		return false, fmt.Errorf("pattern %s binds %d values, %s has %d", pattern, numBindings, variant.Inspect(), len(variant.Values))
+	}
+
+	vm.pop()
+	for i := 0; i < numBindings; i++ {
+		err := vm.push(variant.Values[i])
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// callBoundMethod rewrites the call in place so the method sits in the callee
+// slot and the receiver becomes its first argument.
+func (vm *VM) callBoundMethod(bm *object.BoundMethod, numArgs int) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	for i := vm.sp - 1; i >= vm.sp-numArgs; i-- {
+		vm.stack[i+1] = vm.stack[i]
+	}
+	vm.stack[vm.sp-numArgs] = bm.Receiver
+	vm.stack[vm.sp-numArgs-1] = bm.Method
+	vm.sp++
+
+	return vm.executeCall(numArgs + 1)
+}
+
+// executeInvoke calls receiver.name(args...). Struct members are called like
+// any other callee; every other type dispatches to its builtin method table.
+func (vm *VM) executeInvoke(name string, numArgs int) error {
+	receiverIndex := vm.sp - 1 - numArgs
+	receiver := vm.stack[receiverIndex]
+
+	switch receiver.(type) {
+	case *object.Struct, *object.Enum, *object.Variant:
+		member, err := vm.member(receiver, name)
+		if err != nil {
+			return err
+		}
+
+		vm.stack[receiverIndex] = member
+		return vm.executeCall(numArgs)
+	}
+
+	method, ok := object.LookupMethod(receiver.Type(), name)
+	if !ok {
+		return fmt.Errorf("undefined method %s for %s", name, receiver.Type())
+	}
+
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := method(vm.apply, receiver, args...)
+	vm.sp = receiverIndex
+	if result == nil {
+		return vm.push(Null)
+	}
+	return vm.push(result)
+}
+
+// apply calls fn with args from Go and runs the VM until it returns. Failures
+// come back as error objects, the same way builtins report them.
+func (vm *VM) apply(fn object.Object, args ...object.Object) object.Object {
+	sp := vm.sp
+	framesIndex := vm.framesIndex
+
+	// Callbacks cannot yield: the Go frames of the method calling them
+	// would have to be suspended too.
+	outer := vm.coroutine
+	vm.coroutine = nil
+	defer func() { vm.coroutine = outer }()
+
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err != nil {
+			break
+		}
+		err = vm.push(arg)
+	}
+
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	if err == nil {
+		err = vm.run(framesIndex)
+	}
+	if err != nil {
+		vm.sp = sp
+		vm.framesIndex = framesIndex
+		return &object.Error{Message: err.Error()}
+	}
+
+	result := vm.pop()
+	vm.sp = sp
+	return result
+}
+
+// executeMethod attaches the closure on top of the stack, as the method
+// name, to the struct type below it.
+func (vm *VM) executeMethod(name string) error {
+	method := vm.pop()
+	target := vm.pop()
+
+	structType, ok := target.(*object.StructType)
+	if !ok {
+		return fmt.Errorf("impl target is not a struct: %s", target.Type())
+	}
+	structType.Methods[name] = method
+	return nil
+}
+
+func (vm *VM) executeGetField(obj object.Object, name string, cache *object.FieldCache) error {
+	if s, ok := obj.(*object.Struct); ok {
+		if field, ok := cache.Field(s, name); ok {
+			return vm.push(field)
+		}
+	}
+
+	member, err := vm.member(obj, name)
+	if err != nil {
+		return err
+	}
+
+	return vm.push(member)
+}
+
+func (vm *VM) member(obj object.Object, name string) (object.Object, error) {
+	switch obj := obj.(type) {
+	case *object.Struct:
+		member, ok := obj.Member(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s on %s", name, obj.Definition.Name)
+		}
+		return member, nil
+	case *object.Enum:
+		member, ok := obj.Member(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown variant %s of %s", name, obj.Name)
+		}
+		return member, nil
+	case *object.Variant:
+		member, ok := obj.Member(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s on %s.%s", name, obj.Constructor.Enum, obj.Constructor.Name)
+		}
+		return member, nil
+	default:
+		return nil, fmt.Errorf("member access not supported: %s", obj.Type())
+	}
+}
+
+// pushClosure pushes a closure of the function at constIndex over the
+// numFree values on top of the stack. site is the offset of the OpClosure,
+// which picks the debug info of the function literal it was compiled from.
+func (vm *VM) pushClosure(constIndex int, numFree int, site int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
 	if !ok {
@@ -560,6 +1235,6 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	}
 	vm.sp = vm.sp - numFree
 
-	closure := &object.Closure{Fn: function, Free: free}
+	closure := &object.Closure{Fn: function, Free: free, Debug: vm.currentFrame().cl.Debug.Closure(site)}
 	return vm.push(closure)
 }
@@ -2,9 +2,11 @@ package vm
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"monkey/ast"
+	"monkey/code"
 	"monkey/compiler"
 	"monkey/lexer"
 	"monkey/object"
@@ -16,6 +18,726 @@ type vmTestCase struct {
 	expected interface{}
 }
 
+func TestWideConstantOperands(t *testing.T) {
+	var constants strings.Builder
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&constants, "%d;", i)
+	}
+
+	tests := []vmTestCase{
+		{
+			// In a function, whose jumps stay within two bytes
+			constants.String() + `fn() {
+				struct P { x }; impl P { fn get(self) { self.x } }; let p = P(2);
+				enum E { A(v) }; p.x + p.get() + match (E.A(3)) { A(v) { v } }
+			}()`,
+			7,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == "b"`, false},
+		{`"a" + "b" == "ab"`, true},
+		{`let f = fn(x) { x + "b" }; f("a") == "ab"`, true},
+		{`let f = fn(x) { x + "b" }; f("a") != f("a")`, false},
+	}
+
+	for _, tt := range tests {
+		for _, options := range []compiler.Options{{}, compiler.DefaultOptions()} {
+			comp := compiler.NewWithOptions(options)
+			if err := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compile error: %s", err)
+			}
+
+			vm := New(comp.Bytecode())
+			if err := vm.Run(); err != nil {
+				t.Fatalf("%q: vm error: %s", tt.input, err)
+			}
+			if err := testBooleanObject(tt.expected, vm.LastPoppedStackElem()); err != nil {
+				t.Errorf("%q with %+v: %s", tt.input, options, err)
+			}
+		}
+	}
+}
+
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let fibonacci = fn(x) { x }; fibonacci", "fn fibonacci(x)"},
+		{"fn(a, b) { a }", "fn(a, b)"},
+		{"let count = fn*(n) { yield n }; count", "fn* count(n)"},
+		{"let add = fn(a) { fn(b) { a + b } }; add(1)", "fn(b)"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	params := names("p", 300)
+	args := make([]string, 300)
+	for i := range args {
+		args[i] = fmt.Sprint(i)
+	}
+	list := strings.Join(params, ", ")
+	values := strings.Join(args, ", ")
+
+	var lets strings.Builder
+	for i, name := range names("a", 300) {
+		fmt.Fprintf(&lets, "let %s = %d; ", name, i)
+	}
+
+	tests := []vmTestCase{
+		{"fn(" + list + ") { pln - pb }(" + values + ")", 298},
+		{"fn() { " + lets.String() + "aln + aa + ajv + ajw }()", 810},
+		{"let f = fn(" + list + ") { fn() { pa + pln } }; f(" + values + ")()", 299},
+		{
+			"let f = fn(" + list + ") { if (pa == 0) { pln } else { f(pa - 1, " + strings.Join(params[1:], ", ") + ") } };" +
+				"f(5000, " + strings.Join(args[1:], ", ") + ")",
+			299,
+		},
+		{"recv(spawn(fn(" + list + ") { pln - pb }, " + values + "))", 298},
+		{"struct P { n }; impl P { fn m(self, " + list + ") { self.n + pln } }; P(1).m(" + values + ")", 300},
+	}
+
+	runVmTests(t, tests)
+}
+
+// names returns n distinct identifiers starting with prefix. They count
+// up in base 26, a standing for 0 and z for 25, as identifiers cannot hold
+// digits: the names for prefix p are pa, pb, ..., pz, pba, pbb and so on.
+func names(prefix string, n int) []string {
+	list := make([]string, n)
+	for i := range list {
+		digits := ""
+		for j := i; ; j /= 26 {
+			digits = string(rune('a'+j%26)) + digits
+			if j < 26 {
+				break
+			}
+		}
+		list[i] = prefix + digits
+	}
+	return list
+}
+
+func TestRunDecodedBytecode(t *testing.T) {
+	input := `struct Point { x, y }
+	impl Point { fn norm(p) { p.x * p.x + p.y * p.y } }
+	enum Shape { Circle(r), Empty }
+	let area = fn(s) { match (s) { Circle(r) { 3 * r * r } Empty { 0 } } };
+	let gen = fn*() { yield 1; yield 2 };
+	[Point(3, 4).norm(), area(Shape.Circle(2)), area(Shape.Empty), gen().take(5), "mon" + "key"]`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	data, err := comp.Bytecode().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %s", err)
+	}
+
+	bytecode := &compiler.Bytecode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %s", err)
+	}
+
+	vm := New(bytecode)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	expected := `[25, 12, 0, [1, 2], monkey]`
+	if got := vm.LastPoppedStackElem().Inspect(); got != expected {
+		t.Errorf("wrong result. want=%s, got=%s", expected, got)
+	}
+}
+
+func TestRuntimeErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 1;\nx + \"a\"",
+			"main.mk:2:3: unsupported types for binary operation: INTEGER STRING",
+		},
+		{
+			"let inner = fn(x) {\n  x - 1\n};\nlet outer = fn(y) { inner(y) + 1 };\nouter(\"a\")",
+			"main.mk:2:5: unsupported types for binary operation: STRING INTEGER\n\tin fn inner(x) with x = \"a\"\n\tcalled from main.mk:4:26 in fn outer(y) with y = \"a\"\n\tcalled from main.mk:5:6",
+		},
+		{
+			"let f = fn(n) { if (n == 0) { [][\"a\"] } else { 1 + f(n - 1) } };\nf(3)",
+			"main.mk:1:33: index operator not supported: ARRAY\n\tin fn f(n) with n = 0\n\tcalled from main.mk:1:53 in fn f(n) (3 times)\n\tcalled from main.mk:2:2",
+		},
+		{
+			"let f = fn() { 1 + [] };\nlet g = fn() { 1 + [] };\ng()",
+			"main.mk:2:18: unsupported types for binary operation: INTEGER ARRAY\n\tin fn g()\n\tcalled from main.mk:3:2",
+		},
+		{
+			"let apply = fn(g) { g() + 1 };\napply(fn() { 1 + [] })",
+			"main.mk:2:16: unsupported types for binary operation: INTEGER ARRAY\n\tin fn()\n\tcalled from main.mk:1:22 in fn apply(g) with g = fn()\n\tcalled from main.mk:2:6",
+		},
+		{
+			"let f = fn(x) {\n  let y = x * 2;\n  y + true\n};\nlet g = fn(s) { f(len(s)) + 1 };\ng(\"ab\")",
+			"main.mk:3:5: unsupported types for binary operation: INTEGER BOOLEAN\n\tin fn f(x) with x = 2, y = 4\n\tcalled from main.mk:5:18 in fn g(s) with s = \"ab\"\n\tcalled from main.mk:6:2",
+		},
+		{
+			// Each call takes four slots: f and its three locals
+			"let f = fn(n) { let a = n; let b = n; f(n) + a + b };\nf(1)",
+			fmt.Sprintf("main.mk:1:40: stack overflow\n\tin fn f(n) with n = 1, a = 1, b = 1\n\tcalled from main.mk:1:40 in fn f(n) (%d times)\n\tcalled from main.mk:2:2", StackSize/4-2),
+		},
+		{
+			"let f = fn() { f() + 1 };\nf()",
+			fmt.Sprintf("main.mk:1:17: stack overflow: more than %d nested calls\n\tin fn f()\n\tcalled from main.mk:1:17 in fn f() (%d times)\n\tcalled from main.mk:2:2", MaxFrames, MaxFrames-2),
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		comp.SetFile("main.mk")
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error.\nwant %q\ngot  %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	program := parse(`let fibonacci = fn(x) {
+		if (x == 0) { return 0; }
+		if (x < 3) { return 1; }
+		fibonacci(x - 1) + fibonacci(x - 2)
+	};
+	fibonacci(20)`)
+
+	superinstructions := compiler.DefaultOptions()
+	plain := superinstructions
+	plain.Superinstructions = false
+
+	benchmarks := []struct {
+		name    string
+		options compiler.Options
+	}{
+		{"plain", plain},
+		{"superinstructions", superinstructions},
+	}
+
+	for _, bm := range benchmarks {
+		comp := compiler.NewWithOptions(bm.options)
+		if err := comp.Compile(program); err != nil {
+			b.Fatalf("compile error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				vm := New(bytecode)
+				if err := vm.Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSuperinstructions(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(x) { x - 1 }; f(5)`, 4},
+		{`let f = fn(x) { x + 1 }; f(41)`, 42},
+		{`let f = fn(x, y) { if (x < y) { 1 } else { 2 } }; [f(1, 2), f(2, 1), f(2, 2)]`, []int{1, 2, 2}},
+		{`let f = fn(x, y) { if (x > y) { 1 } else { 2 } }; [f(1, 2), f(2, 1), f(2, 2)]`, []int{2, 1, 2}},
+		{`let f = fn(x, y) { if (x == y) { 1 } else { 2 } }; [f(1, 1), f(1, 2), f("a", "a"), f(true, false)]`, []int{1, 2, 1, 2}},
+		{`let f = fn(x, y) { if (x != y) { 1 } else { 2 } }; [f(1, 1), f(1, 2), f("a", "b"), f(true, true)]`, []int{2, 1, 1, 2}},
+		{`let count = fn(n, acc) { if (n == 0) { return acc; } count(n - 1, acc + 1) }; count(100, 0)`, 100},
+	}
+
+	runVmTests(t, tests)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(x) { x - 1 }; f("a")`, "unsupported types for binary operation: STRING INTEGER"},
+		{`let f = fn(x) { x + 1 }; f(true)`, "unsupported types for binary operation: BOOLEAN INTEGER"},
+		{`let f = fn(x) { if (x < 1) { 1 } }; f("a")`, fmt.Sprintf("unkown operator: %d (STRING INTEGER)", code.OpLessThan)},
+	}
+
+	for _, tt := range errors {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil || message(err) != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestPeepholeMatchesUnoptimized(t *testing.T) {
+	inputs := []string{
+		`let f = fn(x) { if (!x) { 1 } else { 2 } }; [f(true), f(false), f(0), f(if (false) { 1 })]`,
+		`let f = fn(x) { if (!(x < 3)) { return x; } f(x + 1) }; f(0)`,
+		`let f = fn(x) { if (x) { 1 }; if (!x) { 2 }; 3 }; f(true) + f(false)`,
+		`let f = fn(x) { if (x > 1) { if (x > 2) { 3 } else { 2 } } else { if (x > 0) { 1 } } }; [f(0), f(1), f(2), f(3)]`,
+		`let f = fn() { if (false) { 1 }; if (true) { }; 4 }; f()`,
+		`let f = fn(x) { let y = if (!x) { 10 }; y }; [f(false), f(true)]`,
+		`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)`,
+		`enum Shape { Circle(r), Empty };
+		let f = fn(s) { match (s) { Circle(r) { if (!(r > 1)) { } else { r } } Empty { } } };
+		[f(Shape.Circle(1)), f(Shape.Circle(2)), f(Shape.Empty)]`,
+		`let f = fn(c) { select { case v = recv(c) { if (!v) { 0 } else { v } } default { } } };
+		let c = chan(1); send(c, 5); [f(c), f(c)]`,
+		`let f = fn(c) { select { case recv(c) { } } }; let c = chan(1); send(c, 1); f(c)`,
+		`let g = fn*(n) { if (!(n > 0)) { yield 0; } else { yield n; yield n * 2; } }; [g(2).take(5), g(0).take(5)]`,
+		`!true; if (!false) { 5 }`,
+	}
+
+	for _, input := range inputs {
+		results := []string{}
+		for _, peephole := range []bool{false, true} {
+			options := compiler.DefaultOptions()
+			options.Peephole = peephole
+			options.Superinstructions = peephole
+
+			comp := compiler.NewWithOptions(options)
+			if err := comp.Compile(parse(input)); err != nil {
+				t.Fatalf("compile error: %s", err)
+			}
+
+			vm := New(comp.Bytecode())
+			if err := vm.Run(); err != nil {
+				t.Fatalf("%q: vm error: %s", input, err)
+			}
+			results = append(results, vm.LastPoppedStackElem().Inspect())
+		}
+
+		if results[0] != results[1] {
+			t.Errorf("%q: unoptimized gave %s, optimized %s", input, results[0], results[1])
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)`, 5000050000},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0)`, 5000050000},
+		{`let apply = fn(f, x) { f(x) }; let down = fn(n) { if (n == 0) { 0 } else { apply(down, n - 1) } }; down(5000)`, 0},
+		{`let f = fn(n) { if (n == 0) { return len([1, 2]); } f(n - 1) }; f(5000)`, 2},
+		{`let wrap = fn(x) { let inner = fn(y) { y + x }; inner(1) }; wrap(2)`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn() { f() + 1 }; f()`, fmt.Sprintf("stack overflow: more than %d nested calls", MaxFrames)},
+		{`let f = fn(a, b, c, d) { f(a, b, c, d) + 1 }; f(1, 2, 3, 4)`, "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil || message(err) != tt.expected {
+			t.Errorf("expected error %q, got %v", tt.expected, err)
+		}
+	}
+}
+
+func TestWideConstants(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&input, "%d;", i)
+	}
+	input.WriteString("fn() { 69999 - 70000 }()")
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input.String())); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, -1, vm.LastPoppedStackElem())
+}
+
+func TestOptimizedCode(t *testing.T) {
+	tests := []vmTestCase{
+		{`-(1 + 2) * 3`, -9},
+		{`"mon" + "key"`, "monkey"},
+		{`if (1 < 2) { 10 } else { 20 }`, 10},
+		{`if (!true) { 10 }`, Null},
+		{`let f = fn() { if (true) { return 1; }; 2 }; f()`, 1},
+		{`let f = fn(x) { if (x) { return 1; } else { return 2; }; 3 }; f(true) + f(false)`, 3},
+		{`let f = fn() { return 1; 2 }; f()`, 1},
+		{`let f = fn() { if (false) { return 1; } }; f()`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSets(t *testing.T) {
+	tests := []vmTestCase{
+		{`len(set([1, 2, 2, 3, 1]))`, 3},
+		{`set([1, 2]).len()`, 2},
+		{`2 in set([1, 2])`, true},
+		{`"c" in set(["a", "b"])`, false},
+		{`"a" in {"a": 1}`, true},
+		{`3 in [1, 2, 3]`, true},
+		{`"key" in "monkey"`, true},
+		{`set([1, 2]).union(set([2, 3])).values()`, []int{1, 2, 3}},
+		{`set([1, 2, 3]).intersection(set([3, 2, 5])).values()`, []int{2, 3}},
+		{`set([1, 2, 3]).difference(set([2])).values()`, []int{1, 3}},
+		{`set([1, 2]) == set([2, 1])`, true},
+		{`set([1, 2]) != set([1])`, true},
+		{`set([1]).add(2) == set([1, 2])`, true},
+		{`set([1, 2, 3]).map(fn(x) { x / 2 }).values()`, []int{0, 1}},
+		{`set([1, 2, 3]).filter(fn(x) { x > 1 }).len()`, 2},
+		{`set([1, 2, 3]).reduce(fn(acc, x) { acc + x }, 0)`, 6},
+		{`set([[1]])`, &object.Error{Message: "unusable as set element: ARRAY"}},
+		{`set([1]).union([1])`, &object.Error{Message: "argument to `union` must be SET, got ARRAY"}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestEnums(t *testing.T) {
+	shapes := `enum Shape { Circle(r), Rect(w, h), Empty };
+	let area = fn(s) {
+		match (s) {
+			Circle(r) { 3 * r * r }
+			Shape.Rect(w, h) { w * h }
+			Empty { 0 }
+		}
+	};`
+
+	tests := []vmTestCase{
+		{shapes + `area(Shape.Circle(2))`, 12},
+		{shapes + `area(Shape.Rect(2, 5))`, 10},
+		{shapes + `area(Shape.Empty)`, 0},
+		{shapes + `[Shape.Circle(1), Shape.Rect(2, 3)].map(area).reduce(fn(a, b) { a + b }, 0)`, 9},
+		{shapes + `Shape.Circle(2) == Shape.Circle(2)`, true},
+		{shapes + `Shape.Circle(2) == Shape.Circle(3)`, false},
+		{shapes + `Shape.Circle(2) != Shape.Rect(2, 2)`, true},
+		{shapes + `Shape.Empty == Shape.Empty`, true},
+		{shapes + `Shape.Rect(2, 3).h`, 3},
+		{shapes + `match (5) { Circle { 1 } default { 2 } }`, 2},
+		{shapes + `match (Shape.Circle(1)) { Circle { 1 } }`, 1},
+		{shapes + `let r = 10; match (Shape.Circle(1)) { Circle(r) { r } }; r`, 10},
+		{shapes + `let f = fn(r) { match (Shape.Circle(1)) { Circle(r) { r } }; r }; f(10)`, 10},
+		{shapes + `let g = match (Shape.Circle(4)) { Circle(r) { fn() { r } } }; let r = 1; g()`, 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestEnumErrors(t *testing.T) {
+	shapes := "enum Shape { Circle(r), Empty };"
+
+	tests := []vmTestCase{
+		{shapes + "Shape.Circle(1, 2);", "wrong number of fields for Shape.Circle: want=1, got=2"},
+		{shapes + "Shape.Square;", "unknown variant Square of Shape"},
+		{shapes + "Shape.Circle(1).d;", "unknown field d on Shape.Circle"},
+		{shapes + "match (Shape.Empty) { Circle(r) { r } };", "no match arm for Shape.Empty"},
+		{shapes + "match (Shape.Circle(1)) { Circle(a, b) { a } };", "pattern Circle binds 2 values, Shape.Circle(1) has 1"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if message(err) != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []vmTestCase{
+		{`let ch = chan(1); send(ch, 5); recv(ch)`, 5},
+		{`recv(spawn(fn(a, b) { a + b }, 2, 3))`, 5},
+		{
+			`let work = fn(x) { x * x };
+			let fanout = fn(xs, out) {
+				if (len(xs) > 0) {
+					spawn(fn() { send(out, work(first(xs))) });
+					fanout(rest(xs), out);
+				}
+			};
+			let out = chan(3);
+			fanout([1, 2, 3], out);
+			recv(out) + recv(out) + recv(out)`,
+			14,
+		},
+		{`let x = 1; let r = spawn(fn() { x }); let x = 2; recv(r)`, 1},
+		{
+			`let a = chan(1); let b = chan(1); send(b, 7);
+			select { case v = recv(a) { v } case v = recv(b) { v * 2 } }`,
+			14,
+		},
+		{`let a = chan(); select { case recv(a) { 1 } default { 2 } }`, 2},
+		{`let a = chan(1); select { case send(a, 3) { } }; recv(a)`, 3},
+		{`let v = 5; let a = chan(1); send(a, 1); select { case v = recv(a) { v } }; v`, 5},
+		{`let f = fn(v) { let a = chan(1); send(a, 1); select { case v = recv(a) { v } } + v }; f(5)`, 6},
+		{`let a = chan(); close(a); recv(a)`, Null},
+		{`let a = chan(); close(a); select { case v = recv(a) { v } }`, Null},
+		{
+			`let a = chan(); close(a); close(a)`,
+			&object.Error{Message: "close of closed channel"},
+		},
+		{
+			`send(5, 1)`,
+			&object.Error{Message: "argument to `send` must be CHANNEL, got INTEGER"},
+		},
+		{
+			`recv(spawn(fn() { 1 + true }))`,
+			&object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"},
+		},
+		{`recv(spawn(len, "abc"))`, 3},
+		{`recv(spawn(first, []))`, Null},
+		{
+			`recv(spawn(len, 1))`,
+			&object.Error{Message: "argument to `len` not supported, got INTEGER"},
+		},
+		{`struct P { n }; impl P { fn get(self) { self.n } }; let p = P(3); recv(spawn(p.get))`, 3},
+		{`struct P { n }; recv(spawn(P, 4)).n`, 4},
+		{`enum Shape { Circle(r) }; match (recv(spawn(Shape.Circle, 5))) { Circle(r) { r } }`, 5},
+		{
+			`recv(spawn(5))`,
+			&object.Error{Message: "calling non-function and non-built-in"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let upto = fn(i, n) { if (i < n) { yield i; upto(i + 1, n); } };
+			let count = fn*(n) { upto(0, n); };
+			count(3).take(10)`,
+			[]int{0, 1, 2},
+		},
+		{
+			`let from = fn(i) { yield i; from(i + 1); };
+			let naturals = fn*() { from(0); };
+			naturals().filter(fn(x) { x / 2 * 2 == x }).map(fn(x) { x * x }).take(3)`,
+			[]int{0, 4, 16},
+		},
+		{
+			`let g = fn*() { yield 1; };
+			let it = g();
+			[it.next(), it.done(), it.next(), it.done()]`,
+			[]interface{}{1, false, Null, true},
+		},
+		{
+			`let emit = fn(x) { yield x * 10; };
+			let g = fn*(xs) { xs.map(fn(x) { x }); emit(1); emit(2); };
+			g([]).take(5)`,
+			[]int{10, 20},
+		},
+		{
+			`let outer = 5;
+			let g = fn*() { yield outer; let inner = fn*() { yield outer + 1; }; yield inner().next(); };
+			g().take(5)`,
+			[]int{5, 6},
+		},
+		{
+			`fn*() { yield 1 + true; }().next()`,
+			&object.Error{Message: "unsupported types for binary operation: INTEGER BOOLEAN"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestYieldOutsideGenerator(t *testing.T) {
+	program := parse("let f = fn() { yield 1; }; f();")
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if message(err) != "yield outside of generator" {
+		t.Fatalf("wrong VM error: want=%q, got=%q", "yield outside of generator", err)
+	}
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`"abc".upper()`, "ABC"},
+		{`"  Monkey ".trim().lower()`, "monkey"},
+		{`"a,b,c".split(",").len()`, 3},
+		{`"monkey".contains("key")`, true},
+		{`[1, 2, 3].map(fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`[1, 2, 3, 4].filter(fn(x) { x > 2 })`, []int{3, 4}},
+		{`[1, 2, 3, 4].reduce(fn(acc, x) { acc + x }, 0)`, 10},
+		{`[1, 2, 3].rest().push(4).first()`, 2},
+		{`[1, 2, 3].join("-")`, "1-2-3"},
+		{`{"b": 2, "a": 1}.keys().join(",")`, "a,b"},
+		{`{"b": 2, "a": 1}.values()`, []int{1, 2}},
+		{`{"a": 1}.has("a")`, true},
+		{`{"a": 1}.len()`, 1},
+		{
+			`let offset = 10;
+			let addAll = fn(xs) { xs.map(fn(x) { x + offset }) };
+			addAll([1, 2]).map(fn(x) { [x].map(fn(y) { y * 2 }).first() })`,
+			[]int{22, 24},
+		},
+		{
+			`[1, 2].map(fn(x, y) { x })`,
+			&object.Error{Message: "wrong number of arguments: want=2, got=1"},
+		},
+		{
+			`"abc".split(1)`,
+			&object.Error{Message: "argument to `split` must be STRING, got INTEGER"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestUndefinedMethod(t *testing.T) {
+	program := parse(`5.upper()`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	if message(err) != "undefined method upper for INTEGER" {
+		t.Fatalf("wrong VM error. got=%q", err)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct Point { x, y }; let p = Point(1, 2); p.x;", 1},
+		{"struct Point { x, y }; let p = Point(1, 2); p.y;", 2},
+		{"struct Pair { left, right }; Pair(Pair(1, 2), 3).left.right;", 2},
+		{
+			`struct Point { x, y };
+			impl Point {
+				fn sum(p) { p.x + p.y }
+				fn scale(p, k) { Point(p.x * k, p.y * k) }
+			}
+			Point(1, 2).scale(10).sum();`,
+			30,
+		},
+		{
+			`let make = fn(step) {
+				struct Counter { n };
+				impl Counter { fn next(c) { Counter(c.n + step) } }
+				Counter(0);
+			};
+			let c = make(5);
+			let bump = c.next;
+			bump().n;`,
+			5,
+		},
+		{"let make = fn(v) { struct P { n }; impl P { fn next(self) { P(v) } }; P(0) }; let a = make(5); let b = make(7); a.next().n", 5},
+		{"struct A { x }; struct B { y, x }; let get = fn(s) { s.x }; [get(A(1)), get(B(2, 3)), get(A(4)), get(B(5, 6))]", []int{1, 3, 4, 6}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"struct Point { x, y }; Point(1);", "wrong number of fields for Point: want=2, got=1"},
+		{"struct Point { x, y }; Point(1, 2).z;", "unknown field z on Point"},
+		{"let p = 5; p.x;", "member access not supported: INTEGER"},
+		{"let p = 5; impl p { fn f(s) { s } }", "impl target is not a struct: INTEGER"},
+		{"struct Point { x, y }; impl Point { fn f(p) { p } }; Point(1, 2).f(3);", "wrong number of arguments: want=1, got=2"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if message(err) != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
 func TestRecursiveFibonacci(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -158,7 +880,7 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 			t.Fatal("expected VM error but resulted in none.")
 		}
 
-		if err.Error() != tt.expected {
+		if message(err) != tt.expected {
 			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
 		}
 
@@ -565,6 +1287,14 @@ func testExpectedObject(t *testing.T,
 	}
 }
 
+// message returns the text of err without the positions Run adds to it.
+func message(err error) string {
+	if runtimeErr, ok := err.(*RuntimeError); ok {
+		return runtimeErr.Err.Error()
+	}
+	return err.Error()
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)